@@ -1,7 +1,10 @@
 package lkit_go
 
 import (
+	"context"
 	"github.com/xlkness/lkit-go/internal/application"
+	"os"
+	"time"
 )
 
 type Scheduler = application.Scheduler
@@ -15,6 +18,12 @@ type AppOption = application.AppOption
 // CommBootFlag 调度器的全局通用启动参数
 type CommBootFlag = application.CommBootFlag
 
+// BootConfigLogLevel 起服配置文件结构体实现该接口时，SIGHUP热加载会重设日志等级
+type BootConfigLogLevel = application.BootConfigLogLevel
+
+// BootConfigValidator 起服配置文件结构体实现该接口时，解析后会先校验，热加载、etcd配置修改校验失败保留旧配置
+type BootConfigValidator = application.BootConfigValidator
+
 func NewApplicationDescInfo(name string, initFunc func(globalBootFlag *CommBootFlag, globalBootFile interface{}, app *Application) error, options ...AppOption) *ApplicationDescInfo {
 	adi := application.NewApplicationDescInfo(name, initFunc)
 	adi.WithOptions(options...)
@@ -31,16 +40,127 @@ func WithAppBootFlag(flag interface{}) AppOption {
 	return application.WithAppBootFlag(flag)
 }
 
-// WithSchedulerBootConfigFileContent 设置启动配置文件的解析结构，指针结构体类型，不设置默认无起服配置，默认以yaml解析
+// WithAppDrainTimeout 设置app优雅停止的排空超时时间，默认15秒
+func WithAppDrainTimeout(timeout time.Duration) AppOption {
+	return application.WithAppDrainTimeout(timeout)
+}
+
+type RestartPolicy = application.RestartPolicy
+type RestartPolicyType = application.RestartPolicyType
+
+var (
+	RestartNever     = application.RestartNever
+	RestartOnFailure = application.RestartOnFailure
+	RestartAlways    = application.RestartAlways
+)
+
+// WithAppDependsOn 设置app依赖的其它app名，依赖的app都启动完毕后才启动当前app
+func WithAppDependsOn(appNames ...string) AppOption {
+	return application.WithAppDependsOn(appNames...)
+}
+
+// WithAppRestartPolicy 设置app退出后的重启策略，默认不重启，app退出就停止整个调度器
+func WithAppRestartPolicy(policy RestartPolicy) AppOption {
+	return application.WithAppRestartPolicy(policy)
+}
+
+// Component app的通用组件，实现后可以随app启动、停止，并上报就绪状态
+type Component = application.Component
+
+// NewComponent 用启动、停止函数创建组件，start阻塞运行期间组件为就绪状态
+func NewComponent(name string, start func(ctx context.Context) error, stop func(ctx context.Context) error) Component {
+	return application.NewComponent(name, start, stop)
+}
+
+// NewSocketServerComponent 把NewSocketServer、NewWSSocketServer创建的socket服务包装为组件，监听成功后就绪
+func NewSocketServerComponent(name string, server SocketServer) Component {
+	return application.NewSocketServerComponent(name, server)
+}
+
+// NewKcpListenerComponent 把KcpListen创建的kcp监听包装为组件，app停止时关闭监听
+func NewKcpListenerComponent(name string, listener *KcpListener) Component {
+	return application.NewKcpListenerComponent(name, listener)
+}
+
+type CronJob = application.CronJob
+type CronJobOption = application.CronJobOption
+type CronOverlapPolicy = application.CronOverlapPolicy
+
+var (
+	CronOverlapSkip       = application.CronOverlapSkip
+	CronOverlapQueue      = application.CronOverlapQueue
+	CronOverlapConcurrent = application.CronOverlapConcurrent
+)
+
+// WithCronJobLocation 设置定时任务cron表达式的时区，默认本地时区
+func WithCronJobLocation(loc *time.Location) CronJobOption {
+	return application.WithCronJobLocation(loc)
+}
+
+// WithCronJobJitter 定时任务每次触发随机延迟[0, jitter)再执行
+func WithCronJobJitter(jitter time.Duration) CronJobOption {
+	return application.WithCronJobJitter(jitter)
+}
+
+// WithCronJobOverlapPolicy 设置定时任务上次执行还没结束时又触发的处理策略，默认跳过
+func WithCronJobOverlapPolicy(policy CronOverlapPolicy) CronJobOption {
+	return application.WithCronJobOverlapPolicy(policy)
+}
+
+// WithSchedulerBootConfigFileContent 设置启动配置文件的解析结构，指针结构体类型，不设置默认无起服配置
 func WithSchedulerBootConfigFileContent(content interface{}) SchedulerOption {
 	return application.WithSchedulerBootConfigFileContent(content)
 }
 
-// WithSchedulerBootConfigFileParser 设置起服文件解析函数，默认yaml格式
+// WithSchedulerBootConfigFileParser 设置起服文件解析函数，默认按文件后缀选择json、toml，其它按yaml解析
 func WithSchedulerBootConfigFileParser(f func(content []byte, out interface{}) error) SchedulerOption {
 	return application.WithSchedulerBootConfigFileParser(f)
 }
 
+// WithSchedulerEtcdConfig 从etcd的key读取起服配置代替BootConfigFile，etcd地址由启动参数boot_config_etcd指定，
+// 运行时监听key的修改，校验通过后推送给app
+func WithSchedulerEtcdConfig(key string) SchedulerOption {
+	return application.WithSchedulerEtcdConfig(key)
+}
+
+// SubscribeBootConfig 以具体的配置结构体指针类型订阅起服配置的修改(SIGHUP热加载、etcd配置修改)
+func SubscribeBootConfig[T any](app *Application, desc string, callback func(conf T) error) *Application {
+	return application.SubscribeBootConfig(app, desc, callback)
+}
+
+// SupervisorChild 监督模式下的一个子进程及其运行的app
+type SupervisorChild = application.SupervisorChild
+
+// WithSchedulerSupervisor 以监督模式运行，fork子进程分别运行一部分app，重启崩溃的子进程、转发信号、聚合子进程指标
+func WithSchedulerSupervisor(children ...SupervisorChild) SchedulerOption {
+	return application.WithSchedulerSupervisor(children...)
+}
+
+// WithSchedulerSupervisorRestartPolicy 设置监督模式子进程的重启策略，默认总是重启
+func WithSchedulerSupervisorRestartPolicy(policy RestartPolicy) SchedulerOption {
+	return application.WithSchedulerSupervisorRestartPolicy(policy)
+}
+
+// WithSchedulerBootArgs 用args和env代替os.Args、进程环境变量解析启动参数，用于测试，一般直接用apptest包
+func WithSchedulerBootArgs(args []string, env map[string]string) SchedulerOption {
+	return application.WithSchedulerBootArgs(args, env)
+}
+
+// WithSchedulerBootConfigContent 使用内存里的起服配置代替BootConfigFile，name的后缀决定默认解析格式
+func WithSchedulerBootConfigContent(name string, content []byte) SchedulerOption {
+	return application.WithSchedulerBootConfigContent(name, content)
+}
+
+// WithSchedulerRegistry app通过Application.Registry获取注册中心时都使用r代替传入的注册中心，用于测试、所有服务打包在一个进程的部署
+func WithSchedulerRegistry(r Registry) SchedulerOption {
+	return application.WithSchedulerRegistry(r)
+}
+
+// WithSchedulerSignals 从signals接收信号代替监听进程信号，用于测试
+func WithSchedulerSignals(signals <-chan os.Signal) SchedulerOption {
+	return application.WithSchedulerSignals(signals)
+}
+
 func WithSchedulerLogFileLevel(level LogLevel) SchedulerOption {
 	return application.WithSchedulerLogFileLevel(level)
 }
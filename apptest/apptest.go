@@ -0,0 +1,299 @@
+// Package apptest 在测试进程内启动Scheduler，不fork二进制：启动参数、起服配置由测试注入，不监听进程信号，
+// app通过Application.Registry获取的注册中心替换为内存注册中心，trace server使用随机端口。
+// 调度器依赖日志、prometheus等进程全局状态，同一时间只能运行一个Harness，多个测试会排队执行
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/application"
+	"github.com/xlkness/lkit-go/internal/joymicro/joyclient"
+	"github.com/xlkness/lkit-go/internal/joymicro/joystream"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"github.com/xlkness/lkit-go/internal/web/engine"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// DefaultWaitTimeout 等待app就绪、调度器停止的默认超时时间
+var DefaultWaitTimeout = time.Second * 30
+
+// DefaultCallTimeout rpc调用的默认超时时间
+var DefaultCallTimeout = time.Second * 5
+
+// 同一时间只能运行一个Harness
+var harnessLock = new(sync.Mutex)
+
+// Harness 测试进程内运行的调度器
+type Harness struct {
+	t          testing.TB
+	scd        *application.Scheduler
+	signals    chan os.Signal
+	registry   *registry.MemoryRegistry
+	args       []string
+	env        map[string]string
+	options    []application.SchedulerOption
+	runErrChan chan error
+	runErr     error
+	clients    map[string]*joyclient.Service
+	lock       *sync.Mutex
+	stopOnce   *sync.Once
+}
+
+// Option Harness选项
+type Option func(h *Harness)
+
+// WithArgs 追加启动参数，例如"-log_level=info"，默认已经有"-trace_port=0"和临时目录的"-log_dir"
+func WithArgs(args ...string) Option {
+	return func(h *Harness) {
+		h.args = append(h.args, args...)
+	}
+}
+
+// WithEnv 代替进程环境变量的启动参数
+func WithEnv(env map[string]string) Option {
+	return func(h *Harness) {
+		h.env = env
+	}
+}
+
+// WithBootConfig 起服配置内容，name的后缀决定默认解析格式，例如"boot.yaml"
+func WithBootConfig(name string, content []byte) Option {
+	return func(h *Harness) {
+		h.options = append(h.options, application.WithSchedulerBootConfigContent(name, content))
+	}
+}
+
+// WithSchedulerOptions 其它调度器选项，例如WithSchedulerBootConfigFileContent
+func WithSchedulerOptions(options ...application.SchedulerOption) Option {
+	return func(h *Harness) {
+		h.options = append(h.options, options...)
+	}
+}
+
+// Start 在后台运行调度器，测试结束时自动停止，调用方一般接着调用WaitReady
+func Start(t testing.TB, adis []*application.ApplicationDescInfo, options ...Option) *Harness {
+	t.Helper()
+	harnessLock.Lock()
+
+	h := &Harness{
+		t:          t,
+		signals:    make(chan os.Signal, 1),
+		registry:   registry.NewMemoryRegistry(),
+		args:       []string{"-trace_port=0", "-log_dir=" + t.TempDir()},
+		runErrChan: make(chan error, 1),
+		clients:    make(map[string]*joyclient.Service),
+		lock:       new(sync.Mutex),
+		stopOnce:   new(sync.Once),
+	}
+	for _, option := range options {
+		option(h)
+	}
+
+	scdOptions := []application.SchedulerOption{
+		application.WithSchedulerBootArgs(h.args, h.env),
+		application.WithSchedulerSignals(h.signals),
+		application.WithSchedulerRegistry(h.registry),
+	}
+	scdOptions = append(scdOptions, h.options...)
+	h.scd = application.NewScheduler(scdOptions...).CreateApp(adis...)
+
+	go func() {
+		h.runErrChan <- h.scd.Run()
+	}()
+
+	t.Cleanup(func() {
+		err := h.Shutdown()
+		if err != nil {
+			t.Errorf("apptest shutdown error:%v", err)
+		}
+	})
+	return h
+}
+
+// Scheduler 获取运行的调度器
+func (h *Harness) Scheduler() *application.Scheduler {
+	return h.scd
+}
+
+// Registry 获取app通过Application.Registry获取的内存注册中心
+func (h *Harness) Registry() *registry.MemoryRegistry {
+	return h.registry
+}
+
+// WaitReady 等待所有app就绪，app的rpc服务、web服务监听成功后才会就绪，超时或者调度器启动失败时测试失败
+func (h *Harness) WaitReady() {
+	h.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultWaitTimeout)
+	defer cancel()
+
+	readyChan := make(chan error, 1)
+	go func() {
+		readyChan <- h.scd.WaitReady(ctx)
+	}()
+
+	select {
+	case err := <-readyChan:
+		if err != nil {
+			h.t.Fatalf("apptest wait ready error:%v", err)
+		}
+	case err := <-h.runErrChan:
+		h.runErrChan <- err
+		h.t.Fatalf("apptest scheduler exit before ready:%v", err)
+	}
+}
+
+// App 按名字获取app，不存在测试失败
+func (h *Harness) App(name string) *application.Application {
+	h.t.Helper()
+	app := h.scd.App(name)
+	if app == nil {
+		h.t.Fatalf("apptest application %v not found", name)
+	}
+	return app
+}
+
+// Server 获取app添加的web服务器，不存在测试失败
+func (h *Harness) Server(appName, desc string) *engine.Engine {
+	h.t.Helper()
+	server := h.App(appName).Server(desc)
+	if server == nil {
+		h.t.Fatalf("apptest application %v server %v not found", appName, desc)
+	}
+	return server
+}
+
+// Do 不经过网络直接调用web服务器的路由处理请求
+func (h *Harness) Do(appName, desc string, req *http.Request) *httptest.ResponseRecorder {
+	h.t.Helper()
+	return serveHTTP(h.Server(appName, desc), req)
+}
+
+// HTTP 构造请求调用web服务器，见Do
+func (h *Harness) HTTP(appName, desc string, method, path string, body io.Reader) *httptest.ResponseRecorder {
+	h.t.Helper()
+	return h.Do(appName, desc, httptest.NewRequest(method, path, body))
+}
+
+// TraceHTTP 调用trace server，例如"/readyz"、"/metrics"、"/admin/apps"，请求来源为本机，
+// 没有设置admin_token时可以调用运维接口
+func (h *Harness) TraceHTTP(method, path string, body io.Reader) *httptest.ResponseRecorder {
+	h.t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	req.RemoteAddr = "127.0.0.1:0"
+	return serveHTTP(h.scd.TraceServer(), req)
+}
+
+// URL web服务器实际监听地址的url，用于需要经过网络的测试，例如websocket，
+// 会等待web服务器监听成功，超时或者调度器退出时测试失败，不会返回配置的监听地址
+func (h *Harness) URL(appName, desc string) string {
+	h.t.Helper()
+	server := h.Server(appName, desc)
+	select {
+	case <-server.Bound():
+	case err := <-h.runErrChan:
+		h.runErrChan <- err
+		h.t.Fatalf("apptest scheduler exit before application %v server %v bound:%v", appName, desc, err)
+	case <-time.After(DefaultWaitTimeout):
+		h.t.Fatalf("apptest wait application %v server %v bound timeout:%v", appName, desc, DefaultWaitTimeout)
+	}
+	return "http://" + dialAddr(server.ListenAddr())
+}
+
+// Call 通过内存注册中心发现服务并调用rpc方法，ctx没有超时时间默认DefaultCallTimeout
+func (h *Harness) Call(ctx context.Context, service, method string, args interface{}, reply interface{}) error {
+	return h.client(service).Call(ctx, method, args, reply)
+}
+
+// CallAll 调用服务的所有节点
+func (h *Harness) CallAll(ctx context.Context, service, method string, args interface{}, reply interface{}) error {
+	return h.client(service).CallAll(ctx, method, args, reply)
+}
+
+// Stream 通过内存注册中心发现服务并建立流式调用
+func (h *Harness) Stream(ctx context.Context, service, method string) (*joystream.Stream, error) {
+	return h.client(service).Stream(ctx, method)
+}
+
+func (h *Harness) client(service string) *joyclient.Service {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	c, find := h.clients[service]
+	if !find {
+		c = joyclient.New(service, h.registry, DefaultCallTimeout, false)
+		h.clients[service] = c
+	}
+	return c
+}
+
+func (h *Harness) closeClients() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for service, c := range h.clients {
+		c.Close()
+		delete(h.clients, service)
+	}
+}
+
+// Signal 发送信号给调度器，SIGHUP热加载配置，其它退出信号优雅停止
+func (h *Harness) Signal(signal os.Signal) {
+	h.signals <- signal
+}
+
+// Shutdown 优雅停止调度器并等待退出，返回调度器Run的报错，可以重复调用
+func (h *Harness) Shutdown() error {
+	h.stopOnce.Do(func() {
+		defer harnessLock.Unlock()
+		defer h.closeClients()
+
+		select {
+		case h.signals <- syscall.SIGTERM:
+		case err := <-h.runErrChan:
+			h.runErr = err
+			return
+		}
+
+		select {
+		case h.runErr = <-h.runErrChan:
+		case <-time.After(DefaultWaitTimeout):
+			h.runErr = fmt.Errorf("wait scheduler stop timeout:%v", DefaultWaitTimeout)
+		}
+	})
+	return h.runErr
+}
+
+// FreeAddr 返回一个当前空闲的本地tcp地址，用于需要提前确定注册地址的rpc服务
+func FreeAddr() string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Errorf("apptest listen free addr error:%v", err))
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func serveHTTP(server *engine.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.GetGinEngine().ServeHTTP(w, req)
+	return w
+}
+
+// dialAddr 监听地址没有ip时用本地地址访问
+func dialAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,279 @@
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/application"
+	"github.com/xlkness/lkit-go/internal/joymicro/joyservice"
+	"github.com/xlkness/lkit-go/internal/joymicro/joystream"
+	"github.com/xlkness/lkit-go/internal/joymicro/rpc_context"
+	"github.com/xlkness/lkit-go/internal/web/engine"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testBootFlag struct {
+	Greeting string `env:"apptest_greeting" desc:"greeting" default:"hello"`
+	Name     string `env:"apptest_name" desc:"name" default:"nobody"`
+	RpcAddr  string `env:"apptest_rpc_addr" desc:"rpc addr" default:""`
+}
+
+type testBootConfig struct {
+	Suffix string `yaml:"suffix"`
+}
+
+type TestArgs struct {
+	A, B int
+}
+
+type TestReply struct {
+	C int
+}
+
+type TestInfo struct {
+	Caller    string
+	RequestID string
+	Baggage   string
+	Deadline  bool
+}
+
+type testArith struct{}
+
+func (t *testArith) Info(ctx context.Context, args *TestArgs, reply *TestInfo) error {
+	_, reply.Deadline = ctx.Deadline()
+	reply.Caller = rpc_context.Caller(ctx)
+	reply.RequestID = rpc_context.RequestID(ctx)
+	reply.Baggage = rpc_context.Baggage(ctx, "player")
+	return nil
+}
+
+func (t *testArith) Add(ctx context.Context, args *TestArgs, reply *TestReply) error {
+	reply.C = args.A + args.B
+	return nil
+}
+
+// testCount 服务端流，按请求的A返回A个数，B不为0时发送后返回错误
+func testCount(ctx context.Context, stream *joystream.Stream) error {
+	args := &TestArgs{}
+	if err := stream.Recv(args); err != nil {
+		return err
+	}
+	for i := 0; i < args.A; i++ {
+		if err := stream.Send(&TestReply{C: i}); err != nil {
+			return err
+		}
+	}
+	if args.B != 0 {
+		return fmt.Errorf("count error %v", args.B)
+	}
+	return nil
+}
+
+// testEcho 双向流，把收到的A+B原样返回，并返回调用方
+func testEcho(ctx context.Context, stream *joystream.Stream) error {
+	for {
+		args := &TestArgs{}
+		err := stream.Recv(args)
+		if err == io.EOF {
+			return stream.Send(&TestInfo{Caller: rpc_context.Caller(ctx)})
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(&TestReply{C: args.A + args.B}); err != nil {
+			return err
+		}
+	}
+}
+
+func newTestApps() []*application.ApplicationDescInfo {
+	flag := &testBootFlag{}
+	web := application.NewApplicationDescInfo("web", func(f *application.CommBootFlag, c interface{}, app *application.Application) error {
+		e := engine.NewEngine("127.0.0.1:0", nil)
+		e.GetGinEngine().GET("/greet", func(ctx *gin.Context) {
+			ctx.String(http.StatusOK, flag.Greeting+" "+flag.Name+c.(*testBootConfig).Suffix)
+		})
+		app.WithServer("http", e)
+		return nil
+	}).WithOptions(application.WithAppBootFlag(flag))
+
+	rpc := application.NewApplicationDescInfo("rpc", func(f *application.CommBootFlag, c interface{}, app *application.Application) error {
+		s, err := joyservice.New(flag.RpcAddr, flag.RpcAddr, app.Registry(nil))
+		if err != nil {
+			return err
+		}
+		s.DisableGateway()
+		err = s.RegisterOneService("arith", new(testArith), nil)
+		if err != nil {
+			return err
+		}
+		err = s.RegisterStream("arith", "Count", testCount, nil)
+		if err != nil {
+			return err
+		}
+		// 只有流式方法的服务
+		err = s.RegisterStream("echo", "Echo", testEcho, nil)
+		if err != nil {
+			return err
+		}
+		app.WithService("arith", s)
+		return nil
+	})
+	return []*application.ApplicationDescInfo{web, rpc}
+}
+
+func TestHarness(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		h := Start(t, newTestApps(),
+			WithArgs("-apptest_greeting=hi", "-apptest_rpc_addr="+FreeAddr()),
+			WithEnv(map[string]string{"apptest_name": "lkit"}),
+			WithBootConfig("boot.yaml", []byte("suffix: \"!\"")),
+			WithSchedulerOptions(application.WithSchedulerBootConfigFileContent(&testBootConfig{})))
+		h.WaitReady()
+
+		w := h.HTTP("web", "http", http.MethodGet, "/greet", nil)
+		if w.Code != http.StatusOK || w.Body.String() != "hi lkit!" {
+			t.Fatalf("greet response error:%v %v", w.Code, w.Body.String())
+		}
+
+		w = h.TraceHTTP(http.MethodGet, "/readyz", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("readyz response error:%v %v", w.Code, w.Body.String())
+		}
+
+		resp, err := http.Get(h.URL("web", "http") + "/greet")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("greet by network response error:%v", resp.StatusCode)
+		}
+
+		reply := &TestReply{}
+		err = h.Call(context.Background(), "arith", "Add", &TestArgs{A: 1, B: 2}, reply)
+		if err != nil || reply.C != 3 {
+			t.Fatalf("call arith error:%v, reply:%+v", err, reply)
+		}
+
+		info := &TestInfo{}
+		ctx := rpc_context.WithBaggage(rpc_context.WithRequestID(context.Background(), "req1"), "player", "1001")
+		err = h.Call(rpc_context.WithLocalService(ctx, "apptest"), "arith", "Info", &TestArgs{}, info)
+		if err != nil || *info != (TestInfo{Caller: "apptest", RequestID: "req1", Baggage: "1001", Deadline: true}) {
+			t.Fatalf("call arith info error:%v, reply:%+v", err, info)
+		}
+
+		testStream(t, h)
+
+		w = h.TraceHTTP(http.MethodGet, "/metrics", nil)
+		if !strings.Contains(w.Body.String(), `rpc_server_handled_total{code="ok",method="Add"`) ||
+			!strings.Contains(w.Body.String(), `rpc_client_calls_total{code="ok",method="Add"`) {
+			t.Fatalf("rpc metrics not found:%v", w.Body.String())
+		}
+
+		err = h.Shutdown()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h.Registry().Services("arith")) != 0 {
+			t.Fatalf("arith service not deregister after shutdown:%+v", h.Registry().Services("arith"))
+		}
+	}
+}
+
+func testStream(t *testing.T, h *Harness) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultCallTimeout)
+	defer cancel()
+
+	for _, b := range []int{0, 7} {
+		stream, err := h.Stream(ctx, "arith", "Count")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = stream.Send(&TestArgs{A: 3, B: b}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			reply := &TestReply{}
+			if err = stream.Recv(reply); err != nil || reply.C != i {
+				t.Fatalf("count stream recv %v error:%v, reply:%+v", i, err, reply)
+			}
+		}
+		err = stream.Recv(&TestReply{})
+		if b == 0 && err != io.EOF {
+			t.Fatalf("count stream not end with eof:%v", err)
+		}
+		if b != 0 && (err == nil || err.Error() != "count error 7") {
+			t.Fatalf("count stream not end with handler error:%v", err)
+		}
+		stream.Close()
+	}
+
+	stream, err := h.Stream(rpc_context.WithLocalService(ctx, "apptest"), "echo", "Echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	for i := 0; i < 3; i++ {
+		reply := &TestReply{}
+		if err = stream.Send(&TestArgs{A: i, B: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err = stream.Recv(reply); err != nil || reply.C != i+1 {
+			t.Fatalf("echo stream recv %v error:%v, reply:%+v", i, err, reply)
+		}
+	}
+	stream.CloseSend()
+	info := &TestInfo{}
+	if err = stream.Recv(info); err != nil || info.Caller != "apptest" {
+		t.Fatalf("echo stream recv caller error:%v, info:%+v", err, info)
+	}
+	if err = stream.Recv(info); err != io.EOF {
+		t.Fatalf("echo stream not end with eof:%v", err)
+	}
+
+	_, err = h.Stream(ctx, "arith", "NotFound")
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("stream not found method error:%v", err)
+	}
+}
+
+func TestHarnessURLWaitBound(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	web := application.NewApplicationDescInfo("web", func(f *application.CommBootFlag, c interface{}, app *application.Application) error {
+		e := engine.NewEngine("127.0.0.1:0", nil)
+		e.GetGinEngine().GET("/ping", func(ctx *gin.Context) {
+			ctx.String(http.StatusOK, "pong")
+		})
+		app.WithServer("http", e)
+		// 初始化任务阻塞期间web服务还没有监听
+		app.WithInitializeTask("block", func() error {
+			close(started)
+			<-release
+			return nil
+		})
+		return nil
+	})
+
+	h := Start(t, []*application.ApplicationDescInfo{web})
+	<-started
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		close(release)
+	}()
+
+	resp, err := http.Get(h.URL("web", "http") + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ping response error:%v", resp.StatusCode)
+	}
+}
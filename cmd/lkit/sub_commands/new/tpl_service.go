@@ -6,6 +6,7 @@ package service
 import (
 	"context"
 	api_{{.AppName}} "{{.AppName}}/api"
+	lkit_go "github.com/xlkness/lkit-go"
 	"github.com/xlkness/lkit-go/joyservice"
 )
 
@@ -18,7 +19,7 @@ func (svc *Service) Say(context.Context, *api_{{.AppName}}.{{.AppCamelName}}Req,
 
 func New() (*joyservice.ServicesManager, error) {
 	svc := new(Service)
-	svcMgr, err := api_hello.New{{.AppCamelName}}Handler(":8080", ":8080", []string{":2379"}, svc, true)
+	svcMgr, err := api_hello.New{{.AppCamelName}}Handler(":8080", ":8080", lkit_go.NewEtcdRegistry([]string{":2379"}), svc, true)
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +27,7 @@ func GenerateFile(protoFile *descriptorpb.FileDescriptorProto) []*pluginpb.CodeG
 			ProtoService: service,
 		}
 		for _, m := range s.ProtoService.GetMethod() {
-			s.Methods = append(s.Methods, &Method{ProtoMethod: m, Package: file.Package()})
+			s.Methods = append(s.Methods, &Method{ProtoMethod: m, Package: file.Package(), Service: s.Name_FooBar()})
 		}
 		file.Services = append(file.Services, s)
 	}
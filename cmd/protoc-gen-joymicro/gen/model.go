@@ -10,9 +10,73 @@ import (
 
 type Method struct {
 	Package     string
+	Service     string // 所属服务名，FooBar格式，用于流式方法的类型名
 	ProtoMethod *descriptorpb.MethodDescriptorProto
 }
 
+// IsStream 是否为流式方法
+func (m *Method) IsStream() bool {
+	return m.ProtoMethod.GetClientStreaming() || m.ProtoMethod.GetServerStreaming()
+}
+
+// IsServerStream 是否为只有服务端流的方法，客户端发送一个请求，服务端返回多个响应，
+// 客户端流和双向流都生成双向流接口
+func (m *Method) IsServerStream() bool {
+	return m.ProtoMethod.GetServerStreaming() && !m.ProtoMethod.GetClientStreaming()
+}
+
+// StreamClientName 流式方法客户端的流接口名
+func (m *Method) StreamClientName() string {
+	return m.Service + m.Name() + "StreamClient"
+}
+
+// StreamServerName 流式方法服务端的流接口名
+func (m *Method) StreamServerName() string {
+	return m.Service + m.Name() + "StreamServer"
+}
+
+// StreamClientImpl 流式方法客户端流接口的实现
+func (m *Method) StreamClientImpl() string {
+	return lkit_go.StringLowerCase(m.Service) + m.Name() + "StreamClient"
+}
+
+// StreamServerImpl 流式方法服务端流接口的实现
+func (m *Method) StreamServerImpl() string {
+	return lkit_go.StringLowerCase(m.Service) + m.Name() + "StreamServer"
+}
+
+// FutureName 普通方法异步调用结果的类型名
+func (m *Method) FutureName() string {
+	return m.Service + m.Name() + "Future"
+}
+
+// ServiceParams 服务调用接口的方法参数
+func (m *Method) ServiceParams() string {
+	if m.IsStream() && !m.IsServerStream() {
+		return "ctx context.Context"
+	}
+	return "ctx context.Context, in *" + m.InputType()
+}
+
+// ServiceResults 服务调用接口的方法返回值
+func (m *Method) ServiceResults() string {
+	if m.IsStream() {
+		return "(" + m.StreamClientName() + ", error)"
+	}
+	return "(*" + m.OutputType() + ", error)"
+}
+
+// HandlerParams 服务handler接口的方法参数
+func (m *Method) HandlerParams() string {
+	switch {
+	case m.IsServerStream():
+		return "context.Context, *" + m.InputType() + ", " + m.StreamServerName()
+	case m.IsStream():
+		return "context.Context, " + m.StreamServerName()
+	}
+	return "context.Context, *" + m.InputType() + ", *" + m.OutputType()
+}
+
 func (m *Method) Name() string {
 	return m.ProtoMethod.GetName()
 }
@@ -44,6 +108,16 @@ type Service struct {
 	Methods      []*Method
 }
 
+// HasUnaryMethods 是否有普通方法，rpcx不能注册只有流式方法的handler
+func (s *Service) HasUnaryMethods() bool {
+	for _, m := range s.Methods {
+		if !m.IsStream() {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Service) ServiceInterfaceName() string {
 	return s.Name_FooBar() + "ServiceInterface"
 }
@@ -125,6 +199,29 @@ func (f *File) HandlerInterfaceName() string {
 	return f.ServiceName_FooBar() + "HandlerInterface"
 }
 
+// HasUnaryMethods 是否有普通方法
+func (f *File) HasUnaryMethods() bool {
+	for _, s := range f.Services {
+		if s.HasUnaryMethods() {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamMethods 所有服务的流式方法
+func (f *File) StreamMethods() []*Method {
+	var methods []*Method
+	for _, s := range f.Services {
+		for _, m := range s.Methods {
+			if m.IsStream() {
+				methods = append(methods, m)
+			}
+		}
+	}
+	return methods
+}
+
 func (f *File) MultiServices() bool {
 	return len(f.Services) > 1
 }
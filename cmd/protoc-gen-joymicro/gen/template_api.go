@@ -21,9 +21,9 @@ var {{ .ServiceName_fooBar }}ServiceInstance {{ .ServiceInterfaceName }}
 {{ $serviceReceiver := printf "%s%s" .ServiceName_fooBar "Service" }}
 
 // LazyInit{{ .ServiceName_FooBar }}Service 懒汉模式初始化服务调用实例，只有在真正发生调用时才初始化
-func LazyInit{{ .ServiceName_FooBar }}Service(etcdAddrs []string, timeout time.Duration, isPermanent, isLocal bool) {
+func LazyInit{{ .ServiceName_FooBar }}Service(registry lkit_go.Registry, timeout time.Duration, isPermanent, isLocal bool) {
 	lazyInit{{ .ServiceName_FooBar }}ServiceFun = func() {
-	c := New{{ .ServiceName_FooBar }}ServiceInstance(etcdAddrs, timeout, isPermanent, isLocal)
+	c := New{{ .ServiceName_FooBar }}ServiceInstance(registry, timeout, isPermanent, isLocal)
 	{{- if $hasKeyInvoke }}
 	if !isLocal {
 		{{ if $isEnableCHash -}} 
@@ -43,23 +43,87 @@ func LazyInit{{ .ServiceName_FooBar }}Service(etcdAddrs []string, timeout time.D
 {{ $singletonInstance := printf "%s%s%s" "Get" .ServiceName_FooBar "ServiceInstance()" }}
 {{ range $idx, $service := .Services }}
 {{ range $idx1, $method := $service.Methods }}
+{{ if $method.IsStream }}
 {{ if $hasKeyInvoke }}
-// {{ $method.Name }} key为指定
-func {{ $method.Name }}(ctx context.Context, key string, in *{{ $method.InputType }}) (*{{ $method.OutputType }}, error) {
-	ctx = context.WithValue(ctx, "select_key", key)
+// {{ $method.Name }} 流式调用，key为选择节点的key，opts为调用选项，例如lkit_go.WithTimeout设置流的超时时间
+func {{ $method.Name }}(ctx context.Context, key string{{ if $method.IsServerStream }}, in *{{ $method.InputType }}{{ end }}, opts ...lkit_go.CallOption) {{ $method.ServiceResults }} {
+	ctx = lkit_go.WithCallOptions(ctx, append([]lkit_go.CallOption{lkit_go.WithSelectKey(key)}, opts...)...)
+{{- else }}
+// {{ $method.Name }} 流式调用，opts为调用选项，例如lkit_go.WithTimeout设置流的超时时间
+func {{ $method.Name }}({{ $method.ServiceParams }}, opts ...lkit_go.CallOption) {{ $method.ServiceResults }} {
+	if len(opts) > 0 {
+		ctx = lkit_go.WithCallOptions(ctx, opts...)
+	}
+{{- end }}
+	instance := {{ $singletonInstance }}
+	return instance.{{ $method.Name }}(ctx{{ if $method.IsServerStream }}, in{{ end }})
+}
+{{ else if $hasKeyInvoke }}
+// {{ $method.Name }} key为选择节点的key，opts为调用选项，例如lkit_go.WithTimeout
+func {{ $method.Name }}(ctx context.Context, key string, in *{{ $method.InputType }}, opts ...lkit_go.CallOption) (*{{ $method.OutputType }}, error) {
+	ctx = lkit_go.WithCallOptions(ctx, append([]lkit_go.CallOption{lkit_go.WithSelectKey(key)}, opts...)...)
 	instance := {{ $singletonInstance }}
 	res, err := instance.{{ $method.Name }}(ctx, in)
 	handle{{ $serviceFooBar }}CallError("{{ $method.Name }}", in, res, err)
 	return res, err
 }
 {{ else }}
-func {{ $method.Name }}(ctx context.Context, in *{{ $method.InputType }}) (*{{ $method.OutputType }}, error) {
+// {{ $method.Name }} opts为调用选项，例如lkit_go.Broadcast
+func {{ $method.Name }}(ctx context.Context, in *{{ $method.InputType }}, opts ...lkit_go.CallOption) (*{{ $method.OutputType }}, error) {
+	if len(opts) > 0 {
+		ctx = lkit_go.WithCallOptions(ctx, opts...)
+	}
 	instance := {{ $singletonInstance }}
 	res, err := instance.{{ $method.Name }}(ctx, in)
 	handle{{ $serviceFooBar }}CallError("{{ $method.Name }}", in, res, err)
 	return res, err
 }
 {{ end }}
+{{ if not $method.IsStream }}
+// {{ $method.FutureName }} {{ $method.Name }}异步调用的结果
+type {{ $method.FutureName }} struct {
+	*lkit_go.RpcFuture
+}
+
+// Result 等待调用结束，返回回复和错误
+func (f *{{ $method.FutureName }}) Result() (*{{ $method.OutputType }}, error) {
+	err := f.Wait()
+	res, _ := f.Reply.(*{{ $method.OutputType }})
+	return res, err
+}
+
+// {{ $method.Name }}Go 异步调用{{ $method.Name }}，立即返回，参数和{{ $method.Name }}相同
+func {{ $method.Name }}Go(ctx context.Context{{ if $hasKeyInvoke }}, key string{{ end }}, in *{{ $method.InputType }}, opts ...lkit_go.CallOption) *{{ $method.FutureName }} {
+	return &{{ $method.FutureName }}{lkit_go.NewRpcFuture(func() (interface{}, error) {
+		return {{ $method.Name }}(ctx{{ if $hasKeyInvoke }}, key{{ end }}, in, opts...)
+	})}
+}
+
+// {{ $method.Name }}Fork 并发调用服务的所有节点，回复和错误按节点tcp@ip:port保存，单个节点失败不影响其它节点，
+// lkit_go.WithQuorum设置成功节点数达到后返回，本地调试模式只有一个节点"local"
+func {{ $method.Name }}Fork(ctx context.Context, in *{{ $method.InputType }}, opts ...lkit_go.CallOption) (map[string]*{{ $method.OutputType }}, map[string]error, error) {
+	replies := make(map[string]*{{ $method.OutputType }})
+	instance := {{ $singletonInstance }}
+	c, ok := instance.(*{{ $serviceReceiver }})
+	if !ok {
+		res, err := instance.{{ $method.Name }}(lkit_go.WithCallOptions(ctx, opts...), in)
+		if err != nil {
+			return replies, map[string]error{"local": err}, err
+		}
+		replies["local"] = res
+		return replies, map[string]error{}, nil
+	}
+
+	result, err := c.c.Fork(ctx, "{{ $method.Name }}", in, func() interface{} { return new({{ $method.OutputType }}) }, opts...)
+	if result == nil {
+		return nil, nil, err
+	}
+	for node, reply := range result.Replies {
+		replies[node] = reply.(*{{ $method.OutputType }})
+	}
+	return replies, result.Errors, err
+}
+{{ end }}
 {{ end }}
 {{ end }}
 
@@ -15,25 +15,90 @@ type {{ .ServiceInterfaceName }} interface {
 {{ range $idx, $service := .AllServices }}
 type {{ $service.ServiceInterfaceName }} interface {
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}) (*{{ $method.OutputType }}, error)
+{{ $method.Name }}({{ $method.ServiceParams }}) {{ $method.ServiceResults }}
 {{- end -}}
 }
 {{ end }}
 {{ else }}
 {{ range $idx, $service := .AllServices }}
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}) (*{{ $method.OutputType }}, error)
+{{ $method.Name }}({{ $method.ServiceParams }}) {{ $method.ServiceResults }}
 {{- end -}}
 {{ end }}
 }
 {{ end }}
 
+{{ range $idx, $method := .StreamMethods }}
+// {{ $method.StreamClientName }} {{ $method.Name }}流式调用的客户端流，Recv在服务端处理结束后返回io.EOF
+type {{ $method.StreamClientName }} interface {
+{{- if not $method.IsServerStream }}
+	Send(*{{ $method.InputType }}) error
+	CloseSend() error
+{{- end }}
+	Recv() (*{{ $method.OutputType }}, error)
+	Close() error
+}
+
+type {{ $method.StreamClientImpl }} struct {
+	s *lkit_go.JoyStream
+}
+{{ if not $method.IsServerStream }}
+func (x *{{ $method.StreamClientImpl }}) Send(m *{{ $method.InputType }}) error {
+	return x.s.Send(m)
+}
+
+func (x *{{ $method.StreamClientImpl }}) CloseSend() error {
+	return x.s.CloseSend()
+}
+{{ end }}
+func (x *{{ $method.StreamClientImpl }}) Recv() (*{{ $method.OutputType }}, error) {
+	m := new({{ $method.OutputType }})
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *{{ $method.StreamClientImpl }}) Close() error {
+	return x.s.Close()
+}
+
+// {{ $method.StreamServerName }} {{ $method.Name }}流式调用的服务端流，handler返回后流结束
+type {{ $method.StreamServerName }} interface {
+	Send(*{{ $method.OutputType }}) error
+{{- if not $method.IsServerStream }}
+	Recv() (*{{ $method.InputType }}, error)
+{{- end }}
+	Context() context.Context
+}
+
+type {{ $method.StreamServerImpl }} struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *{{ $method.StreamServerImpl }}) Send(m *{{ $method.OutputType }}) error {
+	return x.s.Send(m)
+}
+{{ if not $method.IsServerStream }}
+func (x *{{ $method.StreamServerImpl }}) Recv() (*{{ $method.InputType }}, error) {
+	m := new({{ $method.InputType }})
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+{{ end }}
+func (x *{{ $method.StreamServerImpl }}) Context() context.Context {
+	return x.s.Context()
+}
+{{ end }}
+
 {{ $callServiceName := printf "\"%s\"" .ServiceName_fooBar }}
 {{ $serviceReceiver := printf "%s%s" .ServiceName_fooBar "Service" }}
 // New{{ .ServiceName_FooBar }}Service 创建服务调用
-func New{{ .ServiceName_FooBar }}ServiceInstance(etcdAddrs []string, timeout time.Duration, isPermanent, isLocal bool) {{ .ServiceInterfaceName }} {
+func New{{ .ServiceName_FooBar }}ServiceInstance(registry lkit_go.Registry, timeout time.Duration, isPermanent, isLocal bool) {{ .ServiceInterfaceName }} {
 if !isLocal {
-	c := lkit_go.NewRpcClient({{ $callServiceName }}, etcdAddrs, timeout, isPermanent)
+	c := lkit_go.NewRpcClient({{ $callServiceName }}, registry, timeout, isPermanent)
 	return &{{ $serviceReceiver }} {
 		c: c,
 	} 
@@ -58,25 +123,41 @@ type {{ $serviceReceiver }} struct {
 
 {{ range $idx, $service := .Services }}
 {{ range $idx1, $method := $service.Methods }}
+{{ if $method.IsStream }}
+func (c *{{ $serviceReceiver }}) {{ $method.Name }}({{ $method.ServiceParams }}) {{ $method.ServiceResults }} {
+	s, err := c.c.Stream(ctx, "{{ $method.Name }}")
+	if err != nil {
+		return nil, err
+	}
+{{- if $method.IsServerStream }}
+	err = s.Send(in)
+	if err == nil {
+		err = s.CloseSend()
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+{{- end }}
+	return &{{ $method.StreamClientImpl }}{s: s}, nil
+}
+{{ else }}
 func (c *{{ $serviceReceiver }}) {{ $method.Name }}(ctx context.Context, in *{{ $method.InputType }}) (*{{ $method.OutputType }}, error) {
 	var err error
 
 	var out *{{ $method.OutputType }}
 	// one way模式，消息只发到对端，不关心响应
-	if v := ctx.Value("one_way"); v == nil || !v.(bool) {
+	if !lkit_go.IsOneWay(ctx) {
 		out = new({{ $method.OutputType }})
 	}
 
-	if v := ctx.Value("to_all_nodes"); v != nil && v.(bool) {
-		err = c.c.CallAll(ctx, "{{ $method.Name }}", in, out)
-		return out, err
-	}
-
+	// lkit_go.Broadcast调用选项调用所有节点
 	err = c.c.Call(ctx, "{{ $method.Name }}", in, out)
 	return out, err
 }
 {{ end }}
 {{ end }}
+{{ end }}
 
 // {{ .HandlerInterfaceName }} 服务节点handler接口定义
 type {{ .HandlerInterfaceName }} interface {
@@ -89,14 +170,14 @@ type {{ .HandlerInterfaceName }} interface {
 {{ range $idx, $service := .AllServices }}
 type {{ $service.HandlerInterfaceName }} interface {
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}, *{{ $method.OutputType }}) error
+{{ $method.Name }}({{ $method.HandlerParams }}) error
 {{- end -}}
 }
 {{ end }}
 {{ else }}
 {{ range $idx, $service := .AllServices }}
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}, *{{ $method.OutputType }}) error
+{{ $method.Name }}({{ $method.HandlerParams }}) error
 {{- end -}}
 }
 {{ end }}
@@ -107,19 +188,42 @@ type {{ $service.HandlerInterfaceName }} interface {
 func Register{{ .ServiceName_FooBar }}Handler(s *lkit_go.JoyService, handler {{ .HandlerInterfaceName }}, metadata map[string]string) error {
 // 如果是本地调试函数调用，设置全局handler
 Set{{ .ServiceName_FooBar }}HandlerLocal(handler)
-return s.RegisterOneService({{ $callServiceName }}, handler, metadata)
+var err error
+{{- if .HasUnaryMethods }}
+err = s.RegisterOneService({{ $callServiceName }}, handler, metadata)
+if err != nil {
+	return err
+}
+{{- end }}
+{{- range $idx, $method := .StreamMethods }}
+err = s.RegisterStream({{ $callServiceName }}, "{{ $method.Name }}", func(ctx context.Context, stream *lkit_go.JoyStream) error {
+{{- if $method.IsServerStream }}
+	in := new({{ $method.InputType }})
+	if err := stream.Recv(in); err != nil {
+		return err
+	}
+	return handler.{{ $method.Name }}(ctx, in, &{{ $method.StreamServerImpl }}{s: stream})
+{{- else }}
+	return handler.{{ $method.Name }}(ctx, &{{ $method.StreamServerImpl }}{s: stream})
+{{- end }}
+}, metadata)
+if err != nil {
+	return err
+}
+{{- end }}
+return err
 }
 
 {{ $isEnablePeer := .IsEnableSpecInvokePeer }}
 // New{{ .ServiceName_FooBar }}Handler 创建并注册、运行一个服务
 {{ if $isEnablePeer }}
-func New{{ .ServiceName_FooBar }}Handler(nodeKey, listenAddr, exposeAddr string, etcdAddrs []string, handler {{ .HandlerInterfaceName }}, isLocal bool) (*lkit_go.JoyService, error) {
+func New{{ .ServiceName_FooBar }}Handler(nodeKey, listenAddr, exposeAddr string, registry lkit_go.Registry, handler {{ .HandlerInterfaceName }}, isLocal bool) (*lkit_go.JoyService, error) {
 if !isLocal {
-s, err := lkit_go.NewRpcServiceWithKey(nodeKey, listenAddr, exposeAddr, etcdAddrs)
+s, err := lkit_go.NewRpcServiceWithKey(nodeKey, listenAddr, exposeAddr, registry)
 {{ else }}
-func New{{ .ServiceName_FooBar }}Handler(listenAddr, exposeAddr string, etcdAddrs []string, handler {{ .HandlerInterfaceName }}, isLocal bool) (*lkit_go.JoyService, error) {
+func New{{ .ServiceName_FooBar }}Handler(listenAddr, exposeAddr string, registry lkit_go.Registry, handler {{ .HandlerInterfaceName }}, isLocal bool) (*lkit_go.JoyService, error) {
 if !isLocal {
-s, err := lkit_go.NewRpcService(listenAddr, exposeAddr, etcdAddrs)
+s, err := lkit_go.NewRpcService(listenAddr, exposeAddr, registry)
 {{ end }}
 	if err != nil {
 		return nil, err
@@ -155,10 +259,23 @@ type {{ .ServiceName_fooBar }}ServiceLocal struct {}
 
 {{ range $idx, $service := .AllServices }}
 {{ range $idx1, $method := $service.Methods }}
+{{ if $method.IsStream }}
+func (c *{{ $serviceLocalReceiver }}) {{ $method.Name }}({{ $method.ServiceParams }}) {{ $method.ServiceResults }} {
+cs, ss := lkit_go.NewJoyStreamPipe(ctx)
+go func() {
+{{- if $method.IsServerStream }}
+	ss.Finish({{ $handlerLocalReceiver }}.{{ $method.Name }}(ss.Context(), in, &{{ $method.StreamServerImpl }}{s: ss}))
+{{- else }}
+	ss.Finish({{ $handlerLocalReceiver }}.{{ $method.Name }}(ss.Context(), &{{ $method.StreamServerImpl }}{s: ss}))
+{{- end }}
+}()
+return &{{ $method.StreamClientImpl }}{s: cs}, nil
+}
+{{ else }}
 func (c *{{ $serviceLocalReceiver }}) {{ $method.Name }}(ctx context.Context, in *{{ $method.InputType }}) (*{{ $method.OutputType }}, error) {
 var out *{{ $method.OutputType }}
 var err error
-if v1 := ctx.Value("one_way"); v1 == nil || !v1.(bool) {
+if !lkit_go.IsOneWay(ctx) {
 	out = new({{ $method.OutputType }})
 }
 err = {{ $handlerLocalReceiver }}.{{ $method.Name }}(ctx, in, out)
@@ -166,5 +283,6 @@ return out, err
 }
 {{ end }}
 {{ end }}
+{{ end }}
 
 `
@@ -8,6 +8,9 @@ import (
 	"github.com/golang/protobuf/proto"
 	"math"
 	"context"
+{{- if .StreamMethods }}
+	"github.com/xlkness/lkit-go"
+{{- end }}
 )
 
 // Reference imports to suppress errors if they are not otherwise used.
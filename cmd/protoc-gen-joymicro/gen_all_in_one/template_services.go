@@ -15,19 +15,84 @@ type {{ .ServiceInterfaceName }} interface {
 {{ range $idx, $service := .AllServices }}
 type {{ $service.ServiceInterfaceName }} interface {
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}) (*{{ $method.OutputType }}, error)
+{{ $method.Name }}({{ $method.ServiceParams }}) {{ $method.ServiceResults }}
 {{- end -}}
 }
 {{ end }}
 {{ else }}
 {{ range $idx, $service := .AllServices }}
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}) (*{{ $method.OutputType }}, error)
+{{ $method.Name }}({{ $method.ServiceParams }}) {{ $method.ServiceResults }}
 {{- end -}}
 {{ end }}
 }
 {{ end }}
 
+{{ range $idx, $method := .StreamMethods }}
+// {{ $method.StreamClientName }} {{ $method.Name }}流式调用的客户端流，Recv在服务端处理结束后返回io.EOF
+type {{ $method.StreamClientName }} interface {
+{{- if not $method.IsServerStream }}
+	Send(*{{ $method.InputType }}) error
+	CloseSend() error
+{{- end }}
+	Recv() (*{{ $method.OutputType }}, error)
+	Close() error
+}
+
+type {{ $method.StreamClientImpl }} struct {
+	s *lkit_go.JoyStream
+}
+{{ if not $method.IsServerStream }}
+func (x *{{ $method.StreamClientImpl }}) Send(m *{{ $method.InputType }}) error {
+	return x.s.Send(m)
+}
+
+func (x *{{ $method.StreamClientImpl }}) CloseSend() error {
+	return x.s.CloseSend()
+}
+{{ end }}
+func (x *{{ $method.StreamClientImpl }}) Recv() (*{{ $method.OutputType }}, error) {
+	m := new({{ $method.OutputType }})
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *{{ $method.StreamClientImpl }}) Close() error {
+	return x.s.Close()
+}
+
+// {{ $method.StreamServerName }} {{ $method.Name }}流式调用的服务端流，handler返回后流结束
+type {{ $method.StreamServerName }} interface {
+	Send(*{{ $method.OutputType }}) error
+{{- if not $method.IsServerStream }}
+	Recv() (*{{ $method.InputType }}, error)
+{{- end }}
+	Context() context.Context
+}
+
+type {{ $method.StreamServerImpl }} struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *{{ $method.StreamServerImpl }}) Send(m *{{ $method.OutputType }}) error {
+	return x.s.Send(m)
+}
+{{ if not $method.IsServerStream }}
+func (x *{{ $method.StreamServerImpl }}) Recv() (*{{ $method.InputType }}, error) {
+	m := new({{ $method.InputType }})
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+{{ end }}
+func (x *{{ $method.StreamServerImpl }}) Context() context.Context {
+	return x.s.Context()
+}
+{{ end }}
+
 {{ $callServiceName := printf "\"%s\"" .ServiceName_fooBar }}
 {{ $serviceReceiver := printf "%s%s" .ServiceName_fooBar "Service" }}
 // New{{ .ServiceName_FooBar }}Service 创建服务调用
@@ -47,14 +112,14 @@ type {{ .HandlerInterfaceName }} interface {
 {{ range $idx, $service := .AllServices }}
 type {{ $service.HandlerInterfaceName }} interface {
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}, *{{ $method.OutputType }}) error
+{{ $method.Name }}({{ $method.HandlerParams }}) error
 {{- end -}}
 }
 {{ end }}
 {{ else }}
 {{ range $idx, $service := .AllServices }}
 {{- range $idx1, $method := $service.Methods }}
-{{ $method.Name }}(context.Context, *{{ $method.InputType }}, *{{ $method.OutputType }}) error
+{{ $method.Name }}({{ $method.HandlerParams }}) error
 {{- end -}}
 }
 {{ end }}
@@ -80,6 +145,19 @@ type {{ .ServiceName_fooBar }}ServiceLocal struct {}
 
 {{ range $idx, $service := .AllServices }}
 {{ range $idx1, $method := $service.Methods }}
+{{ if $method.IsStream }}
+func (c *{{ $serviceLocalReceiver }}) {{ $method.Name }}({{ $method.ServiceParams }}) {{ $method.ServiceResults }} {
+cs, ss := lkit_go.NewJoyStreamPipe(ctx)
+go func() {
+{{- if $method.IsServerStream }}
+	ss.Finish({{ $handlerLocalReceiver }}.{{ $method.Name }}(ss.Context(), in, &{{ $method.StreamServerImpl }}{s: ss}))
+{{- else }}
+	ss.Finish({{ $handlerLocalReceiver }}.{{ $method.Name }}(ss.Context(), &{{ $method.StreamServerImpl }}{s: ss}))
+{{- end }}
+}()
+return &{{ $method.StreamClientImpl }}{s: cs}, nil
+}
+{{ else }}
 func (c *{{ $serviceLocalReceiver }}) {{ $method.Name }}(ctx context.Context, in *{{ $method.InputType }}) (*{{ $method.OutputType }}, error) {
 var out *{{ $method.OutputType }} = new({{ $method.OutputType }})
 var err error
@@ -88,5 +166,6 @@ return out, err
 }
 {{ end }}
 {{ end }}
+{{ end }}
 
 `
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/xlkness/lkit-go/cmd/protoc-gen-joymicro/gen"
+	"github.com/xlkness/lkit-go/cmd/protoc-gen-joymicro/gen_all_in_one"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// go test ./cmd/protoc-gen-joymicro/ -update 重新生成testdata下的golden文件
+var update = flag.Bool("update", false, "update golden files")
+
+// helloProto 测试用的proto描述，对应：
+//
+//	syntax = "proto3";
+//	package hello;
+//	// EnablePeer2Peer
+//	// EnableConsistentHash
+//	service Greeter {
+//	  rpc SayHello(HelloRequest) returns (HelloResponse);
+//	  rpc Watch(HelloRequest) returns (stream HelloResponse);
+//	  rpc Upload(stream HelloRequest) returns (HelloResponse);
+//	  rpc Chat(stream HelloRequest) returns (stream HelloResponse);
+//	}
+func helloProto() *descriptorpb.FileDescriptorProto {
+	method := func(name string, clientStream, serverStream bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".hello.HelloRequest"),
+			OutputType:      proto.String(".hello.HelloResponse"),
+			ClientStreaming: proto.Bool(clientStream),
+			ServerStreaming: proto.Bool(serverStream),
+		}
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("proto/hello.proto"),
+		Package: proto.String("hello"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("HelloRequest")},
+			{Name: proto.String("HelloResponse")},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Greeter"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					method("SayHello", false, false),
+					method("Watch", false, true),
+					method("Upload", true, false),
+					method("Chat", true, true),
+				},
+			},
+		},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{6, 0}, LeadingComments: proto.String(" EnablePeer2Peer\n EnableConsistentHash\n")},
+			},
+		},
+	}
+}
+
+func TestGenGolden(t *testing.T) {
+	checkGolden(t, "testdata/gen/hello", gen.GenerateFile(helloProto()))
+}
+
+func TestGenAllInOneGolden(t *testing.T) {
+	checkGolden(t, "testdata/gen_all_in_one/hello", gen_all_in_one.GenerateFile(helloProto()))
+}
+
+// checkGolden 生成的文件和dir下的golden文件比较，再和dir下手写的消息定义一起go vet，
+// 确认生成的代码能编译
+func checkGolden(t *testing.T, dir string, files []*pluginpb.CodeGeneratorResponse_File) {
+	if len(files) == 0 {
+		t.Fatalf("no file generated")
+	}
+	for _, f := range files {
+		golden := filepath.Join(dir, f.GetName())
+		if *update {
+			if err := os.WriteFile(golden, []byte(f.GetContent()), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("read golden file:%v, run with -update to create it", err)
+		}
+		if !bytes.Equal(want, []byte(f.GetContent())) {
+			t.Errorf("%v differs from golden file, run with -update and check the diff:\n%v", f.GetName(), f.GetContent())
+		}
+	}
+
+	out, err := exec.Command("go", "vet", "./"+dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go vet generated code error:%v\n%s", err, out)
+	}
+}
@@ -0,0 +1,377 @@
+// Code generated by protoc-gen-joymicro. DO NOT EDIT.
+// source: hello.proto
+
+package hello
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/xlkness/lkit-go"
+	"math"
+	"time"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+
+var _ = lkit_go.JoyService{}
+
+// GreeterServiceInterface 服务调用接口
+type GreeterServiceInterface interface {
+	SayHello(ctx context.Context, in *HelloRequest) (*HelloResponse, error)
+	Watch(ctx context.Context, in *HelloRequest) (GreeterWatchStreamClient, error)
+	Upload(ctx context.Context) (GreeterUploadStreamClient, error)
+	Chat(ctx context.Context) (GreeterChatStreamClient, error)
+}
+
+// GreeterWatchStreamClient Watch流式调用的客户端流，Recv在服务端处理结束后返回io.EOF
+type GreeterWatchStreamClient interface {
+	Recv() (*HelloResponse, error)
+	Close() error
+}
+
+type greeterWatchStreamClient struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *greeterWatchStreamClient) Recv() (*HelloResponse, error) {
+	m := new(HelloResponse)
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *greeterWatchStreamClient) Close() error {
+	return x.s.Close()
+}
+
+// GreeterWatchStreamServer Watch流式调用的服务端流，handler返回后流结束
+type GreeterWatchStreamServer interface {
+	Send(*HelloResponse) error
+	Context() context.Context
+}
+
+type greeterWatchStreamServer struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *greeterWatchStreamServer) Send(m *HelloResponse) error {
+	return x.s.Send(m)
+}
+
+func (x *greeterWatchStreamServer) Context() context.Context {
+	return x.s.Context()
+}
+
+// GreeterUploadStreamClient Upload流式调用的客户端流，Recv在服务端处理结束后返回io.EOF
+type GreeterUploadStreamClient interface {
+	Send(*HelloRequest) error
+	CloseSend() error
+	Recv() (*HelloResponse, error)
+	Close() error
+}
+
+type greeterUploadStreamClient struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *greeterUploadStreamClient) Send(m *HelloRequest) error {
+	return x.s.Send(m)
+}
+
+func (x *greeterUploadStreamClient) CloseSend() error {
+	return x.s.CloseSend()
+}
+
+func (x *greeterUploadStreamClient) Recv() (*HelloResponse, error) {
+	m := new(HelloResponse)
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *greeterUploadStreamClient) Close() error {
+	return x.s.Close()
+}
+
+// GreeterUploadStreamServer Upload流式调用的服务端流，handler返回后流结束
+type GreeterUploadStreamServer interface {
+	Send(*HelloResponse) error
+	Recv() (*HelloRequest, error)
+	Context() context.Context
+}
+
+type greeterUploadStreamServer struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *greeterUploadStreamServer) Send(m *HelloResponse) error {
+	return x.s.Send(m)
+}
+
+func (x *greeterUploadStreamServer) Recv() (*HelloRequest, error) {
+	m := new(HelloRequest)
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *greeterUploadStreamServer) Context() context.Context {
+	return x.s.Context()
+}
+
+// GreeterChatStreamClient Chat流式调用的客户端流，Recv在服务端处理结束后返回io.EOF
+type GreeterChatStreamClient interface {
+	Send(*HelloRequest) error
+	CloseSend() error
+	Recv() (*HelloResponse, error)
+	Close() error
+}
+
+type greeterChatStreamClient struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *greeterChatStreamClient) Send(m *HelloRequest) error {
+	return x.s.Send(m)
+}
+
+func (x *greeterChatStreamClient) CloseSend() error {
+	return x.s.CloseSend()
+}
+
+func (x *greeterChatStreamClient) Recv() (*HelloResponse, error) {
+	m := new(HelloResponse)
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *greeterChatStreamClient) Close() error {
+	return x.s.Close()
+}
+
+// GreeterChatStreamServer Chat流式调用的服务端流，handler返回后流结束
+type GreeterChatStreamServer interface {
+	Send(*HelloResponse) error
+	Recv() (*HelloRequest, error)
+	Context() context.Context
+}
+
+type greeterChatStreamServer struct {
+	s *lkit_go.JoyStream
+}
+
+func (x *greeterChatStreamServer) Send(m *HelloResponse) error {
+	return x.s.Send(m)
+}
+
+func (x *greeterChatStreamServer) Recv() (*HelloRequest, error) {
+	m := new(HelloRequest)
+	if err := x.s.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (x *greeterChatStreamServer) Context() context.Context {
+	return x.s.Context()
+}
+
+// NewGreeterService 创建服务调用
+func NewGreeterServiceInstance(registry lkit_go.Registry, timeout time.Duration, isPermanent, isLocal bool) GreeterServiceInterface {
+	if !isLocal {
+		c := lkit_go.NewRpcClient("greeter", registry, timeout, isPermanent)
+		return &greeterService{
+			c: c,
+		}
+	}
+
+	// 本地函数调用模式，用于调试
+	return &greeterServiceLocal{}
+}
+
+// SetGreeterServiceSelector 设置调用插件，可以用来监听服务节点变化、按需选择某个节点调用、自定义负载均衡算法等
+func SetGreeterServiceSelector(c GreeterServiceInterface, selector lkit_go.JoySelector) {
+	c1, ok := c.(*greeterService)
+	if ok {
+		c1.c.SetSelector(selector)
+	}
+}
+
+// greeterService 调用服务的远程调用具体实现
+type greeterService struct {
+	c *lkit_go.JoyClient
+}
+
+func (c *greeterService) SayHello(ctx context.Context, in *HelloRequest) (*HelloResponse, error) {
+	var err error
+
+	var out *HelloResponse
+	// one way模式，消息只发到对端，不关心响应
+	if !lkit_go.IsOneWay(ctx) {
+		out = new(HelloResponse)
+	}
+
+	// lkit_go.Broadcast调用选项调用所有节点
+	err = c.c.Call(ctx, "SayHello", in, out)
+	return out, err
+}
+
+func (c *greeterService) Watch(ctx context.Context, in *HelloRequest) (GreeterWatchStreamClient, error) {
+	s, err := c.c.Stream(ctx, "Watch")
+	if err != nil {
+		return nil, err
+	}
+	err = s.Send(in)
+	if err == nil {
+		err = s.CloseSend()
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &greeterWatchStreamClient{s: s}, nil
+}
+
+func (c *greeterService) Upload(ctx context.Context) (GreeterUploadStreamClient, error) {
+	s, err := c.c.Stream(ctx, "Upload")
+	if err != nil {
+		return nil, err
+	}
+	return &greeterUploadStreamClient{s: s}, nil
+}
+
+func (c *greeterService) Chat(ctx context.Context) (GreeterChatStreamClient, error) {
+	s, err := c.c.Stream(ctx, "Chat")
+	if err != nil {
+		return nil, err
+	}
+	return &greeterChatStreamClient{s: s}, nil
+}
+
+// GreeterHandlerInterface 服务节点handler接口定义
+type GreeterHandlerInterface interface {
+	SayHello(context.Context, *HelloRequest, *HelloResponse) error
+	Watch(context.Context, *HelloRequest, GreeterWatchStreamServer) error
+	Upload(context.Context, GreeterUploadStreamServer) error
+	Chat(context.Context, GreeterChatStreamServer) error
+}
+
+// RegisterGreeterHandler 手工给服务注册handler，但必须在s.Run之前调用，metadata是自定义的服务描述信息，会传递给服务调用客户端
+func RegisterGreeterHandler(s *lkit_go.JoyService, handler GreeterHandlerInterface, metadata map[string]string) error {
+	// 如果是本地调试函数调用，设置全局handler
+	SetGreeterHandlerLocal(handler)
+	var err error
+	err = s.RegisterOneService("greeter", handler, metadata)
+	if err != nil {
+		return err
+	}
+	err = s.RegisterStream("greeter", "Watch", func(ctx context.Context, stream *lkit_go.JoyStream) error {
+		in := new(HelloRequest)
+		if err := stream.Recv(in); err != nil {
+			return err
+		}
+		return handler.Watch(ctx, in, &greeterWatchStreamServer{s: stream})
+	}, metadata)
+	if err != nil {
+		return err
+	}
+	err = s.RegisterStream("greeter", "Upload", func(ctx context.Context, stream *lkit_go.JoyStream) error {
+		return handler.Upload(ctx, &greeterUploadStreamServer{s: stream})
+	}, metadata)
+	if err != nil {
+		return err
+	}
+	err = s.RegisterStream("greeter", "Chat", func(ctx context.Context, stream *lkit_go.JoyStream) error {
+		return handler.Chat(ctx, &greeterChatStreamServer{s: stream})
+	}, metadata)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// NewGreeterHandler 创建并注册、运行一个服务
+
+func NewGreeterHandler(nodeKey, listenAddr, exposeAddr string, registry lkit_go.Registry, handler GreeterHandlerInterface, isLocal bool) (*lkit_go.JoyService, error) {
+	if !isLocal {
+		s, err := lkit_go.NewRpcServiceWithKey(nodeKey, listenAddr, exposeAddr, registry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = RegisterGreeterHandler(s, handler, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	// 如果是本地调试函数调用，设置全局handler
+	RegisterGreeterHandler(nil, handler, nil)
+	return nil, nil
+}
+
+// ============================================调试模式变量============================================
+
+var greeterHandlerLocal GreeterHandlerInterface
+
+func SetGreeterHandlerLocal(handler GreeterHandlerInterface) {
+	greeterHandlerLocal = handler
+}
+
+// greeterServiceLocal 本地函数调用，用于调试
+type greeterServiceLocal struct{}
+
+func (c *greeterServiceLocal) SayHello(ctx context.Context, in *HelloRequest) (*HelloResponse, error) {
+	var out *HelloResponse
+	var err error
+	if !lkit_go.IsOneWay(ctx) {
+		out = new(HelloResponse)
+	}
+	err = greeterHandlerLocal.SayHello(ctx, in, out)
+	return out, err
+}
+
+func (c *greeterServiceLocal) Watch(ctx context.Context, in *HelloRequest) (GreeterWatchStreamClient, error) {
+	cs, ss := lkit_go.NewJoyStreamPipe(ctx)
+	go func() {
+		ss.Finish(greeterHandlerLocal.Watch(ss.Context(), in, &greeterWatchStreamServer{s: ss}))
+	}()
+	return &greeterWatchStreamClient{s: cs}, nil
+}
+
+func (c *greeterServiceLocal) Upload(ctx context.Context) (GreeterUploadStreamClient, error) {
+	cs, ss := lkit_go.NewJoyStreamPipe(ctx)
+	go func() {
+		ss.Finish(greeterHandlerLocal.Upload(ss.Context(), &greeterUploadStreamServer{s: ss}))
+	}()
+	return &greeterUploadStreamClient{s: cs}, nil
+}
+
+func (c *greeterServiceLocal) Chat(ctx context.Context) (GreeterChatStreamClient, error) {
+	cs, ss := lkit_go.NewJoyStreamPipe(ctx)
+	go func() {
+		ss.Finish(greeterHandlerLocal.Chat(ss.Context(), &greeterChatStreamServer{s: ss}))
+	}()
+	return &greeterChatStreamClient{s: cs}, nil
+}
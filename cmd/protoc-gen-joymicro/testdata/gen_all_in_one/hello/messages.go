@@ -0,0 +1,19 @@
+package hello
+
+// 手写的消息定义，代替protoc-gen-go生成的hello.pb.go，只用来编译生成的joymicro代码
+
+type HelloRequest struct {
+	Name string
+}
+
+func (m *HelloRequest) Reset()         { *m = HelloRequest{} }
+func (m *HelloRequest) String() string { return m.Name }
+func (*HelloRequest) ProtoMessage()    {}
+
+type HelloResponse struct {
+	Message string
+}
+
+func (m *HelloResponse) Reset()         { *m = HelloResponse{} }
+func (m *HelloResponse) String() string { return m.Message }
+func (*HelloResponse) ProtoMessage()    {}
@@ -1,78 +1,194 @@
 package application
 
 import (
+	"context"
 	"fmt"
 	"github.com/xlkness/lkit-go/internal/joymicro/joyservice"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
 	"github.com/xlkness/lkit-go/internal/log"
 	"github.com/xlkness/lkit-go/internal/web/engine"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultAppDrainTimeout app优雅停止的默认排空超时时间
+var DefaultAppDrainTimeout = time.Second * 15
+
 // Task 不会永久执行的任务，串行用于启动前初始化或者启动后初始化工作，返回error就停止application
 type Task func() error
 
-// Worker 永久执行的工作协程，一旦停止就停止application
-type Worker func() error
+// Worker 永久执行的工作协程，一旦停止就停止application，ctx在app停止时取消，worker需要监听并退出
+type Worker func(ctx context.Context) error
+
+// Job 不会永久执行的任务，且不关心执行结果，不关心执行顺序，例如内存预热等，ctx在app停止时取消
+type Job func(ctx context.Context)
+
+// ShutdownTask app停止时执行的清理任务，例如落地数据、关闭连接等，ctx带有app的排空截止时间
+type ShutdownTask func(ctx context.Context) error
+
+// HealthChecker app自定义健康检查，例如etcd租约、mq连接等，返回error表示不健康
+type HealthChecker func(ctx context.Context) error
 
-// Job 不会永久执行的任务，且不关心执行结果，不关心执行顺序，例如内存预热等
-type Job func()
+// ConfigReloadCallback 起服配置文件热加载成功后的回调，globalBootFile为新解析的配置文件结构体指针
+type ConfigReloadCallback func(globalBootFile interface{}) error
 
 type pair struct {
-	desc string
-	item interface{}
+	desc   string
+	item   interface{}
+	status *itemStatus
+}
+
+func newPair(desc string, item interface{}) pair {
+	return pair{desc, item, newItemStatus()}
 }
 
 // App 受scheduler调度的最小逻辑单元，有独立的启动参数、各种串行、并行任务
 type Application struct {
 	Name            string
 	bootFlag        interface{}
-	initializeTasks []pair // 启动服务前串行执行初始化任务的job
-	services        []pair // rpc服务
-	servers         []pair // web服务
-	postRunTasks    []pair // 启动后串行执行的job
-	postRunWorkers  []pair // 启动后后台永久执行的工作协程，一旦推出就停止application
-	parallelJobs    []pair // 启动services、servers后并行执行的任务，不关心结果，例如内存数据的预热等
+	drainTimeout    time.Duration // 优雅停止的排空超时时间
+	dependencies    []string      // 依赖的app名，依赖的app都就绪后才启动
+	restartPolicy   RestartPolicy // 退出后的重启策略
+	initializeTasks []pair        // 启动服务前串行执行初始化任务的job
+	services        []pair        // rpc服务
+	servers         []pair        // web服务
+	components      []pair        // 通用组件，例如socket服务、kcp监听、mq消费者等
+	postRunTasks    []pair        // 启动后串行执行的job
+	postRunWorkers  []pair        // 启动后后台永久执行的工作协程，一旦推出就停止application
+	parallelJobs    []pair        // 启动services、servers后并行执行的任务，不关心结果，例如内存数据的预热等
+	cronJobs        []pair        // 启动后按cron表达式定时执行的任务
+	shutdownTasks   []pair        // 停止时逆序执行的清理任务
+	reloadCallbacks []pair        // 配置文件热加载回调
+	healthCheckers  []pair        // 自定义健康检查
+
+	registry registry.Registry // 调度器WithSchedulerRegistry设置的注册中心，不为空时代替Registry传入的注册中心
+
+	ctx           context.Context    // 传递给worker、job的上下文
+	cancel        context.CancelFunc // 停止worker、job
+	workersWg     *sync.WaitGroup    // 等待worker、job退出
+	readyChan     chan struct{}      // app启动完毕后关闭
+	readyOnce     *sync.Once
+	stopChan      chan struct{} // 开始停止时关闭
+	stoppedChan   chan struct{} // 停止完毕后关闭
+	stopOnce      *sync.Once
+	isUpgrading   int32 // 热升级停止旧进程时设置，rpc服务不从注册中心注销
+	isStopByAdmin int32 // 通过运维接口停止时设置，不再影响调度器的健康检查、就绪探针
+
+	lock      *sync.Mutex // 保护以下运行状态字段
+	startTime time.Time   // 最近一次运行的开始时间
+	lastError string      // 最近一次运行报错
+	restarts  int         // 已经重启的次数
 }
 
 func newApp(name string, options ...AppOption) *Application {
 	app := new(Application)
 	app.Name = name
+	app.drainTimeout = DefaultAppDrainTimeout
+	app.ctx, app.cancel = context.WithCancel(context.Background())
+	app.workersWg = new(sync.WaitGroup)
+	app.readyChan = make(chan struct{})
+	app.readyOnce = new(sync.Once)
+	app.stopChan = make(chan struct{})
+	app.stoppedChan = make(chan struct{})
+	app.lock = new(sync.Mutex)
+	app.stopOnce = new(sync.Once)
 	app.applyOptions(options...)
 	return app
 }
 
 // WithInitializeTask app完成init之后run之前执行的任务，可以用来初始化某些业务或者检查配置等
 func (app *Application) WithInitializeTask(desc string, task Task) *Application {
-	app.initializeTasks = append(app.initializeTasks, pair{desc, task})
+	app.initializeTasks = append(app.initializeTasks, newPair(desc, task))
 	return app
 }
 
 // WithServer 添加web服务器
 func (app *Application) WithServer(desc string, server *engine.Engine) *Application {
-	app.servers = append(app.servers, pair{desc, server})
+	app.servers = append(app.servers, newPair(desc, server))
 	return app
 }
 
 // WithService 添加rpc服务
 func (app *Application) WithService(desc string, service *joyservice.ServicesManager) *Application {
-	app.services = append(app.services, pair{desc, service})
+	app.services = append(app.services, newPair(desc, service))
 	return app
 }
 
+// Registry 返回app创建rpc服务、客户端实际使用的注册中心，调度器设置了WithSchedulerRegistry时返回设置的注册中心，否则返回r，
+// 例如joyservice.New(listenAddr, exposeAddr, app.Registry(registry.NewEtcdRegistry(addrs)))
+func (app *Application) Registry(r registry.Registry) registry.Registry {
+	if app.registry != nil {
+		return app.registry
+	}
+	return r
+}
+
+// Server 按描述获取添加的web服务器，不存在返回nil
+func (app *Application) Server(desc string) *engine.Engine {
+	for _, s := range app.servers {
+		if s.desc == desc {
+			return s.item.(*engine.Engine)
+		}
+	}
+	return nil
+}
+
+// Service 按描述获取添加的rpc服务，不存在返回nil
+func (app *Application) Service(desc string) *joyservice.ServicesManager {
+	for _, s := range app.services {
+		if s.desc == desc {
+			return s.item.(*joyservice.ServicesManager)
+		}
+	}
+	return nil
+}
+
 // WithPostTask app run之后执行的任务，一般做临时检查任务，可以用来服务启动后加载数据检查等
 func (app *Application) WithPostTask(desc string, task Task) *Application {
-	app.postRunTasks = append(app.postRunTasks, pair{desc, task})
+	app.postRunTasks = append(app.postRunTasks, newPair(desc, task))
 	return app
 }
 
-// WithPostWorker 完成post task之后执行的后台任务，报错退出等app也会退出，一般做永久的关键后台逻辑
+// WithPostWorker 完成post task之后执行的后台任务，报错、panic退出等app也会退出，一般做永久的关键后台逻辑，
+// 需要先重启worker的用WithSupervisedPostWorker
 func (app *Application) WithPostWorker(desc string, worker Worker) *Application {
-	app.postRunWorkers = append(app.postRunWorkers, pair{desc, worker})
-	return app
+	return app.WithSupervisedPostWorker(desc, worker, RestartPolicy{Type: RestartNever})
 }
 
 // WithParallelJob 完成post task之后执行的并行后台任务，一般做永久的不关键后台逻辑，例如内存预热等
 func (app *Application) WithParallelJob(desc string, job Job) *Application {
-	app.parallelJobs = append(app.parallelJobs, pair{desc, job})
+	app.parallelJobs = append(app.parallelJobs, newPair(desc, job))
+	return app
+}
+
+// WithShutdownTask app停止时执行的清理任务，在web服务、rpc服务、后台工作协程都停止后按添加顺序逆序执行
+func (app *Application) WithShutdownTask(desc string, task ShutdownTask) *Application {
+	app.shutdownTasks = append(app.shutdownTasks, newPair(desc, task))
+	return app
+}
+
+// OnConfigReload 注册起服配置文件热加载回调，调度器收到SIGHUP或者etcd配置修改，并且重新解析配置成功后按注册顺序调用
+func (app *Application) OnConfigReload(desc string, callback ConfigReloadCallback) *Application {
+	app.reloadCallbacks = append(app.reloadCallbacks, newPair(desc, callback))
+	return app
+}
+
+// SubscribeBootConfig 以具体的配置结构体类型订阅起服配置的修改(SIGHUP热加载、etcd配置修改)，
+// T为WithSchedulerBootConfigFileContent设置的结构体指针类型，类型不匹配回调不会被调用并打印警告
+func SubscribeBootConfig[T any](app *Application, desc string, callback func(conf T) error) *Application {
+	return app.OnConfigReload(desc, func(globalBootFile interface{}) error {
+		conf, ok := globalBootFile.(T)
+		if !ok {
+			return fmt.Errorf("boot config type %T not match subscribe type %T", globalBootFile, conf)
+		}
+		return callback(conf)
+	})
+}
+
+// WithHealthChecker 添加健康检查，调度器trace server的/healthz、/readyz接口会调用
+func (app *Application) WithHealthChecker(desc string, checker HealthChecker) *Application {
+	app.healthCheckers = append(app.healthCheckers, newPair(desc, checker))
 	return app
 }
 
@@ -83,94 +199,342 @@ func (app *Application) applyOptions(options ...AppOption) *Application {
 	return app
 }
 
+// isReady 初始化任务执行完毕，rpc服务、web服务监听成功，启动后任务执行完毕，并且没有开始停止
+func (app *Application) isReady() bool {
+	if app.isDraining() {
+		return false
+	}
+	select {
+	case <-app.readyChan:
+		return app.isComponentsReady()
+	default:
+		return false
+	}
+}
+
+// isDraining 是否已经开始停止
+func (app *Application) isDraining() bool {
+	if app.stoppedByAdmin() {
+		return true
+	}
+	select {
+	case <-app.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopByAdmin 标记为通过运维接口停止并开始异步停止
+func (app *Application) stopByAdmin() {
+	atomic.StoreInt32(&app.isStopByAdmin, 1)
+	go app.shutdown()
+}
+
+func (app *Application) stoppedByAdmin() bool {
+	return atomic.LoadInt32(&app.isStopByAdmin) == 1
+}
+
+// lifecycleState app生命周期状态：starting|ready|draining|stopped
+func (app *Application) lifecycleState() string {
+	select {
+	case <-app.stoppedChan:
+		return "stopped"
+	default:
+	}
+	if app.isDraining() {
+		return "draining"
+	}
+	if app.isReady() {
+		return "ready"
+	}
+	return "starting"
+}
+
+// checkHealth 执行所有健康检查，返回每个检查的结果描述和是否全部健康
+func (app *Application) checkHealth(ctx context.Context) (map[string]string, bool) {
+	results := make(map[string]string, len(app.healthCheckers)+len(app.components))
+	isHealthy := true
+	for _, j := range app.healthCheckers {
+		// 健康检查panic时报告为不健康，不影响trace server
+		err := app.callSafely("health checker", j.desc, func() error {
+			return j.item.(HealthChecker)(ctx)
+		})
+		if err != nil {
+			results[j.desc] = err.Error()
+			isHealthy = false
+		} else {
+			results[j.desc] = "ok"
+		}
+	}
+	for _, c := range app.components {
+		if c.item.(Component).Ready() {
+			results["component "+c.desc] = "ready"
+		} else {
+			results["component "+c.desc] = "not ready"
+		}
+	}
+	return results, isHealthy
+}
+
+func (app *Application) reloadConfig(globalBootFile interface{}) {
+	for _, j := range app.reloadCallbacks {
+		err := app.callSafely("config reload callback", j.desc, func() error {
+			return j.item.(ConfigReloadCallback)(globalBootFile)
+		})
+		if err != nil {
+			log.Warnf("application[%v] run config reload callback %v return error:%v", app.Name, j.desc, err)
+		}
+	}
+}
+
 func (app *Application) run() (err error) {
 	waitChan := make(chan error, 1)
+	notify := func(err error) {
+		select {
+		case waitChan <- err:
+		default:
+		}
+	}
+
+	select {
+	case <-app.stopChan:
+		return nil
+	default:
+	}
+
+	app.setStartTime(time.Now())
+	defer func() {
+		if err != nil {
+			app.setLastError(err)
+		}
+	}()
+
+	err = app.checkCronJobs()
+	if err != nil {
+		return
+	}
 
 	// 启动前的初始化任务
 	for _, j := range app.initializeTasks {
-		curErr := j.item.(Task)()
+		j.status.start()
+		curErr := app.callSafely("initialize task", j.desc, j.item.(Task))
+		j.status.finish(curErr)
 		if curErr != nil {
 			err = fmt.Errorf("run initialize task(%s) return error:%v", j.desc, curErr)
 			return
 		}
 	}
 
+	// 初始化过程中被停止
+	if app.isDraining() {
+		return nil
+	}
+
 	// 启动rpc服务
-	for _, pair := range app.services {
-		go func(desc string, s *joyservice.ServicesManager) {
-			log.Noticef("app %v service %v will listen on %v", app.Name, desc, s.Addr)
+	for _, p := range app.services {
+		go func(p pair, s *joyservice.ServicesManager) {
+			log.Noticef("app %v service %v will listen on %v", app.Name, p.desc, s.Addr)
+			p.status.start()
 			curErr := s.Run()
+			p.status.finish(curErr)
 			if curErr != nil {
-				waitChan <- fmt.Errorf("service %s run on %v error:%v", desc, s.Addr, err)
-			} else {
-
+				notify(fmt.Errorf("service %s run on %v error:%v", p.desc, s.Addr, curErr))
 			}
-		}(pair.desc, pair.item.(*joyservice.ServicesManager))
+		}(p, p.item.(*joyservice.ServicesManager))
 	}
 
-	defer app.stopServices()
-
 	// 启动web服务
-	for _, pair := range app.servers {
-		go func(desc string, s *engine.Engine) {
-			log.Noticef("app %v server %v will listen on %v", app.Name, desc, s.Addr)
-			err := s.Run()
-			if err != nil {
-				waitChan <- fmt.Errorf("server %s error:%v", desc, err)
-			} else {
+	for _, p := range app.servers {
+		go func(p pair, s *engine.Engine) {
+			log.Noticef("app %v server %v will listen on %v", app.Name, p.desc, s.Addr)
+			p.status.start()
+			curErr := s.Run()
+			p.status.finish(curErr)
+			if curErr != nil {
+				notify(fmt.Errorf("server %s error:%v", p.desc, curErr))
+			}
+		}(p, p.item.(*engine.Engine))
+	}
 
+	// 启动通用组件
+	for _, p := range app.components {
+		app.workersWg.Add(1)
+		go func(p pair, c Component) {
+			defer app.workersWg.Done()
+			log.Noticef("app %v component %v will start", app.Name, p.desc)
+			p.status.start()
+			curErr := app.callSafely("component", p.desc, func() error { return c.Start(app.ctx) })
+			p.status.finish(curErr)
+			if curErr != nil && !app.isDraining() {
+				notify(fmt.Errorf("component %s error:%v", p.desc, curErr))
 			}
-		}(pair.desc, pair.item.(*engine.Engine))
+		}(p, p.item.(Component))
 	}
 
-	defer app.stopServers()
+	// 等待rpc服务、web服务都监听成功，之后才执行启动后任务、报告就绪
+	var bounds []<-chan struct{}
+	for _, p := range app.services {
+		bounds = append(bounds, p.item.(*joyservice.ServicesManager).Bound())
+	}
+	for _, p := range app.servers {
+		bounds = append(bounds, p.item.(*engine.Engine).Bound())
+	}
+	for _, bound := range bounds {
+		select {
+		case <-bound:
+		case err = <-waitChan:
+			return
+		case <-app.stopChan:
+			return nil
+		}
+	}
 
 	// 启动后串行执行的job
 	for _, j := range app.postRunTasks {
-		curErr := j.item.(Task)()
+		j.status.start()
+		curErr := app.callSafely("post task", j.desc, j.item.(Task))
+		j.status.finish(curErr)
 		if curErr != nil {
 			err = fmt.Errorf("run post task %s return error:%v", j.desc, curErr)
 			return
 		}
 	}
 
+	if app.isDraining() {
+		return nil
+	}
+
 	// 启动后串行执行的工作协程
-	for _, pair := range app.postRunWorkers {
-		go func(desc string, g Worker) {
-			curErr := g()
+	for _, p := range app.postRunWorkers {
+		app.workersWg.Add(1)
+		go func(p pair, w *postWorker) {
+			defer app.workersWg.Done()
+			// 停止过程中worker退出属于正常流程
+			curErr := app.superviseWorker(p, w)
 			if curErr != nil {
-				waitChan <- fmt.Errorf("run post worker %s return error:%v", desc, curErr)
+				notify(fmt.Errorf("run post worker %s return error:%v", p.desc, curErr))
+			} else if app.restartPolicy.Type == RestartAlways && !app.isDraining() {
+				// RestartAlways的app在worker正常返回时也退出，由调度器重启
+				log.Warnf("application[%v] post worker %v return, application will exit", app.Name, p.desc)
+				notify(nil)
 			}
-		}(pair.desc, pair.item.(Worker))
+		}(p, p.item.(*postWorker))
 	}
 
 	// 启动后的并行job
 	for _, j := range app.parallelJobs {
-		go j.item.(Job)()
+		app.workersWg.Add(1)
+		go func(p pair, job Job) {
+			defer app.workersWg.Done()
+			p.status.start()
+			curErr := app.callSafely("parallel job", p.desc, func() error {
+				job(app.ctx)
+				return nil
+			})
+			p.status.finish(curErr)
+			if curErr != nil {
+				log.Warnf("application[%v] run parallel job %v error:%v", app.Name, p.desc, curErr)
+			}
+		}(j, j.item.(Job))
+	}
+
+	// 启动定时任务
+	for _, j := range app.cronJobs {
+		app.workersWg.Add(1)
+		go func(p pair, cj *cronJob) {
+			defer app.workersWg.Done()
+			app.runCronJob(p, cj)
+		}(j, j.item.(*cronJob))
 	}
 
 	log.Noticef("application[%v] run ok.", app.Name)
+	app.readyOnce.Do(func() { close(app.readyChan) })
 
 	select {
 	case anyErr := <-waitChan:
-		log.Critif("scheduler stop with execute error:%v", anyErr)
+		if anyErr != nil {
+			log.Critif("application[%v] stop with execute error:%v", app.Name, anyErr)
+		}
 		return anyErr
+	case <-app.stopChan:
+		return nil
 	}
 }
 
-func (app *Application) stop() {
-	app.stopServices()
-	app.stopServers()
+// shutdown 优雅停止app，按通用组件->web服务->rpc服务（先从注册中心注销）->后台工作协程->停止任务的顺序，
+// 整个过程受drainTimeout限制，可以重复调用
+func (app *Application) shutdown() {
+	app.stopOnce.Do(func() {
+		close(app.stopChan)
+
+		ctx, cancel := context.WithTimeout(context.Background(), app.drainTimeout)
+		defer cancel()
+
+		log.Noticef("application[%v] begin graceful shutdown, drain timeout:%v", app.Name, app.drainTimeout)
+
+		app.stopComponents(ctx)
+		app.stopServers(ctx)
+		app.stopServices(ctx)
+		app.stopWorkers(ctx)
+		app.runShutdownTasks(ctx)
+
+		close(app.stoppedChan)
+		log.Noticef("application[%v] shutdown finish", app.Name)
+	})
 }
 
-func (app *Application) stopServers() {
-	for _, s := range app.servers {
-		s.item.(*engine.Engine).Stop()
+func (app *Application) stopServers(ctx context.Context) {
+	for i := len(app.servers) - 1; i >= 0; i-- {
+		s := app.servers[i]
+		err := s.item.(*engine.Engine).Shutdown(ctx)
+		if err != nil {
+			log.Warnf("application[%v] shutdown server %v error:%v", app.Name, s.desc, err)
+		}
 	}
 }
 
-func (app *Application) stopServices() {
-	for _, s := range app.services {
-		s.item.(*joyservice.ServicesManager).Stop()
+func (app *Application) stopServices(ctx context.Context) {
+	for i := len(app.services) - 1; i >= 0; i-- {
+		s := app.services[i]
+		var err error
+		if atomic.LoadInt32(&app.isUpgrading) == 1 {
+			err = s.item.(*joyservice.ServicesManager).ShutdownForUpgrade(ctx)
+		} else {
+			err = s.item.(*joyservice.ServicesManager).Shutdown(ctx)
+		}
+		if err != nil {
+			log.Warnf("application[%v] shutdown service %v error:%v", app.Name, s.desc, err)
+		}
+	}
+}
+
+func (app *Application) stopWorkers(ctx context.Context) {
+	app.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		app.workersWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("application[%v] wait post workers, parallel jobs and cron jobs exit timeout:%v", app.Name, ctx.Err())
+	}
+}
+
+func (app *Application) runShutdownTasks(ctx context.Context) {
+	for i := len(app.shutdownTasks) - 1; i >= 0; i-- {
+		j := app.shutdownTasks[i]
+		j.status.start()
+		err := app.callSafely("shutdown task", j.desc, func() error {
+			return j.item.(ShutdownTask)(ctx)
+		})
+		j.status.finish(err)
+		if err != nil {
+			log.Warnf("application[%v] run shutdown task %v return error:%v", app.Name, j.desc, err)
+		}
 	}
 }
@@ -0,0 +1,145 @@
+package application
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/log"
+	"github.com/xlkness/lkit-go/internal/netcore/kcp"
+	"github.com/xlkness/lkit-go/internal/netcore/socket"
+	"sync"
+	"sync/atomic"
+)
+
+// Component app的通用组件，socket服务、kcp监听、mq消费者、自定义守护进程等实现该接口后，
+// 和web服务、rpc服务一样随app启动、停止，并上报运行状态和就绪状态
+type Component interface {
+	// Name 组件名，用于日志和运维接口
+	Name() string
+	// Start 启动组件，阻塞直到组件退出，Stop后返回nil，app停止前返回error会停止app
+	Start(ctx context.Context) error
+	// Stop 停止组件，ctx带有app的排空截止时间
+	Stop(ctx context.Context) error
+	// Ready 组件是否就绪，所有组件都就绪app才算就绪，/readyz接口会检查
+	Ready() bool
+}
+
+// WithComponent 添加通用组件，在rpc服务、web服务之后启动，停止时先于web服务、rpc服务停止
+func (app *Application) WithComponent(component Component) *Application {
+	app.components = append(app.components, newPair(component.Name(), component))
+	return app
+}
+
+func (app *Application) stopComponents(ctx context.Context) {
+	for i := len(app.components) - 1; i >= 0; i-- {
+		c := app.components[i]
+		err := app.callSafely("component stop", c.desc, func() error {
+			return c.item.(Component).Stop(ctx)
+		})
+		if err != nil {
+			log.Warnf("application[%v] stop component %v error:%v", app.Name, c.desc, err)
+		}
+	}
+}
+
+// isComponentsReady 所有组件是否都就绪
+func (app *Application) isComponentsReady() bool {
+	for _, c := range app.components {
+		if !c.item.(Component).Ready() {
+			return false
+		}
+	}
+	return true
+}
+
+type funcComponent struct {
+	name    string
+	start   func(ctx context.Context) error
+	stop    func(ctx context.Context) error
+	running int32
+}
+
+// NewComponent 用启动、停止函数创建组件，start阻塞运行期间组件为就绪状态
+func NewComponent(name string, start func(ctx context.Context) error, stop func(ctx context.Context) error) Component {
+	return &funcComponent{name: name, start: start, stop: stop}
+}
+
+func (c *funcComponent) Name() string {
+	return c.name
+}
+
+func (c *funcComponent) Start(ctx context.Context) error {
+	atomic.StoreInt32(&c.running, 1)
+	defer atomic.StoreInt32(&c.running, 0)
+	return c.start(ctx)
+}
+
+func (c *funcComponent) Stop(ctx context.Context) error {
+	if c.stop == nil {
+		return nil
+	}
+	return c.stop(ctx)
+}
+
+func (c *funcComponent) Ready() bool {
+	return atomic.LoadInt32(&c.running) == 1
+}
+
+type socketComponent struct {
+	name    string
+	server  socket.Server
+	running int32
+}
+
+// NewSocketServerComponent 把netcore/socket的tcp、websocket服务包装为组件，监听成功后就绪，
+// Start的ctx取消时停止服务
+func NewSocketServerComponent(name string, server socket.Server) Component {
+	return &socketComponent{name: name, server: server}
+}
+
+func (c *socketComponent) Name() string {
+	return c.name
+}
+
+func (c *socketComponent) Start(ctx context.Context) error {
+	atomic.StoreInt32(&c.running, 1)
+	defer atomic.StoreInt32(&c.running, 0)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- c.server.Listen()
+	}()
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		c.server.Stop()
+		return <-errChan
+	}
+}
+
+func (c *socketComponent) Stop(ctx context.Context) error {
+	c.server.Stop()
+	return nil
+}
+
+func (c *socketComponent) Ready() bool {
+	return atomic.LoadInt32(&c.running) == 1 && c.server.Addr() != nil
+}
+
+// NewKcpListenerComponent 把已经开始监听的kcp Listener包装为组件，app停止时关闭监听
+func NewKcpListenerComponent(name string, listener *kcp.Listener) Component {
+	stopChan := make(chan struct{})
+	stopOnce := new(sync.Once)
+	return NewComponent(name, func(ctx context.Context) error {
+		select {
+		case <-stopChan:
+		case <-ctx.Done():
+		}
+		return nil
+	}, func(ctx context.Context) error {
+		stopOnce.Do(func() {
+			listener.Close()
+			close(stopChan)
+		})
+		return nil
+	})
+}
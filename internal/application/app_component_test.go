@@ -0,0 +1,194 @@
+package application
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/netcore/socket"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runTestApp 运行app，返回run的结果
+func runTestApp(app *Application) chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- app.run()
+	}()
+	return done
+}
+
+func waitAppReady(t *testing.T, app *Application) {
+	for i := 0; i < 300 && !app.isReady(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if !app.isReady() {
+		t.Fatalf("application[%v] not ready", app.Name)
+	}
+}
+
+func TestComponentLifecycle(t *testing.T) {
+	lock := new(sync.Mutex)
+	var events []string
+	record := func(event string) {
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}
+	newTestComponent := func(name string) Component {
+		stopChan := make(chan struct{})
+		return NewComponent(name, func(ctx context.Context) error {
+			record("start " + name)
+			<-stopChan
+			return nil
+		}, func(ctx context.Context) error {
+			record("stop " + name)
+			close(stopChan)
+			return nil
+		})
+	}
+
+	app := newApp("game")
+	app.WithComponent(newTestComponent("a")).WithComponent(newTestComponent("b"))
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	app.shutdown()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if app.isComponentsReady() {
+		t.Fatalf("components ready after shutdown")
+	}
+
+	// 逆序停止
+	lock.Lock()
+	defer lock.Unlock()
+	if len(events) != 4 || events[2] != "stop b" || events[3] != "stop a" {
+		t.Fatalf("component events:%v", events)
+	}
+}
+
+// readyComponent 就绪状态由测试控制的组件
+type readyComponent struct {
+	ready int32
+}
+
+func (c *readyComponent) Name() string { return "ready" }
+
+func (c *readyComponent) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (c *readyComponent) Stop(ctx context.Context) error { return nil }
+
+func (c *readyComponent) Ready() bool { return atomic.LoadInt32(&c.ready) == 1 }
+
+func TestComponentNotReady(t *testing.T) {
+	c := new(readyComponent)
+	app := newApp("game").WithComponent(c)
+	done := runTestApp(app)
+	defer func() {
+		app.shutdown()
+		<-done
+	}()
+
+	// app启动完毕但是组件没有就绪，app不就绪
+	<-app.readyChan
+	if app.isReady() {
+		t.Fatalf("application ready before component ready")
+	}
+	atomic.StoreInt32(&c.ready, 1)
+	waitAppReady(t, app)
+}
+
+func TestComponentStartError(t *testing.T) {
+	app := newApp("game").WithComponent(NewComponent("broken", func(ctx context.Context) error {
+		return errTest
+	}, nil))
+	done := runTestApp(app)
+	defer app.shutdown()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "broken") {
+			t.Fatalf("component start error:%v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("application not stop after component error")
+	}
+}
+
+func TestSocketServerComponent(t *testing.T) {
+	server := socket.NewServer("tcp", "127.0.0.1:0", nil, &socket.Option{})
+	app := newApp("game").WithComponent(NewSocketServerComponent("socket", server))
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	app.shutdown()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("socket component not stop")
+	}
+	if app.isComponentsReady() {
+		t.Fatalf("socket component ready after stop")
+	}
+}
+
+func TestSocketServerComponentNotReadyBeforeBind(t *testing.T) {
+	// 地址已经被占用，监听失败，组件不能就绪
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	c := NewSocketServerComponent("socket", socket.NewServer("tcp", ln.Addr().String(), nil, &socket.Option{}))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Start(context.Background())
+	}()
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Fatalf("listen on used address no error")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("socket component not return after listen error")
+	}
+	if c.Ready() {
+		t.Fatalf("socket component ready after listen error")
+	}
+}
+
+func TestSocketServerComponentCtxCancel(t *testing.T) {
+	c := NewSocketServerComponent("socket", socket.NewServer("tcp", "127.0.0.1:0", nil, &socket.Option{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Start(ctx)
+	}()
+	for i := 0; i < 300 && !c.Ready(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if !c.Ready() {
+		t.Fatalf("socket component not ready after listen")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("socket component not stop after ctx cancel")
+	}
+}
@@ -0,0 +1,212 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/log"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// CronJob 定时任务，ctx在app停止时取消
+type CronJob func(ctx context.Context) error
+
+type CronOverlapPolicy int
+
+const (
+	CronOverlapSkip       CronOverlapPolicy = iota // 上次执行还没结束时跳过本次触发，默认策略
+	CronOverlapQueue                               // 上次执行还没结束时排队，结束后依次执行，最多排队DefaultCronJobQueueSize次
+	CronOverlapConcurrent                          // 不管上次执行是否结束都并发执行
+)
+
+var cronOverlapPolicyDesc = map[CronOverlapPolicy]string{
+	CronOverlapSkip:       "skip",
+	CronOverlapQueue:      "queue",
+	CronOverlapConcurrent: "concurrent",
+}
+
+func (p CronOverlapPolicy) String() string {
+	return cronOverlapPolicyDesc[p]
+}
+
+// DefaultCronJobQueueSize CronOverlapQueue策略最多排队的触发次数，超过后丢弃
+var DefaultCronJobQueueSize = 16
+
+// CronJobOption 定时任务选项
+type CronJobOption func(job *cronJob)
+
+// WithCronJobLocation 设置cron表达式的时区，默认本地时区，也可以在表达式前加"CRON_TZ=Asia/Shanghai "，
+// 表达式带有时区前缀时以表达式的时区为准
+func WithCronJobLocation(loc *time.Location) CronJobOption {
+	return func(job *cronJob) {
+		job.location = loc
+	}
+}
+
+// WithCronJobJitter 每次触发随机延迟[0, jitter)再执行，避免多个进程同时执行
+func WithCronJobJitter(jitter time.Duration) CronJobOption {
+	return func(job *cronJob) {
+		job.jitter = jitter
+	}
+}
+
+// WithCronJobOverlapPolicy 设置上次执行还没结束时又触发的处理策略，默认跳过
+func WithCronJobOverlapPolicy(policy CronOverlapPolicy) CronJobOption {
+	return func(job *cronJob) {
+		job.overlap = policy
+	}
+}
+
+type cronJob struct {
+	spec     string
+	job      CronJob
+	schedule *cronSchedule
+	err      error // cron表达式解析错误，app运行时返回
+	location *time.Location
+	jitter   time.Duration
+	overlap  CronOverlapPolicy
+}
+
+var (
+	cronMetricsOnce     = new(sync.Once)
+	cronJobRunCounter   *prom.PromeCounterStatMgr
+	cronJobRunHistogram *prom.PromeHistogramStatMgr
+)
+
+func initCronMetrics() {
+	cronMetricsOnce.Do(func() {
+		cronJobRunCounter = prom.NewCounter("app_cron_job_run_total").InitLabels([]string{"app", "job", "result"})
+		cronJobRunHistogram = prom.NewHistogram("app_cron_job_run_duration_seconds",
+			[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}).InitLabels([]string{"app", "job"})
+	})
+}
+
+// WithCronJob 完成post task之后按cron表达式定时执行的任务，例如每日重置、排行榜结算等，表达式格式见parseCronSpec，
+// 任务报错、panic只记录日志和监控，不会停止app
+func (app *Application) WithCronJob(desc string, spec string, job CronJob, options ...CronJobOption) *Application {
+	cj := &cronJob{spec: spec, job: job}
+	for _, option := range options {
+		option(cj)
+	}
+	cj.schedule, cj.err = parseCronSpec(spec)
+	if cj.err == nil && cj.location != nil && !cj.schedule.hasZone {
+		cj.schedule.location = cj.location
+	}
+	app.cronJobs = append(app.cronJobs, newPair(desc, cj))
+	return app
+}
+
+// checkCronJobs 检查所有定时任务的cron表达式
+func (app *Application) checkCronJobs() error {
+	for _, p := range app.cronJobs {
+		if err := p.item.(*cronJob).err; err != nil {
+			return fmt.Errorf("cron job %v error:%v", p.desc, err)
+		}
+	}
+	return nil
+}
+
+// runCronJob 按cron表达式触发定时任务，直到app停止
+func (app *Application) runCronJob(p pair, cj *cronJob) {
+	initCronMetrics()
+
+	triggerChan := make(chan struct{}, DefaultCronJobQueueSize)
+	if cj.overlap == CronOverlapQueue {
+		app.workersWg.Add(1)
+		go func() {
+			defer app.workersWg.Done()
+			for {
+				select {
+				case <-triggerChan:
+					app.executeCronJob(p, cj)
+				case <-app.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	running := new(sync.Mutex)
+	for {
+		delay, ok := cj.nextDelay(time.Now())
+		if !ok {
+			log.Warnf("application[%v] cron job %v spec %v has no next trigger time", app.Name, p.desc, cj.spec)
+			return
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-app.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		switch cj.overlap {
+		case CronOverlapQueue:
+			select {
+			case triggerChan <- struct{}{}:
+			default:
+				log.Warnf("application[%v] cron job %v queue is full, drop trigger", app.Name, p.desc)
+				cronJobRunCounter.LabelValues(app.Name, p.desc, "dropped").Inc()
+			}
+		case CronOverlapConcurrent:
+			app.workersWg.Add(1)
+			go func() {
+				defer app.workersWg.Done()
+				app.executeCronJob(p, cj)
+			}()
+		default:
+			if !running.TryLock() {
+				log.Warnf("application[%v] cron job %v last run not finish, skip trigger", app.Name, p.desc)
+				cronJobRunCounter.LabelValues(app.Name, p.desc, "skipped").Inc()
+				continue
+			}
+			app.workersWg.Add(1)
+			go func() {
+				defer app.workersWg.Done()
+				defer running.Unlock()
+				app.executeCronJob(p, cj)
+			}()
+		}
+	}
+}
+
+// nextDelay 距离下次触发的时间，加上随机延迟，没有下次触发时间时返回false
+func (cj *cronJob) nextDelay(now time.Time) (time.Duration, bool) {
+	nextTime := cj.schedule.next(now)
+	if nextTime.IsZero() {
+		return 0, false
+	}
+	delay := nextTime.Sub(now)
+	if cj.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(cj.jitter)))
+	}
+	return delay, true
+}
+
+func (app *Application) executeCronJob(p pair, cj *cronJob) {
+	startTime := time.Now()
+	p.status.start()
+
+	isPanic := true
+	err := app.callSafely("cron job", p.desc, func() error {
+		err := cj.job(app.ctx)
+		isPanic = false
+		return err
+	})
+	p.status.finish(err)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+		if isPanic {
+			result = "panic"
+		}
+		log.Warnf("application[%v] cron job %v return error:%v", app.Name, p.desc, err)
+	}
+	cronJobRunCounter.LabelValues(app.Name, p.desc, result).Inc()
+	cronJobRunHistogram.LabelValues(app.Name, p.desc).Observe(time.Since(startTime).Seconds())
+}
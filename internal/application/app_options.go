@@ -1,11 +1,19 @@
 package application
 
+import "time"
+
 // WithAppBootFlag 设置app的起服参数，flags必须为结构体指针！
-// 只支持string/int/int64/bool四种字段类型，例如：
+// 参数值优先级从低到高为：tag默认值 -> 起服配置文件同名配置项 -> 环境变量 -> 命令行，
+// 支持string/bool/整数/浮点数/time.Duration/[]string/map[string]string/encoding.TextUnmarshaler、嵌套结构体，
+// required:"true"要求必须指定，enum:"a|b"限定取值，例如：
 //
 //	type Flags struct {
 //		F1 string `env:"id" desc:"boot id" default:"default value"`
 //	  	F2 int `env:"num" desc:"number" default:"3"`
+//		F3 string `env:"mode" desc:"run mode" default:"dev" enum:"dev|prod"`
+//		Redis struct {
+//			Addr string `env:"addr" desc:"redis addr" required:"true"`
+//		} `env:"redis"`
 //	}
 //	WithAppBootFlag(&Flags{})
 func WithAppBootFlag(flag interface{}) AppOption {
@@ -14,6 +22,27 @@ func WithAppBootFlag(flag interface{}) AppOption {
 	})
 }
 
+// WithAppDrainTimeout 设置app优雅停止的排空超时时间，超时后不再等待处理中的请求、工作协程，默认15秒
+func WithAppDrainTimeout(timeout time.Duration) AppOption {
+	return appOptionFunction(func(app *Application) {
+		app.drainTimeout = timeout
+	})
+}
+
+// WithAppDependsOn 设置app依赖的其它app名，依赖的app都启动完毕后才会启动当前app，停止时先停止当前app
+func WithAppDependsOn(appNames ...string) AppOption {
+	return appOptionFunction(func(app *Application) {
+		app.dependencies = append(app.dependencies, appNames...)
+	})
+}
+
+// WithAppRestartPolicy 设置app退出后的重启策略，默认不重启，app退出就停止整个调度器
+func WithAppRestartPolicy(policy RestartPolicy) AppOption {
+	return appOptionFunction(func(app *Application) {
+		app.restartPolicy = policy
+	})
+}
+
 type AppOption interface {
 	Apply(scd *Application)
 }
@@ -0,0 +1,68 @@
+package application
+
+import "time"
+
+type RestartPolicyType int
+
+const (
+	RestartNever     RestartPolicyType = iota // 不重启，app退出就停止整个调度器，默认策略
+	RestartOnFailure                          // app报错退出时重启，超过最大重启次数停止整个调度器
+	RestartAlways                             // app退出都重启，包括post worker正常返回，不限制重启次数，调度器停止或者主动停止app除外
+)
+
+var restartPolicyTypeDesc = map[RestartPolicyType]string{
+	RestartNever:     "never",
+	RestartOnFailure: "on-failure",
+	RestartAlways:    "always",
+}
+
+func (t RestartPolicyType) String() string {
+	return restartPolicyTypeDesc[t]
+}
+
+// RestartPolicy app的重启策略，重启时会停止旧app，重新调用app的初始化函数创建新app再运行，
+// 重启间隔从InitialBackoff开始指数增长，最大为MaxBackoff，也用于WithSupervisedPostWorker的worker重启
+type RestartPolicy struct {
+	Type           RestartPolicyType
+	MaxRestarts    int           // 最大连续重启次数，0不限制，只对RestartOnFailure生效
+	InitialBackoff time.Duration // 首次重启间隔，默认1秒
+	MaxBackoff     time.Duration // 最大重启间隔，默认1分钟，app稳定运行超过该时间后重置重启次数
+}
+
+func (p *RestartPolicy) shouldRestart(err error, restarts int) bool {
+	switch p.Type {
+	case RestartOnFailure:
+		if err == nil {
+			return false
+		}
+		return p.MaxRestarts <= 0 || restarts < p.MaxRestarts
+	case RestartAlways:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *RestartPolicy) backoff(restarts int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = time.Second
+	}
+	max := p.maxBackoff()
+
+	backoff := initial
+	for i := 0; i < restarts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func (p *RestartPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return time.Minute
+	}
+	return p.MaxBackoff
+}
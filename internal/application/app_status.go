@@ -0,0 +1,134 @@
+package application
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	itemStatePending  = "pending"
+	itemStateRunning  = "running"
+	itemStateFailed   = "failed"
+	itemStateFinished = "finished"
+)
+
+// itemStatus app里task、worker、job等的运行状态，用于admin接口展示
+type itemStatus struct {
+	lock      *sync.Mutex
+	state     string
+	startTime time.Time
+	endTime   time.Time
+	lastError string
+}
+
+type itemStatusInfo struct {
+	Kind      string `json:"kind"`
+	Desc      string `json:"desc"`
+	State     string `json:"state"`
+	StartTime string `json:"start_time,omitempty"`
+	Uptime    string `json:"uptime,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func newItemStatus() *itemStatus {
+	return &itemStatus{lock: new(sync.Mutex), state: itemStatePending}
+}
+
+func (s *itemStatus) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.state = itemStateRunning
+	s.startTime = time.Now()
+	s.endTime = time.Time{}
+}
+
+func (s *itemStatus) finish(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.endTime = time.Now()
+	if err != nil {
+		s.state = itemStateFailed
+		s.lastError = err.Error()
+	} else {
+		s.state = itemStateFinished
+	}
+}
+
+func (s *itemStatus) info(kind, desc string) *itemStatusInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	info := &itemStatusInfo{Kind: kind, Desc: desc, State: s.state, LastError: s.lastError}
+	if !s.startTime.IsZero() {
+		info.StartTime = s.startTime.Format(time.RFC3339)
+		endTime := s.endTime
+		if endTime.IsZero() {
+			endTime = time.Now()
+		}
+		info.Uptime = endTime.Sub(s.startTime).Truncate(time.Second).String()
+	}
+	return info
+}
+
+type appStatusInfo struct {
+	Name          string            `json:"name"`
+	State         string            `json:"state"`
+	StartTime     string            `json:"start_time,omitempty"`
+	Uptime        string            `json:"uptime,omitempty"`
+	Restarts      int               `json:"restarts"`
+	RestartPolicy string            `json:"restart_policy"`
+	Dependencies  []string          `json:"dependencies,omitempty"`
+	LastError     string            `json:"last_error,omitempty"`
+	Items         []*itemStatusInfo `json:"items"`
+}
+
+func (app *Application) setStartTime(t time.Time) {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+	app.startTime = t
+}
+
+func (app *Application) setLastError(err error) {
+	app.lock.Lock()
+	defer app.lock.Unlock()
+	app.lastError = err.Error()
+}
+
+// statusInfo app及其所有task、worker、job的运行状态
+func (app *Application) statusInfo() *appStatusInfo {
+	app.lock.Lock()
+	info := &appStatusInfo{
+		Name:          app.Name,
+		State:         app.lifecycleState(),
+		Restarts:      app.restarts,
+		RestartPolicy: app.restartPolicy.Type.String(),
+		Dependencies:  app.dependencies,
+		LastError:     app.lastError,
+	}
+	if !app.startTime.IsZero() {
+		info.StartTime = app.startTime.Format(time.RFC3339)
+		info.Uptime = time.Since(app.startTime).Truncate(time.Second).String()
+	}
+	app.lock.Unlock()
+
+	groups := []struct {
+		kind  string
+		pairs []pair
+	}{
+		{"initialize_task", app.initializeTasks},
+		{"service", app.services},
+		{"server", app.servers},
+		{"component", app.components},
+		{"post_task", app.postRunTasks},
+		{"post_worker", app.postRunWorkers},
+		{"parallel_job", app.parallelJobs},
+		{"cron_job", app.cronJobs},
+		{"shutdown_task", app.shutdownTasks},
+	}
+	info.Items = make([]*itemStatusInfo, 0)
+	for _, g := range groups {
+		for _, p := range g.pairs {
+			info.Items = append(info.Items, p.status.info(g.kind, p.desc))
+		}
+	}
+	return info
+}
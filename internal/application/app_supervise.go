@@ -0,0 +1,60 @@
+package application
+
+import (
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/log"
+	"time"
+)
+
+type postWorker struct {
+	worker Worker
+	policy RestartPolicy
+}
+
+// WithSupervisedPostWorker 同WithPostWorker，worker报错或panic退出时先按policy指数退避重启，
+// 不再重启时才停止app，RestartAlways策略下worker正常返回也会重启
+func (app *Application) WithSupervisedPostWorker(desc string, worker Worker, policy RestartPolicy) *Application {
+	app.postRunWorkers = append(app.postRunWorkers, newPair(desc, &postWorker{worker: worker, policy: policy}))
+	return app
+}
+
+// callSafely 执行app的task、worker、job等，panic时打印堆栈并转换为error返回，不会导致进程退出
+func (app *Application) callSafely(kind, desc string, f func() error) (err error) {
+	defer log.CatchWithInfoError(fmt.Sprintf("application[%v] %v %v", app.Name, kind, desc), &err)
+	return f()
+}
+
+// superviseWorker 运行worker直到app停止，返回worker最后一次不再重启的报错，app停止过程中worker退出不算报错
+func (app *Application) superviseWorker(p pair, w *postWorker) error {
+	restarts := 0
+	for {
+		startTime := time.Now()
+		p.status.start()
+		err := app.callSafely("post worker", p.desc, func() error { return w.worker(app.ctx) })
+		p.status.finish(err)
+		if app.ctx.Err() != nil {
+			return nil
+		}
+
+		// 稳定运行一段时间后重置重启次数
+		if time.Since(startTime) > w.policy.maxBackoff() {
+			restarts = 0
+		}
+		if !w.policy.shouldRestart(err, restarts) {
+			return err
+		}
+
+		backoff := w.policy.backoff(restarts)
+		restarts++
+		log.Warnf("application[%v] post worker %v exit with error:%v, will restart after %v with policy %v, restart times:%v",
+			app.Name, p.desc, err, backoff, w.policy.Type, restarts)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-app.ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSuperviseWorker(t *testing.T) {
+	app := newApp("supervise")
+	runs := 0
+	app.WithSupervisedPostWorker("panic worker", func(ctx context.Context) error {
+		runs++
+		if runs <= 2 {
+			panic("worker panic")
+		}
+		return nil
+	}, RestartPolicy{Type: RestartOnFailure, MaxRestarts: 3, InitialBackoff: time.Millisecond})
+
+	p := app.postRunWorkers[0]
+	if err := app.superviseWorker(p, p.item.(*postWorker)); err != nil || runs != 3 {
+		t.Fatalf("supervise worker expect restart to success, runs:%v, error:%v", runs, err)
+	}
+
+	runs = 0
+	app.WithPostWorker("never restart", func(ctx context.Context) error {
+		runs++
+		panic("worker panic")
+	})
+	p = app.postRunWorkers[1]
+	if err := app.superviseWorker(p, p.item.(*postWorker)); err == nil || runs != 1 {
+		t.Fatalf("never restart worker expect panic error, runs:%v, error:%v", runs, err)
+	}
+}
+
+func TestHealthCheckerPanic(t *testing.T) {
+	app := newApp("health panic")
+	app.WithHealthChecker("ok checker", func(ctx context.Context) error {
+		return nil
+	})
+	app.WithHealthChecker("panic checker", func(ctx context.Context) error {
+		panic("checker panic")
+	})
+
+	results, isHealthy := app.checkHealth(context.Background())
+	if isHealthy {
+		t.Fatalf("panic health checker should be unhealthy")
+	}
+	if results["ok checker"] != "ok" {
+		t.Fatalf("ok checker result:%v", results["ok checker"])
+	}
+	if results["panic checker"] == "" || results["panic checker"] == "ok" {
+		t.Fatalf("panic checker result:%v", results["panic checker"])
+	}
+}
@@ -0,0 +1,209 @@
+package application
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/xlkness/lkit-go/internal/joymicro/joyservice"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"github.com/xlkness/lkit-go/internal/web/engine"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppReadyAfterBound(t *testing.T) {
+	service, err := joyservice.New("127.0.0.1:0", "127.0.0.1:0", registry.NewMemoryRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.DisableGateway()
+	server := engine.NewEngine("127.0.0.1:0", nil)
+
+	app := newApp("bound")
+	app.WithService("rpc", service).WithServer("http", server)
+	// 启动后任务执行时rpc服务、web服务都已经可以连接
+	app.WithPostTask("dial", func() error {
+		for _, bound := range []<-chan struct{}{service.Bound(), server.Bound()} {
+			select {
+			case <-bound:
+			default:
+				t.Errorf("post task run before listener bound")
+			}
+		}
+		conn, err := net.Dial("tcp", server.ListenAddr())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	app.shutdown()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppBindError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	app := newApp("bind error")
+	app.WithServer("http", engine.NewEngine(ln.Addr().String(), nil))
+	app.WithPostTask("never", func() error {
+		t.Errorf("post task run after bind error")
+		return nil
+	})
+
+	select {
+	case err := <-runTestApp(app):
+		if err == nil {
+			t.Fatalf("bind error should stop app")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("app run not return after bind error")
+	}
+	if app.isReady() {
+		t.Fatalf("app should not be ready after bind error")
+	}
+	app.shutdown()
+}
+
+// canDial 地址是否可以连接
+func canDial(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func TestAppShutdownOrder(t *testing.T) {
+	old := joyservice.DefaultDeregisterWait
+	joyservice.DefaultDeregisterWait = 0
+	defer func() { joyservice.DefaultDeregisterWait = old }()
+
+	lock := new(sync.Mutex)
+	var events []string
+	record := func(event string) {
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceAddr := ln.Addr().String()
+	ln.Close()
+	service, err := joyservice.New(serviceAddr, serviceAddr, registry.NewMemoryRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.DisableGateway()
+	server := engine.NewEngine("127.0.0.1:0", nil)
+
+	app := newApp("shutdown order")
+	// 停止时处理中的请求，web服务等它处理完，这时rpc服务还没有停止
+	requesting := make(chan struct{})
+	server.GetGinEngine().GET("/slow", func(ctx *gin.Context) {
+		close(requesting)
+		<-app.stopChan
+		time.Sleep(time.Millisecond * 100)
+		if !canDial(serviceAddr) {
+			t.Errorf("rpc service stopped before web server drained")
+		}
+		record("server")
+		ctx.String(http.StatusOK, "ok")
+	})
+	componentStop := make(chan struct{})
+	app.WithComponent(NewComponent("component", func(ctx context.Context) error {
+		<-componentStop
+		return nil
+	}, func(ctx context.Context) error {
+		if !canDial(server.ListenAddr()) || !canDial(serviceAddr) {
+			t.Errorf("web server or rpc service stopped before component")
+		}
+		record("component")
+		close(componentStop)
+		return nil
+	}))
+	app.WithServer("http", server).WithService("rpc", service)
+	app.WithPostWorker("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		if canDial(server.ListenAddr()) || canDial(serviceAddr) {
+			t.Errorf("worker stopped before web server and rpc service")
+		}
+		record("worker")
+		return nil
+	})
+	for _, desc := range []string{"a", "b"} {
+		desc := desc
+		app.WithShutdownTask(desc, func(ctx context.Context) error {
+			record("shutdown task " + desc)
+			return nil
+		})
+	}
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	go http.Get("http://" + server.ListenAddr() + "/slow")
+	<-requesting
+	app.shutdown()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// 通用组件->web服务->rpc服务->后台工作协程->停止任务逆序
+	lock.Lock()
+	defer lock.Unlock()
+	expect := []string{"component", "server", "worker", "shutdown task b", "shutdown task a"}
+	if !reflect.DeepEqual(events, expect) {
+		t.Fatalf("shutdown events:%v, expect:%v", events, expect)
+	}
+}
+
+func TestAppShutdownDrainTimeout(t *testing.T) {
+	app := newApp("drain timeout", WithAppDrainTimeout(time.Millisecond*300))
+	block := make(chan struct{})
+	defer close(block)
+	// 不监听ctx的worker，停止时等到排空截止时间后不再等待
+	app.WithPostWorker("stuck", func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+	taskRun := make(chan error, 1)
+	app.WithShutdownTask("task", func(ctx context.Context) error {
+		taskRun <- ctx.Err()
+		return nil
+	})
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	start := time.Now()
+	app.shutdown()
+	if cost := time.Since(start); cost < time.Millisecond*300 || cost > time.Second*2 {
+		t.Fatalf("shutdown with stuck worker cost:%v", cost)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// 停止任务仍然执行，ctx已经超过排空截止时间
+	select {
+	case err := <-taskRun:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("shutdown task ctx error:%v", err)
+		}
+	default:
+		t.Fatalf("shutdown task not run after drain timeout")
+	}
+}
@@ -0,0 +1,215 @@
+package application
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule 解析后的cron表达式，每个字段用位图表示允许的取值
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	domStar, dowStar                      bool          // 日、星期字段为*时另一个字段单独生效，都不为*时满足其一即可
+	every                                 time.Duration // @every固定间隔，不为0时忽略其它字段
+	location                              *time.Location
+	hasZone                               bool // 表达式带有CRON_TZ=前缀
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSecondField = cronField{0, 59, nil}
+	cronMinuteField = cronField{0, 59, nil}
+	cronHourField   = cronField{0, 23, nil}
+	cronDomField    = cronField{1, 31, nil}
+	cronMonthField  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDowField = cronField{0, 6, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// parseCronSpec 解析cron表达式，支持：
+// 5个字段"分 时 日 月 星期"，6个字段"秒 分 时 日 月 星期"，字段支持*、a-b、*/n、a-b/n、a,b、月份和星期的英文缩写；
+// @yearly、@monthly、@weekly、@daily、@hourly、@every 1h30m；
+// 前缀"CRON_TZ=Asia/Shanghai "指定时区，默认本地时区
+func parseCronSpec(spec string) (*cronSchedule, error) {
+	schedule := &cronSchedule{location: time.Local}
+
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.Index(spec, " ")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid cron spec %v, missing expression after timezone", spec)
+		}
+		tz := spec[strings.Index(spec, "=")+1 : i]
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron spec %v timezone %v error:%v", spec, tz, err)
+		}
+		schedule.location = loc
+		schedule.hasZone = true
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron spec %v error:%v", spec, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("invalid cron spec %v, every duration must >= 1s", spec)
+		}
+		schedule.every = every
+		return schedule, nil
+	}
+	if descriptor, find := cronDescriptors[spec]; find {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron spec %v, must be 5 or 6 fields", spec)
+	}
+
+	var err error
+	values := []*uint64{&schedule.second, &schedule.minute, &schedule.hour, &schedule.dom, &schedule.month, &schedule.dow}
+	defines := []cronField{cronSecondField, cronMinuteField, cronHourField, cronDomField, cronMonthField, cronDowField}
+	for i, field := range fields {
+		*values[i], err = defines[i].parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron spec %v field %v error:%v", spec, field, err)
+		}
+	}
+	schedule.domStar = fields[3] == "*" || fields[3] == "?"
+	schedule.dowStar = fields[5] == "*" || fields[5] == "?"
+	return schedule, nil
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeStr, step := item, 1
+		hasStep := strings.Contains(item, "/")
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rangeStr = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %v", item[i+1:])
+			}
+		}
+
+		start, end := f.min, f.max
+		if rangeStr != "*" && rangeStr != "?" {
+			bounds := strings.SplitN(rangeStr, "-", 2)
+			var err error
+			start, err = f.value(bounds[0])
+			if err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				end, err = f.value(bounds[1])
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// a/n表示从a开始到最大值每隔n
+				end = f.max
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid range %v", rangeStr)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	v, find := f.names[strings.ToLower(s)]
+	if !find {
+		var err error
+		v, err = strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %v", s)
+		}
+	}
+	// 星期天也可以写作7
+	if f.max == 6 && v == 7 {
+		v = 0
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %v out of range [%v,%v]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// next 返回t之后下一次触发的时间，5年内没有可触发的时间返回零值
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every).Truncate(time.Second)
+	}
+
+	origin := t.Location()
+	t = t.In(s.location).Add(time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.dayMatch(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if s.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t.In(origin)
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatch(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
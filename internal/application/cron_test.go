@@ -0,0 +1,234 @@
+package application
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	from := time.Date(2024, 2, 28, 23, 59, 30, 500, shanghai)
+
+	cases := []struct {
+		spec   string
+		expect time.Time
+	}{
+		{"CRON_TZ=Asia/Shanghai 0 0 * * *", time.Date(2024, 2, 29, 0, 0, 0, 0, shanghai)},
+		{"CRON_TZ=Asia/Shanghai */15 * * * * *", time.Date(2024, 2, 28, 23, 59, 45, 0, shanghai)},
+		{"CRON_TZ=Asia/Shanghai 30 4 1,15 * *", time.Date(2024, 3, 1, 4, 30, 0, 0, shanghai)},
+		{"CRON_TZ=Asia/Shanghai 0 5 * * mon-fri", time.Date(2024, 2, 29, 5, 0, 0, 0, shanghai)},
+		{"CRON_TZ=Asia/Shanghai 0 0 * * 0", time.Date(2024, 3, 3, 0, 0, 0, 0, shanghai)},
+		{"CRON_TZ=Asia/Shanghai 0 0 31 feb *", time.Time{}},
+		{"CRON_TZ=UTC @daily", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2024, 2, 29, 0, 1, 0, 0, shanghai)},
+	}
+	for _, c := range cases {
+		s, err := parseCronSpec(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := s.next(from); !next.Equal(c.expect) {
+			t.Fatalf("cron spec %v next expect %v, got %v", c.spec, c.expect, next)
+		}
+	}
+
+	for _, spec := range []string{"* * *", "60 * * * *", "0 0 * * 8", "0 0 5-1 * *", "*/0 * * * *", "@every 1ms", "CRON_TZ=Mars/Base @daily"} {
+		if _, err := parseCronSpec(spec); err == nil {
+			t.Fatalf("invalid cron spec %v expect error", spec)
+		}
+	}
+}
+
+func TestCronJobLocation(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	app := newApp("cron location")
+	app.WithCronJob("option", "0 0 * * *", nil, WithCronJobLocation(shanghai))
+	app.WithCronJob("spec zone", "CRON_TZ=UTC 0 0 * * *", nil, WithCronJobLocation(shanghai))
+
+	// 表达式没有时区时用选项的时区，表达式带有时区时以表达式为准
+	if loc := app.cronJobs[0].item.(*cronJob).schedule.location; loc != shanghai {
+		t.Fatalf("cron job location expect %v, got %v", shanghai, loc)
+	}
+	if loc := app.cronJobs[1].item.(*cronJob).schedule.location; loc != time.UTC {
+		t.Fatalf("cron job spec zone expect UTC, got %v", loc)
+	}
+}
+
+func TestCronJobJitter(t *testing.T) {
+	app := newApp("cron jitter")
+	app.WithCronJob("jitter", "@every 10s", nil, WithCronJobJitter(time.Second))
+	cj := app.cronJobs[0].item.(*cronJob)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		delay, ok := cj.nextDelay(now)
+		if !ok || delay < time.Second*10 || delay >= time.Second*11 {
+			t.Fatalf("cron job jitter delay:%v", delay)
+		}
+		delays[delay] = true
+	}
+	if len(delays) < 2 {
+		t.Fatalf("cron job jitter delay is not random")
+	}
+}
+
+// cronJobCounter 返回从调用时开始统计的任务执行次数
+func cronJobCounter(app *Application, job string) func(result string) float64 {
+	initCronMetrics()
+	count := func(result string) float64 {
+		return testutil.ToFloat64(cronJobRunCounter.LabelValues(app.Name, job, result))
+	}
+	before := make(map[string]float64)
+	for _, result := range []string{"ok", "error", "panic", "skipped", "dropped"} {
+		before[result] = count(result)
+	}
+	return func(result string) float64 {
+		return count(result) - before[result]
+	}
+}
+
+// waitCronJob 等待cond成立，最多等待timeout
+func waitCronJob(timeout time.Duration, cond func() bool) bool {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func TestCronJobOverlapSkip(t *testing.T) {
+	app := newApp("cron skip")
+	var runs int32
+	app.WithCronJob("block", "@every 1s", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		<-ctx.Done()
+		return nil
+	})
+	counter := cronJobCounter(app, "block")
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	// 第一次执行阻塞，之后的触发跳过
+	if !waitCronJob(time.Second*4, func() bool { return counter("skipped") >= 1 }) {
+		t.Fatalf("cron job trigger not skipped")
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("skip policy cron job run %v times", n)
+	}
+
+	// app停止时取消ctx，执行中的任务正常结束
+	app.shutdown()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := counter("ok"); n != 1 {
+		t.Fatalf("cron job finish %v times after app stop", n)
+	}
+}
+
+func TestCronJobOverlapQueue(t *testing.T) {
+	old := DefaultCronJobQueueSize
+	DefaultCronJobQueueSize = 1
+	defer func() { DefaultCronJobQueueSize = old }()
+
+	app := newApp("cron queue")
+	release := make(chan struct{})
+	var runs int32
+	app.WithCronJob("block", "@every 1s", func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			<-release
+		}
+		return nil
+	}, WithCronJobOverlapPolicy(CronOverlapQueue))
+	counter := cronJobCounter(app, "block")
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	// 第一次执行阻塞，第二次触发排队，队列满后丢弃
+	if !waitCronJob(time.Second*5, func() bool { return counter("dropped") >= 1 }) {
+		t.Fatalf("cron job trigger not dropped when queue is full")
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("queue policy cron job run %v times while blocked", n)
+	}
+
+	// 阻塞结束后依次执行排队的触发
+	close(release)
+	if !waitCronJob(time.Second, func() bool { return atomic.LoadInt32(&runs) >= 2 }) {
+		t.Fatalf("queued cron job trigger not run")
+	}
+
+	app.shutdown()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCronJobOverlapConcurrent(t *testing.T) {
+	app := newApp("cron concurrent")
+	var runs int32
+	app.WithCronJob("block", "@every 1s", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		<-ctx.Done()
+		return nil
+	}, WithCronJobOverlapPolicy(CronOverlapConcurrent))
+	counter := cronJobCounter(app, "block")
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	// 上次执行阻塞时仍然并发执行
+	if !waitCronJob(time.Second*4, func() bool { return atomic.LoadInt32(&runs) >= 2 }) {
+		t.Fatalf("concurrent policy cron job run %v times", atomic.LoadInt32(&runs))
+	}
+	if n := counter("skipped"); n != 0 {
+		t.Fatalf("concurrent policy cron job skipped %v times", n)
+	}
+
+	app.shutdown()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := counter("ok"); n != float64(atomic.LoadInt32(&runs)) {
+		t.Fatalf("cron job finish %v times after app stop, runs:%v", n, atomic.LoadInt32(&runs))
+	}
+}
+
+func TestCronJobPanic(t *testing.T) {
+	app := newApp("cron panic")
+	app.WithCronJob("panic", "@every 1s", func(ctx context.Context) error {
+		panic("cron job panic")
+	})
+	counter := cronJobCounter(app, "panic")
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	// panic只记录监控，app继续运行，之后的触发继续执行
+	if !waitCronJob(time.Second*4, func() bool { return counter("panic") >= 2 }) {
+		t.Fatalf("cron job panic not recorded, panics:%v", counter("panic"))
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("app stop after cron job panic:%v", err)
+	default:
+	}
+	if !app.isReady() {
+		t.Fatalf("app not ready after cron job panic")
+	}
+
+	app.shutdown()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,9 +1,11 @@
 package application
 
 import (
+	"context"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/xlkness/lkit-go/internal/flags"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
 	"github.com/xlkness/lkit-go/internal/libsyscal"
 	"github.com/xlkness/lkit-go/internal/log"
 	"github.com/xlkness/lkit-go/internal/log/handler"
@@ -15,24 +17,74 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
 // Scheduler 调度器，调度多个app
 type Scheduler struct {
 	globalBootFlag              *CommBootFlag                          // app全局启动参数
 	globalBootConfigFileContent interface{}                            // app全局配置文件内容结构体指针，为空没有配置文件解析
-	globalBootConfigParser      func(in []byte, out interface{}) error // 配置文件解析函数，默认yaml
+	globalBootConfigParser      func(in []byte, out interface{}) error // 配置文件解析函数，默认.toml按toml解析，其它(包括.json)按yaml解析
 	defaultLogLevel             log.LogLevel                           // 默认debug日志等级，优先用globalBootFlag指定的日志等级
 	adis                        []*ApplicationDescInfo
-	apps                        []*Application // 可绑定多个app
-	server                      *engine.Engine // app全局的web服务，当前暂时一个，为prometheus、pprof共用
+	apps                        []*Application // 可绑定多个app，按依赖关系排序，重启时会替换为新创建的app
+	appsLock                    *sync.Mutex
+	appsReplaced                chan struct{}   // app重启替换为新app时关闭并重新创建，通知等待旧app就绪的协程
+	appsStoppedByAdmin          map[string]bool // 通过运维接口停止的app名，重启重新创建app时仍然有效，appsLock保护
+	isStopping                  bool
+	stopChan                    chan struct{}
+	server                      *engine.Engine            // app全局的web服务，当前暂时一个，为prometheus、pprof共用
+	stopHolmes                  func()                    // 停止initialize启动的holmes dump，Stop时调用
+	bootConfigFileContent       atomic.Value              // 当前生效的配置文件内容，SIGHUP热加载、etcd配置修改时整体替换
+	bootConfigLock              *sync.Mutex               // 串行化SIGHUP热加载和etcd配置修改
+	etcdConfig                  *etcdConfig               // 不为空从etcd读取起服配置，代替BootConfigFile
+	supervisorChildren          []*supervisorChildProcess // 不为空以监督模式运行，父进程只管理子进程，app在子进程运行
+	supervisorPolicy            RestartPolicy             // 监督模式子进程的重启策略
+	bootArgs                    []string                  // 代替os.Args[1:]解析的启动参数，isBootArgsInjected时生效
+	bootEnv                     map[string]string         // 代替进程环境变量解析的启动参数
+	isBootArgsInjected          bool
+	bootConfigContent           *memoryBootConfig // 不为空使用内存里的起服配置，代替BootConfigFile
+	signals                     <-chan os.Signal  // 不为空从这里接收退出、SIGHUP、SIGUSR2信号，不监听进程信号
+	registry                    registry.Registry // 不为空代替app通过Registry获取的注册中心
+	initializedChan             chan struct{}     // 所有app初始化完毕开始运行后关闭
+}
+
+// memoryBootConfig 内存里的起服配置，name后缀决定默认解析格式
+type memoryBootConfig struct {
+	name    string
+	content []byte
+}
+
+// BootConfigLogLevel 配置文件结构体实现该接口时，SIGHUP热加载会用返回的日志等级覆盖当前日志等级
+type BootConfigLogLevel interface {
+	GetLogLevel() string
+}
+
+// BootConfigValidator 配置文件结构体实现该接口时，起服、热加载、etcd配置修改解析后都会先校验，
+// 热加载、etcd配置修改校验失败保留旧配置，不会推送给app
+type BootConfigValidator interface {
+	Validate() error
 }
 
 // NewScheduler
 func NewScheduler(appOptions ...SchedulerOption) *Scheduler {
 	scd := new(Scheduler)
 	scd.globalBootFlag = CommonBootFlag
+	scd.appsLock = new(sync.Mutex)
+	scd.appsReplaced = make(chan struct{})
+	scd.appsStoppedByAdmin = make(map[string]bool)
+	scd.bootConfigLock = new(sync.Mutex)
+	scd.supervisorPolicy = DefaultSupervisorRestartPolicy
+	scd.stopChan = make(chan struct{})
+	scd.initializedChan = make(chan struct{})
 	scd.applyOptions(appOptions...)
 	return scd
 }
@@ -51,6 +103,11 @@ func (scd *Scheduler) Run() error {
 		return err
 	}
 
+	// 监督模式父进程只管理子进程
+	if scd.isSupervisor() {
+		return scd.runSupervisor()
+	}
+
 	err = scd.initApps()
 	if err != nil {
 		return err
@@ -62,7 +119,9 @@ func (scd *Scheduler) Run() error {
 		scd  *Application
 		err  error
 	}
-	waitChan := make(chan waitInfo, 1)
+	waitChan := make(chan waitInfo, len(scd.apps)+1)
+
+	close(scd.initializedChan)
 
 	// 运行trace server
 	go func() {
@@ -73,34 +132,237 @@ func (scd *Scheduler) Run() error {
 		}
 	}()
 
-	for _, app := range scd.apps {
-		go func(app *Application) {
-			err := app.run()
+	for i := range scd.apps {
+		go func(idx int) {
+			app, err := scd.runApp(idx)
 			if err != nil {
 				// 返回调度器的报错
 				waitChan <- waitInfo{app.Name, app, err}
 			}
-		}(app)
+		}(i)
 	}
 
-	watchSignChan := libsyscal.WatchSignal1()
+	// 监听etcd里的起服配置修改
+	if scd.etcdConfig != nil {
+		go scd.watchEtcdConfig()
+	}
+
+	// 热升级启动的新进程就绪后通知旧进程
+	go scd.notifyUpgradeReady()
+
+	watchSignChan, reloadSignChan, upgradeSignChan := scd.watchSignals()
 
 	defer scd.Stop()
 
+	// 热升级要等新进程就绪，在协程里执行，期间继续处理退出、热加载信号，同时只进行一次热升级
+	upgradeDoneChan := make(chan error, 1)
+	isUpgradeInProgress := false
+
+	for {
+		select {
+		case signal := <-watchSignChan:
+			log.Noticef("Application receive signal(%v), will graceful stop", signal)
+			return nil
+		case <-scd.stopChan:
+			return nil
+		case signal := <-reloadSignChan:
+			log.Noticef("Application receive signal(%v), will reload boot config", signal)
+			err := scd.Reload()
+			if err != nil {
+				log.Errorf("reload boot config error:%v", err)
+			}
+		case signal := <-upgradeSignChan:
+			if isUpgradeInProgress {
+				log.Warnf("Application receive signal(%v), upgrade is in progress, ignore", signal)
+				continue
+			}
+			log.Noticef("Application receive signal(%v), will upgrade", signal)
+			isUpgradeInProgress = true
+			go func() {
+				upgradeDoneChan <- scd.Upgrade()
+			}()
+		case err := <-upgradeDoneChan:
+			isUpgradeInProgress = false
+			if err != nil {
+				log.Errorf("upgrade error:%v, old process continue serving", err)
+				continue
+			}
+			scd.markUpgrading()
+			return nil
+		case errInfo := <-waitChan:
+			err := fmt.Errorf("Application receive scheduler(%v) stop with error:%v", errInfo.desc, errInfo.err)
+			log.Errorf(err.Error())
+			return err
+		}
+	}
+}
+
+// watchSignals 返回退出、SIGHUP、SIGUSR2信号的chan，设置了WithSchedulerSignals时从注入的chan分发，不监听进程信号
+func (scd *Scheduler) watchSignals() (<-chan os.Signal, <-chan os.Signal, <-chan os.Signal) {
+	if scd.signals == nil {
+		return libsyscal.WatchSignal1(), libsyscal.WatchReloadSignal(), libsyscal.WatchUpgradeSignal()
+	}
+
+	watchSignChan := make(chan os.Signal, 1)
+	reloadSignChan := make(chan os.Signal, 1)
+	upgradeSignChan := make(chan os.Signal, 1)
+	go func() {
+		for {
+			select {
+			case signal := <-scd.signals:
+				c := watchSignChan
+				switch signal {
+				case syscall.SIGHUP:
+					c = reloadSignChan
+				case libsyscal.UpgradeSignal:
+					c = upgradeSignChan
+				}
+				select {
+				case c <- signal:
+				case <-scd.stopChan:
+					return
+				}
+			case <-scd.stopChan:
+				return
+			}
+		}
+	}()
+	return watchSignChan, reloadSignChan, upgradeSignChan
+}
+
+// WaitReady 等待所有app初始化完毕并且就绪，ctx超时返回还没就绪的app
+func (scd *Scheduler) WaitReady(ctx context.Context) error {
 	select {
-	case signal := <-watchSignChan:
-		log.Noticef("Application receive signal(%v), will graceful stop", signal)
-		return nil
-	case errInfo := <-waitChan:
-		err := fmt.Errorf("Application receive scheduler(%v) stop with error:%v", errInfo.desc, errInfo.err)
-		log.Errorf(err.Error())
+	case <-scd.initializedChan:
+	case <-scd.stopChan:
+		return fmt.Errorf("scheduler is stopping")
+	case <-ctx.Done():
+		return fmt.Errorf("wait applications initialize error:%v", ctx.Err())
+	}
+
+	ticker := time.NewTicker(time.Millisecond * 10)
+	defer ticker.Stop()
+	for {
+		var notReadyApps []string
+		for _, app := range scd.getApps() {
+			if !app.isReady() {
+				notReadyApps = append(notReadyApps, app.Name)
+			}
+		}
+		if len(notReadyApps) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-scd.stopChan:
+			return fmt.Errorf("scheduler is stopping")
+		case <-ctx.Done():
+			return fmt.Errorf("wait applications %v ready error:%v", notReadyApps, ctx.Err())
+		}
+	}
+}
+
+// App 按名字获取当前运行的app，重启后返回新的app，不存在返回nil
+func (scd *Scheduler) App(name string) *Application {
+	for _, app := range scd.getApps() {
+		if app.Name == name {
+			return app
+		}
+	}
+	return nil
+}
+
+// TraceServer 获取prometheus、pprof、k8s探针、运维接口共用的web服务
+func (scd *Scheduler) TraceServer() *engine.Engine {
+	return scd.server
+}
+
+// Reload 重新读取并解析起服配置文件(或etcd配置)，解析、校验成功后整体替换当前配置、重设日志等级，
+// 再依次调用各个app注册的配置重载回调，失败保留旧配置
+func (scd *Scheduler) Reload() error {
+	var content []byte
+	if scd.globalBootConfigFileContent != nil && scd.hasBootConfig() {
+		var err error
+		content, err = scd.loadBootConfigContent()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := scd.applyBootConfigContent(content)
+	if err != nil {
 		return err
 	}
+
+	log.Noticef("reload boot config %v ok", scd.bootConfigSource())
+	return nil
+}
+
+// applyBootConfigContent 解析、校验新的起服配置内容，成功后整体替换当前配置、重设日志等级，再推送给各个app，
+// content为空只重设日志等级、推送当前配置
+func (scd *Scheduler) applyBootConfigContent(content []byte) error {
+	scd.bootConfigLock.Lock()
+	defer scd.bootConfigLock.Unlock()
+
+	if scd.globalBootConfigFileContent != nil && content != nil {
+		to := reflect.TypeOf(scd.globalBootConfigFileContent)
+		if to.Kind() != reflect.Ptr {
+			return fmt.Errorf("boot config file content must be pointer, not %v", to)
+		}
+
+		newContent := reflect.New(to.Elem()).Interface()
+		err := scd.parseBootConfigContent(content, newContent)
+		if err != nil {
+			return err
+		}
+		scd.bootConfigFileContent.Store(newContent)
+	}
+
+	scd.applyLogLevel()
+
+	bootConfig := scd.BootConfigFileContent()
+	for _, app := range scd.getApps() {
+		app.reloadConfig(bootConfig)
+	}
+	return nil
+}
+
+// BootConfigFileContent 获取当前生效的起服配置文件内容，热加载后返回的是新的结构体指针
+func (scd *Scheduler) BootConfigFileContent() interface{} {
+	content := scd.bootConfigFileContent.Load()
+	if content == nil {
+		return scd.globalBootConfigFileContent
+	}
+	return content
 }
 
+// Stop 按app启动顺序逆序优雅停止所有app，最后停止trace server
 func (scd *Scheduler) Stop() {
-	for _, app := range scd.apps {
-		app.stop()
+	scd.appsLock.Lock()
+	if !scd.isStopping {
+		scd.isStopping = true
+		close(scd.stopChan)
+	}
+	apps := append([]*Application{}, scd.apps...)
+	scd.appsLock.Unlock()
+
+	for i := len(apps) - 1; i >= 0; i-- {
+		apps[i].shutdown()
+	}
+
+	if scd.server != nil {
+		ctx, f := context.WithTimeout(context.Background(), time.Second*5)
+		defer f()
+		scd.server.Shutdown(ctx)
+	}
+
+	if scd.stopHolmes != nil {
+		scd.stopHolmes()
+	}
+
+	if scd.etcdConfig != nil {
+		scd.etcdConfig.close()
 	}
 }
 
@@ -115,6 +377,7 @@ func (scd *Scheduler) initialize() error {
 	var schedulerBootFlags []interface{}
 	for _, v := range scd.adis {
 		curApp := newApp(v.name, v.options...)
+		curApp.registry = scd.registry
 		scd.apps = append(scd.apps, curApp)
 		if curApp.bootFlag == nil {
 			continue
@@ -122,24 +385,65 @@ func (scd *Scheduler) initialize() error {
 		schedulerBootFlags = append(schedulerBootFlags, curApp.bootFlag)
 	}
 
-	// 解析启动参数
-	flags.ParseWithStructPointers(append([]interface{}{scd.globalBootFlag}, schedulerBootFlags...)...)
+	// 按依赖关系排序app
+	err := scd.sortAppsByDependency()
+	if err != nil {
+		return err
+	}
 
-	// 解析配置文件
-	if scd.globalBootConfigFileContent != nil && scd.globalBootFlag.BootConfigFile != "" {
+	// 解析启动参数
+	if scd.isBootArgsInjected {
+		flags.Reset(scd.bootArgs, scd.bootEnv)
+	}
+	err = flags.ParseWithStructPointers(append([]interface{}{scd.globalBootFlag}, schedulerBootFlags...)...)
+	if err != nil {
+		return fmt.Errorf("parse boot flags error:%v", err)
+	}
 
-		content, err := ioutil.ReadFile(scd.globalBootFlag.BootConfigFile)
+	// 解析配置文件，配置文件里跟启动参数同名的配置项也作为启动参数的值，优先级低于环境变量、命令行
+	if scd.etcdConfig != nil {
+		err = scd.etcdConfig.connect(scd.globalBootFlag.BootConfigEtcd)
 		if err != nil {
-			newErr := fmt.Errorf("load boot config file %v error:%v", scd.globalBootFlag.BootConfigFile, err)
-			return newErr
+			return err
 		}
-
-		err = scd.globalBootConfigParser(content, scd.globalBootConfigFileContent)
+	}
+	if scd.hasBootConfig() {
+		content, err := scd.loadBootConfigContent()
 		if err != nil {
-			newErr := fmt.Errorf("load boot config file %v content %v ok, but parse content error:%v",
-				scd.globalBootFlag.BootConfigFile, string(content), err)
-			return newErr
+			return err
 		}
+
+		if scd.globalBootConfigFileContent != nil {
+			err = scd.parseBootConfigContent(content, scd.globalBootConfigFileContent)
+			if err != nil {
+				return err
+			}
+			scd.bootConfigFileContent.Store(scd.globalBootConfigFileContent)
+		}
+
+		values := make(map[string]interface{})
+		if scd.getBootConfigParser()(content, &values) == nil {
+			err = flags.ApplyConfigFileValues(flags.FlattenConfigValues(values))
+			if err != nil {
+				return fmt.Errorf("apply boot config %v to boot flags error:%v", scd.bootConfigSource(), err)
+			}
+		}
+	}
+
+	// 所有来源都应用后校验启动参数
+	err = flags.Validate()
+	if err != nil {
+		return err
+	}
+
+	// 监督模式父进程不运行app，子进程只运行分配的app
+	if scd.isSupervisor() {
+		err = scd.initSupervisor()
+	} else if isSupervisorChild() {
+		err = scd.filterSupervisorChildApps()
+	}
+	if err != nil {
+		return err
 	}
 
 	// 检查一下启动参数
@@ -162,8 +466,12 @@ func (scd *Scheduler) initialize() error {
 		// 没有指定日志输出目录，默认输出到控制台
 		logHandlers = append(logHandlers, os.Stdout)
 	} else {
-		// 指定日志输出目录
-		logHandler, err := handler.NewRotatingDayMaxFileHandler(scd.globalBootFlag.LogDirPath, scd.globalBootFlag.ServiceName, 1<<30, 10)
+		// 指定日志输出目录，监督模式的子进程日志文件名加上子进程名
+		logFileName := scd.globalBootFlag.ServiceName
+		if isSupervisorChild() {
+			logFileName += "_" + os.Getenv(envSupervisorChild)
+		}
+		logHandler, err := handler.NewRotatingDayMaxFileHandler(scd.globalBootFlag.LogDirPath, logFileName, 1<<30, 10)
 		if err != nil {
 			newErr := fmt.Errorf("new log file handler with path [%v] name[%v] error:%v",
 				scd.globalBootFlag.LogDirPath, scd.globalBootFlag.ServiceName, err)
@@ -177,18 +485,24 @@ func (scd *Scheduler) initialize() error {
 		}
 	}
 
-	// 获取日志等级默认日志等级0，对应zerolog是debug
-	logLevel := scd.defaultLogLevel
-	if scd.globalBootFlag.LogLevel != "" {
-		logLevel = log.LogLevelStr2Enum[scd.globalBootFlag.LogLevel]
-	}
 	// 创建logger
-	log.NewGlobalLogger(logHandlers, logLevel, func(l zerolog.Logger) zerolog.Logger {
-		return l.With().Str("service", scd.globalBootFlag.ServiceName).Str("node_id", scd.globalBootFlag.GlobalID).Logger()
+	log.NewGlobalLogger(logHandlers, scd.getLogLevel(), func(l zerolog.Logger) zerolog.Logger {
+		l = l.With().Str("service", scd.globalBootFlag.ServiceName).Str("node_id", scd.globalBootFlag.GlobalID).Logger()
+		if isSupervisorChild() {
+			l = l.With().Str("supervisor_child", os.Getenv(envSupervisorChild)).Logger()
+		}
+		return l
 	})
 
-	// 初始化prometheus metrics、go pprof
+	// 输出所有启动参数最终生效的值和来源
+	for _, fs := range flags.Sources() {
+		log.Noticef("boot flag %v=%v from %v", fs.Key, fs.Value, fs.Source)
+	}
+
+	// 初始化prometheus metrics、go pprof、k8s探针、运维管理接口
 	scd.server = prom.NewEngine(":"+scd.globalBootFlag.TracePort, true)
+	scd.registerHealthRoutes()
+	scd.registerAdminRoutes()
 
 	// 初始化holmes dump
 	holmesPath := scd.globalBootFlag.LogDirPath
@@ -199,26 +513,118 @@ func (scd *Scheduler) initialize() error {
 	} else {
 		holmesPath = "log/"
 	}
-	holmes.StartTraceAndDump(holmesPath + "holmes/" + scd.globalBootFlag.ServiceName)
+	scd.stopHolmes = holmes.StartTraceAndDump(holmesPath + "holmes/" + scd.globalBootFlag.ServiceName)
+
+	return nil
+}
+
+func (scd *Scheduler) hasBootConfig() bool {
+	return scd.etcdConfig != nil || scd.bootConfigContent != nil || scd.globalBootFlag.BootConfigFile != ""
+}
+
+// bootConfigSource 起服配置来源，etcd配置为key，内存配置为name，否则为配置文件路径
+func (scd *Scheduler) bootConfigSource() string {
+	if scd.etcdConfig != nil {
+		return "etcd:" + scd.etcdConfig.key
+	}
+	if scd.bootConfigContent != nil {
+		return "memory:" + scd.bootConfigContent.name
+	}
+	return scd.globalBootFlag.BootConfigFile
+}
+
+func (scd *Scheduler) loadBootConfigContent() ([]byte, error) {
+	if scd.etcdConfig != nil {
+		return scd.etcdConfig.get()
+	}
+	if scd.bootConfigContent != nil {
+		return scd.bootConfigContent.content, nil
+	}
+	return scd.readBootConfigFile()
+}
+
+func (scd *Scheduler) readBootConfigFile() ([]byte, error) {
+	content, err := ioutil.ReadFile(scd.globalBootFlag.BootConfigFile)
+	if err != nil {
+		newErr := fmt.Errorf("load boot config file %v error:%v", scd.globalBootFlag.BootConfigFile, err)
+		return nil, newErr
+	}
+	return content, nil
+}
 
+func (scd *Scheduler) parseBootConfigContent(content []byte, out interface{}) error {
+	err := scd.getBootConfigParser()(content, out)
+	if err != nil {
+		newErr := fmt.Errorf("load boot config %v content %v ok, but parse content error:%v",
+			scd.bootConfigSource(), string(content), err)
+		return newErr
+	}
+	if v, ok := out.(BootConfigValidator); ok {
+		err = v.Validate()
+		if err != nil {
+			return fmt.Errorf("validate boot config %v error:%v", scd.bootConfigSource(), err)
+		}
+	}
 	return nil
 }
 
+// getBootConfigParser 没有设置配置文件解析函数时，文件(或etcd key)后缀为.toml按toml解析，其它默认yaml，
+// .json也按yaml解析(yaml兼容json语法)，和以前一样读取yaml tag
+func (scd *Scheduler) getBootConfigParser() func(in []byte, out interface{}) error {
+	if scd.globalBootConfigParser != nil {
+		return scd.globalBootConfigParser
+	}
+	switch strings.ToLower(filepath.Ext(scd.bootConfigSource())) {
+	case ".toml":
+		return toml.Unmarshal
+	default:
+		return yaml.Unmarshal
+	}
+}
+
+// getLogLevel 获取日志等级，优先级：配置文件>启动参数>默认日志等级，默认日志等级0，对应zerolog是debug
+func (scd *Scheduler) getLogLevel() log.LogLevel {
+	logLevel := scd.defaultLogLevel
+	if scd.globalBootFlag.LogLevel != "" {
+		logLevel = log.LogLevelStr2Enum[scd.globalBootFlag.LogLevel]
+	}
+	if c, ok := scd.BootConfigFileContent().(BootConfigLogLevel); ok {
+		if level, find := log.LogLevelStr2Enum[c.GetLogLevel()]; find {
+			logLevel = level
+		}
+	}
+	return logLevel
+}
+
+func (scd *Scheduler) applyLogLevel() {
+	logLevel := scd.getLogLevel()
+	log.SetLogLevel(logLevel)
+	log.Noticef("apply log level %v", logLevel)
+}
+
 func (scd *Scheduler) initApps() error {
 	for i, app := range scd.apps {
-		if scd.adis[i].initFunc != nil {
-			err := scd.adis[i].initFunc(scd.globalBootFlag, scd.globalBootConfigFileContent, app)
-			if err != nil {
-				return fmt.Errorf("application[%v] init return error[%v]", app.Name, err)
-			} else {
-				log.Noticef("application[%v] initialize ok", app.Name)
-			}
+		err := scd.initApp(scd.adis[i], app)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+func (scd *Scheduler) initApp(adi *ApplicationDescInfo, app *Application) error {
+	if adi.initFunc != nil {
+		err := adi.initFunc(scd.globalBootFlag, scd.BootConfigFileContent(), app)
+		if err != nil {
+			return fmt.Errorf("application[%v] init return error[%v]", app.Name, err)
+		} else {
+			log.Noticef("application[%v] initialize ok", app.Name)
+		}
+	}
+	return nil
+}
+
 func (scd *Scheduler) applyOptions(options ...SchedulerOption) *Scheduler {
 	for _, option := range options {
 		option.Apply(scd)
@@ -0,0 +1,123 @@
+package application
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/flags"
+	"github.com/xlkness/lkit-go/internal/log"
+	"github.com/xlkness/lkit-go/internal/trace/holmes"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"net"
+	"net/http"
+)
+
+// adminTokenHeader 运维修改接口校验token的请求头
+const adminTokenHeader = "X-Admin-Token"
+
+type adminLogLevelParams struct {
+	Level string `json:"level" desc:"trace|debug|info|notice|warn|error|criti|fatal|panic"`
+}
+
+type adminStopAppParams struct {
+	Name string `json:"name" desc:"app名"`
+}
+
+// registerAdminRoutes trace server添加运维管理接口：
+// GET /admin/apps 查看所有app及其task、worker、job的运行状态；
+// GET /admin/flags 查看所有启动参数最终生效的值和来源，secret参数只显示掩码；
+// GET /admin/supervisor 监督模式下查看所有子进程的运行状态；
+// POST /admin/log_level 修改日志等级；
+// POST /admin/holmes_dump 手动dump goroutine、heap；
+// POST /admin/apps/stop 异步优雅停止某个app，返回202和app状态，停止后不会按重启策略重启，也不再影响/healthz、/readyz；
+// 所有接口需要通过adminAuthorized校验，POST接口参数解析失败返回400
+func (scd *Scheduler) registerAdminRoutes() {
+	admin := scd.server.Group("/admin", scd.adminGuard)
+	admin.Get("/apps", "查看所有app运行状态", func(c *prom.Context) {
+		apps := make([]*appStatusInfo, 0)
+		for _, app := range scd.getApps() {
+			apps = append(apps, app.statusInfo())
+		}
+		c.GetGinContext().JSON(http.StatusOK, map[string]interface{}{"apps": apps})
+	})
+
+	admin.Get("/flags", "查看启动参数的值和来源", func(c *prom.Context) {
+		c.GetGinContext().JSON(http.StatusOK, map[string]interface{}{"flags": flags.Sources()})
+	})
+
+	admin.Get("/supervisor", "查看监督模式子进程运行状态", func(c *prom.Context) {
+		children := make([]*supervisorChildInfo, 0, len(scd.supervisorChildren))
+		for _, child := range scd.supervisorChildren {
+			children = append(children, child.info())
+		}
+		c.GetGinContext().JSON(http.StatusOK, map[string]interface{}{"children": children})
+	})
+
+	admin.PostWithStructParams("/log_level", "修改日志等级", adminLogLevelParams{},
+		func(c *prom.Context, params *adminLogLevelParams) {
+			level, find := log.LogLevelStr2Enum[params.Level]
+			if !find {
+				responseAdminError(c, http.StatusBadRequest, fmt.Errorf("invalid log level:%v", params.Level))
+				return
+			}
+			log.SetLogLevel(level)
+			log.Noticef("admin change log level to %v", params.Level)
+			c.GetGinContext().JSON(http.StatusOK, map[string]interface{}{"level": params.Level})
+		})
+
+	admin.Post("/holmes_dump", "手动dump goroutine、heap", func(c *prom.Context) {
+		files, err := holmes.Dump()
+		if err != nil {
+			responseAdminError(c, http.StatusInternalServerError, err)
+			return
+		}
+		log.Noticef("admin holmes dump files:%v", files)
+		c.GetGinContext().JSON(http.StatusOK, map[string]interface{}{"files": files})
+	})
+
+	admin.PostWithStructParams("/apps/stop", "优雅停止某个app", adminStopAppParams{},
+		func(c *prom.Context, params *adminStopAppParams) {
+			app := scd.stopAppByAdmin(params.Name)
+			if app == nil {
+				responseAdminError(c, http.StatusNotFound, fmt.Errorf("application %v not found", params.Name))
+				return
+			}
+			log.Noticef("admin stop application[%v]", app.Name)
+			c.GetGinContext().JSON(http.StatusAccepted, app.statusInfo())
+		})
+}
+
+// adminGuard 运维接口先校验调用方，POST接口解析参数失败时engine不写响应，这里返回400
+func (scd *Scheduler) adminGuard(c *prom.Context) {
+	gc := c.GetGinContext()
+	if !scd.adminAuthorized(c) {
+		gc.Abort()
+		return
+	}
+	gc.Next()
+	if !gc.Writer.Written() {
+		responseAdminError(c, http.StatusBadRequest, fmt.Errorf("invalid params of %v", gc.Request.URL.Path))
+	}
+}
+
+// adminAuthorized 校验运维接口的调用方，设置了admin_token时请求头X-Admin-Token需要一致，
+// 没有设置时只允许本机访问，不通过时返回错误响应
+func (scd *Scheduler) adminAuthorized(c *prom.Context) bool {
+	if token := scd.globalBootFlag.AdminToken; token != "" {
+		header := c.GetGinContext().GetHeader(adminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(header), []byte(token)) == 1 {
+			return true
+		}
+		responseAdminError(c, http.StatusUnauthorized, fmt.Errorf("invalid admin token"))
+		return false
+	}
+	// 不用ClientIP，X-Forwarded-For可以伪造
+	if ip := net.ParseIP(c.GetGinContext().RemoteIP()); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	responseAdminError(c, http.StatusForbidden, fmt.Errorf("admin api only allowed from localhost without admin_token"))
+	return false
+}
+
+func responseAdminError(c *prom.Context, code int, err error) {
+	c.GetGinContext().JSON(code, map[string]interface{}{"error": err.Error()})
+}
@@ -0,0 +1,272 @@
+package application
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestAdminAuthorized(t *testing.T) {
+	scd := NewScheduler()
+	scd.globalBootFlag = &CommBootFlag{}
+	scd.server = prom.NewEngine(":0", false)
+	scd.registerAdminRoutes()
+
+	// 通过校验后找不到app返回404
+	post := func(remoteAddr, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/admin/apps/stop", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "127.0.0.1")
+		if token != "" {
+			req.Header.Set(adminTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		scd.server.GetGinEngine().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 没有设置token只允许本机访问，X-Forwarded-For不生效
+	if code := post("127.0.0.1:5000", ""); code != http.StatusNotFound {
+		t.Fatalf("localhost without token code:%v", code)
+	}
+	if code := post("10.0.0.1:5000", ""); code != http.StatusForbidden {
+		t.Fatalf("remote without token code:%v", code)
+	}
+
+	// 设置token后校验token，本机也需要
+	scd.globalBootFlag.AdminToken = "secret"
+	if code := post("10.0.0.1:5000", "secret"); code != http.StatusNotFound {
+		t.Fatalf("remote with token code:%v", code)
+	}
+	if code := post("127.0.0.1:5000", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong token code:%v", code)
+	}
+	if code := post("127.0.0.1:5000", ""); code != http.StatusUnauthorized {
+		t.Fatalf("missing token code:%v", code)
+	}
+}
+
+func TestAdminSecretFlag(t *testing.T) {
+	const token = "admin-secret-token"
+	logDir := t.TempDir()
+	signals := make(chan os.Signal)
+	scd := NewScheduler(
+		WithSchedulerBootArgs([]string{"-trace_port=0", "-log_dir=" + logDir, "-admin_token=" + token}, nil),
+		WithSchedulerSignals(signals),
+	).CreateApp(NewApplicationDescInfo("game", nil))
+	done := make(chan error, 1)
+	go func() {
+		done <- scd.Run()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := scd.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:5000"
+		if token != "" {
+			req.Header.Set(adminTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		scd.TraceServer().GetGinEngine().ServeHTTP(w, req)
+		return w
+	}
+
+	// 查看配置的接口也需要校验调用方
+	for _, path := range []string{"/admin/apps", "/admin/flags", "/admin/supervisor"} {
+		if w := get(path, ""); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%v without token response:%v %v", path, w.Code, w.Body.String())
+		}
+	}
+
+	// 启动参数接口、启动日志都不输出token
+	w := get("/admin/flags", token)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), token) || !strings.Contains(w.Body.String(), `"admin_token"`) {
+		t.Fatalf("admin flags response:%v %v", w.Code, w.Body.String())
+	}
+
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("scheduler not stop after signal")
+	}
+
+	logged := false
+	err := filepath.WalkDir(logDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(content), token) {
+			t.Fatalf("log file %v contains admin token", path)
+		}
+		logged = logged || strings.Contains(string(content), "boot flag admin_token=")
+		return nil
+	})
+	if err != nil || !logged {
+		t.Fatalf("walk log dir error:%v, boot flag logged:%v", err, logged)
+	}
+}
+
+func TestAdminInvalidParams(t *testing.T) {
+	scd := NewScheduler()
+	scd.globalBootFlag = &CommBootFlag{}
+	scd.server = prom.NewEngine(":0", false)
+	scd.registerAdminRoutes()
+
+	post := func(remoteAddr, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		scd.server.GetGinEngine().ServeHTTP(w, req)
+		return w
+	}
+
+	// 参数解析失败返回400，先校验调用方
+	w := post("127.0.0.1:5000", "/admin/log_level", `{"level":1}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid params") {
+		t.Fatalf("invalid params response:%v %v", w.Code, w.Body.String())
+	}
+	if w = post("10.0.0.1:5000", "/admin/log_level", `{"level":1}`); w.Code != http.StatusForbidden {
+		t.Fatalf("remote invalid params response:%v %v", w.Code, w.Body.String())
+	}
+
+	// 其它prom engine的接口解析参数失败仍然不写响应
+	type params struct {
+		Count int `json:"count"`
+	}
+	called := false
+	scd.server.PostWithStructParams("/other", "other", params{}, func(c *prom.Context, p *params) {
+		called = true
+	})
+	if w = post("127.0.0.1:5000", "/other", `{"count":"x"}`); called || w.Body.Len() != 0 {
+		t.Fatalf("other route invalid params response:%v %v", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminStopApp(t *testing.T) {
+	scd := NewScheduler()
+	scd.globalBootFlag = &CommBootFlag{}
+	scd.server = prom.NewEngine(":0", false)
+	scd.registerAdminRoutes()
+	scd.registerHealthRoutes()
+
+	// 停止过程较慢，接口不等待停止完成
+	app := newApp("game").WithShutdownTask("slow", func(ctx context.Context) error {
+		time.Sleep(time.Millisecond * 500)
+		return nil
+	})
+	scd.apps = []*Application{app}
+	done := runTestApp(app)
+	waitAppReady(t, app)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:5000"
+		w := httptest.NewRecorder()
+		scd.server.GetGinEngine().ServeHTTP(w, req)
+		return w
+	}
+
+	start := time.Now()
+	w := serve(http.MethodPost, "/admin/apps/stop", `{"name":"game"}`)
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"state":"draining"`) {
+		t.Fatalf("stop app response:%v %v", w.Code, w.Body.String())
+	}
+	if cost := time.Since(start); cost > time.Millisecond*300 {
+		t.Fatalf("stop app wait shutdown:%v", cost)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("application not stop")
+	}
+	<-app.stoppedChan
+
+	// 主动停止的app不影响就绪探针
+	if w = serve(http.MethodGet, "/readyz", ""); w.Code != http.StatusOK {
+		t.Fatalf("readyz after admin stop:%v %v", w.Code, w.Body.String())
+	}
+}
+
+func TestAdminStopAppInRestartBackoff(t *testing.T) {
+	var runs int32
+	adi := NewApplicationDescInfo("game", func(_ *CommBootFlag, _ interface{}, app *Application) error {
+		app.WithInitializeTask("connect", func() error {
+			atomic.AddInt32(&runs, 1)
+			return errTest
+		})
+		return nil
+	}).WithOptions(WithAppRestartPolicy(RestartPolicy{Type: RestartAlways, InitialBackoff: time.Millisecond * 300}))
+	scd := newRunScheduler(t, adi)
+	defer scd.Stop()
+	scd.globalBootFlag = &CommBootFlag{}
+	scd.server = prom.NewEngine(":0", false)
+	scd.registerAdminRoutes()
+	scd.registerHealthRoutes()
+
+	type result struct {
+		app *Application
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		app, err := scd.runApp(0)
+		done <- result{app, err}
+	}()
+	for i := 0; i < 100 && atomic.LoadInt32(&runs) == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// 第一次运行失败后在重启退避中，停止的是已经停止的旧app，退避结束后不能重新创建运行
+	req := httptest.NewRequest(http.MethodPost, "/admin/apps/stop", strings.NewReader(`{"name":"game"}`))
+	req.RemoteAddr = "127.0.0.1:5000"
+	w := httptest.NewRecorder()
+	scd.server.GetGinEngine().ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("stop app response:%v %v", w.Code, w.Body.String())
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil || r.app != scd.getApp(0) {
+			t.Fatalf("run app after admin stop error:%v", r.err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("run app not return after admin stop")
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("admin stopped app restarted, runs:%v", n)
+	}
+
+	// 主动停止的app不影响就绪探针
+	req = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	w = httptest.NewRecorder()
+	scd.server.GetGinEngine().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("readyz after admin stop:%v %v", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,220 @@
+package application
+
+import (
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/log"
+	"time"
+)
+
+// sortAppsByDependency 按依赖关系对app拓扑排序，没有依赖关系的app保持创建顺序，
+// 依赖的app不存在或者存在循环依赖返回错误
+func (scd *Scheduler) sortAppsByDependency() error {
+	names := make(map[string]bool, len(scd.apps))
+	for _, app := range scd.apps {
+		names[app.Name] = true
+	}
+	for _, app := range scd.apps {
+		for _, dep := range app.dependencies {
+			if !names[dep] {
+				return fmt.Errorf("application[%v] depends on not exists application[%v]", app.Name, dep)
+			}
+		}
+	}
+
+	placedIdx := make([]bool, len(scd.apps))
+	placedName := make(map[string]bool, len(scd.apps))
+	sortedApps := make([]*Application, 0, len(scd.apps))
+	sortedAdis := make([]*ApplicationDescInfo, 0, len(scd.adis))
+	for len(sortedApps) < len(scd.apps) {
+		found := false
+		for i, app := range scd.apps {
+			if placedIdx[i] {
+				continue
+			}
+			isDepsPlaced := true
+			for _, dep := range app.dependencies {
+				if !placedName[dep] {
+					isDepsPlaced = false
+					break
+				}
+			}
+			if !isDepsPlaced {
+				continue
+			}
+			placedIdx[i] = true
+			placedName[app.Name] = true
+			sortedApps = append(sortedApps, app)
+			sortedAdis = append(sortedAdis, scd.adis[i])
+			found = true
+			break
+		}
+
+		if !found {
+			var circular []string
+			for i, app := range scd.apps {
+				if !placedIdx[i] {
+					circular = append(circular, app.Name)
+				}
+			}
+			return fmt.Errorf("applications %v have circular dependency", circular)
+		}
+	}
+
+	scd.apps = sortedApps
+	scd.adis = sortedAdis
+	return nil
+}
+
+// runApp 等待依赖的app都就绪后运行app，并按app的重启策略处理app退出，
+// 返回最后运行的app和需要停止调度器的错误
+func (scd *Scheduler) runApp(idx int) (*Application, error) {
+	app := scd.getApp(idx)
+
+	for _, dep := range app.dependencies {
+		log.Noticef("application[%v] wait depends application[%v] ready", app.Name, dep)
+		if !scd.waitAppReady(dep, app.stopChan) {
+			return app, nil
+		}
+	}
+
+	restarts := 0
+	for {
+		startTime := time.Now()
+		err := app.run()
+		app.shutdown()
+		// 调度器停止不重启，正常退出只有RestartAlways重启，主动停止app在下面检查
+		if scd.stopping() || (err == nil && app.restartPolicy.Type != RestartAlways) {
+			return app, nil
+		}
+
+		// 稳定运行一段时间后重置重启次数
+		if time.Since(startTime) > app.restartPolicy.maxBackoff() {
+			restarts = 0
+		}
+
+		for {
+			// 重启退避前后都检查，通过运维接口停止的app不再重启
+			if scd.appStoppedByAdmin(app.Name) {
+				return app, nil
+			}
+			if !app.restartPolicy.shouldRestart(err, restarts) {
+				return app, err
+			}
+
+			backoff := app.restartPolicy.backoff(restarts)
+			restarts++
+			log.Warnf("application[%v] exit with error:%v, will restart after %v with policy %v, restart times:%v",
+				app.Name, err, backoff, app.restartPolicy.Type, restarts)
+
+			select {
+			case <-time.After(backoff):
+			case <-scd.stopChan:
+				return app, nil
+			}
+			if scd.appStoppedByAdmin(app.Name) {
+				return app, nil
+			}
+
+			var newApp *Application
+			newApp, err = scd.recreateApp(idx)
+			if err == nil {
+				app = newApp
+				break
+			}
+			log.Errorf("application[%v] restart error:%v", app.Name, err)
+		}
+	}
+}
+
+// recreateApp 重新创建并初始化app，替换调度器里的旧app
+func (scd *Scheduler) recreateApp(idx int) (*Application, error) {
+	adi := scd.adis[idx]
+	app := newApp(adi.name, adi.options...)
+	app.registry = scd.registry
+	app.restarts = scd.getApp(idx).restarts + 1
+	err := scd.initApp(adi, app)
+	if err != nil {
+		app.shutdown()
+		return nil, err
+	}
+
+	scd.appsLock.Lock()
+	if scd.isStopping {
+		scd.appsLock.Unlock()
+		app.shutdown()
+		return nil, fmt.Errorf("scheduler is stopping")
+	}
+	// 重新初始化期间通过运维接口停止
+	if scd.appsStoppedByAdmin[adi.name] {
+		scd.appsLock.Unlock()
+		app.shutdown()
+		return nil, fmt.Errorf("application is stopped by admin")
+	}
+	scd.apps[idx] = app
+	close(scd.appsReplaced)
+	scd.appsReplaced = make(chan struct{})
+	scd.appsLock.Unlock()
+
+	return app, nil
+}
+
+// waitAppReady 等待名字为name的app就绪，app启动失败重启时等待新的app，stopChan关闭返回false
+func (scd *Scheduler) waitAppReady(name string, stopChan <-chan struct{}) bool {
+	for {
+		scd.appsLock.Lock()
+		var readyChan chan struct{}
+		for _, app := range scd.apps {
+			if app.Name == name {
+				readyChan = app.readyChan
+			}
+		}
+		replaced := scd.appsReplaced
+		scd.appsLock.Unlock()
+
+		select {
+		case <-readyChan:
+			return true
+		case <-replaced:
+		case <-stopChan:
+			return false
+		}
+	}
+}
+
+// stopAppByAdmin 记录app通过运维接口停止并异步停止当前的app，重启退避中的app不再重启，app不存在返回nil
+func (scd *Scheduler) stopAppByAdmin(name string) *Application {
+	scd.appsLock.Lock()
+	defer scd.appsLock.Unlock()
+	for _, app := range scd.apps {
+		if app.Name == name {
+			scd.appsStoppedByAdmin[name] = true
+			app.stopByAdmin()
+			return app
+		}
+	}
+	return nil
+}
+
+func (scd *Scheduler) appStoppedByAdmin(name string) bool {
+	scd.appsLock.Lock()
+	defer scd.appsLock.Unlock()
+	return scd.appsStoppedByAdmin[name]
+}
+
+func (scd *Scheduler) getApp(idx int) *Application {
+	scd.appsLock.Lock()
+	defer scd.appsLock.Unlock()
+	return scd.apps[idx]
+}
+
+func (scd *Scheduler) getApps() []*Application {
+	scd.appsLock.Lock()
+	defer scd.appsLock.Unlock()
+	return append([]*Application{}, scd.apps...)
+}
+
+func (scd *Scheduler) stopping() bool {
+	scd.appsLock.Lock()
+	defer scd.appsLock.Unlock()
+	return scd.isStopping
+}
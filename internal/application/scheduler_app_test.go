@@ -0,0 +1,223 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSortAppsByDependency(t *testing.T) {
+	scd := NewScheduler()
+	scd.apps = []*Application{
+		newApp("gateway", WithAppDependsOn("db", "cache")),
+		newApp("analytics"),
+		newApp("cache", WithAppDependsOn("db")),
+		newApp("db"),
+	}
+	scd.adis = make([]*ApplicationDescInfo, len(scd.apps))
+	for i, app := range scd.apps {
+		scd.adis[i] = NewApplicationDescInfo(app.Name, nil)
+	}
+
+	err := scd.sortAppsByDependency()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"analytics", "db", "cache", "gateway"}
+	for i, app := range scd.apps {
+		if app.Name != expect[i] || scd.adis[i].name != expect[i] {
+			t.Fatalf("sorted apps index %v expect %v, got app %v desc %v", i, expect[i], app.Name, scd.adis[i].name)
+		}
+	}
+
+	scd.apps = []*Application{newApp("a", WithAppDependsOn("b")), newApp("b", WithAppDependsOn("a"))}
+	scd.adis = []*ApplicationDescInfo{NewApplicationDescInfo("a", nil), NewApplicationDescInfo("b", nil)}
+	if err := scd.sortAppsByDependency(); err == nil {
+		t.Fatalf("circular dependency expect error")
+	}
+
+	scd.apps = []*Application{newApp("a", WithAppDependsOn("c"))}
+	scd.adis = []*ApplicationDescInfo{NewApplicationDescInfo("a", nil)}
+	if err := scd.sortAppsByDependency(); err == nil {
+		t.Fatalf("not exists dependency expect error")
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	p := &RestartPolicy{Type: RestartOnFailure, MaxRestarts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second * 5}
+	expect := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5}
+	for i, v := range expect {
+		if b := p.backoff(i); b != v {
+			t.Fatalf("backoff %v expect %v, got %v", i, v, b)
+		}
+	}
+
+	if !p.shouldRestart(errTest, 2) || p.shouldRestart(errTest, 3) || p.shouldRestart(nil, 0) {
+		t.Fatalf("on failure policy restart check error")
+	}
+	if (&RestartPolicy{}).shouldRestart(errTest, 0) {
+		t.Fatalf("never policy should not restart")
+	}
+}
+
+var errTest = errors.New("test error")
+
+// newRunScheduler 创建并初始化app，不解析启动参数，用于直接测试runApp
+func newRunScheduler(t *testing.T, adis ...*ApplicationDescInfo) *Scheduler {
+	scd := NewScheduler()
+	scd.adis = adis
+	for _, adi := range adis {
+		app := newApp(adi.name, adi.options...)
+		if err := scd.initApp(adi, app); err != nil {
+			t.Fatal(err)
+		}
+		scd.apps = append(scd.apps, app)
+	}
+	return scd
+}
+
+func TestRunAppWaitsRestartedDependency(t *testing.T) {
+	var attempts int32
+	db := NewApplicationDescInfo("db", func(_ *CommBootFlag, _ interface{}, app *Application) error {
+		n := atomic.AddInt32(&attempts, 1)
+		app.WithInitializeTask("connect", func() error {
+			if n == 1 {
+				return errTest
+			}
+			return nil
+		})
+		return nil
+	}).WithOptions(WithAppRestartPolicy(RestartPolicy{Type: RestartOnFailure, InitialBackoff: time.Millisecond * 10}))
+	gateway := NewApplicationDescInfo("gateway", nil).WithOptions(WithAppDependsOn("db"))
+	scd := newRunScheduler(t, db, gateway)
+
+	// 热升级的新进程等所有app就绪后才通知旧进程，第一次启动失败的app重启就绪后也要通知
+	r := newReadyPipe(t)
+	defer r.Close()
+	go scd.notifyUpgradeReady()
+
+	errs := make(chan error, len(scd.apps))
+	for i := range scd.apps {
+		go func(idx int) {
+			_, err := scd.runApp(idx)
+			errs <- err
+		}(i)
+	}
+
+	r.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatalf("wait upgrade ready error:%v", err)
+	}
+	if !scd.App("db").isReady() || !scd.App("gateway").isReady() {
+		t.Fatalf("notify upgrade ready before all applications ready")
+	}
+	if restarts := scd.App("db").restarts; restarts != 1 || atomic.LoadInt32(&attempts) != 2 {
+		t.Fatalf("db restarts:%v, attempts:%v", restarts, attempts)
+	}
+
+	scd.Stop()
+	for range scd.apps {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("run app after stop error:%v", err)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("run app not return after stop")
+		}
+	}
+}
+
+func TestRunAppRestartLimit(t *testing.T) {
+	var attempts int32
+	adi := NewApplicationDescInfo("db", func(_ *CommBootFlag, _ interface{}, app *Application) error {
+		atomic.AddInt32(&attempts, 1)
+		app.WithInitializeTask("connect", func() error { return errTest })
+		return nil
+	}).WithOptions(WithAppRestartPolicy(RestartPolicy{Type: RestartOnFailure, MaxRestarts: 2, InitialBackoff: time.Millisecond * 10}))
+	scd := newRunScheduler(t, adi)
+	defer scd.Stop()
+
+	app, err := scd.runApp(0)
+	if err == nil || app.restarts != 2 || atomic.LoadInt32(&attempts) != 3 {
+		t.Fatalf("run app over restart limit error:%v, restarts:%v, attempts:%v", err, app.restarts, attempts)
+	}
+}
+
+func TestRunAppRestartAlwaysOnNilExit(t *testing.T) {
+	newAdi := func(policy RestartPolicyType, runs *int32) *ApplicationDescInfo {
+		return NewApplicationDescInfo("db", func(_ *CommBootFlag, _ interface{}, app *Application) error {
+			app.WithPostWorker("sync", func(ctx context.Context) error {
+				atomic.AddInt32(runs, 1)
+				return nil
+			})
+			return nil
+		}).WithOptions(WithAppRestartPolicy(RestartPolicy{Type: policy, InitialBackoff: time.Millisecond * 10}))
+	}
+
+	// RestartAlways的worker正常返回后app退出并重启
+	var runs int32
+	scd := newRunScheduler(t, newAdi(RestartAlways, &runs))
+	done := make(chan error, 1)
+	go func() {
+		_, err := scd.runApp(0)
+		done <- err
+	}()
+	for i := 0; i < 300 && atomic.LoadInt32(&runs) < 3; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if n := atomic.LoadInt32(&runs); n < 3 || scd.getApp(0).restarts < 2 {
+		t.Fatalf("restart always app runs:%v, restarts:%v", n, scd.getApp(0).restarts)
+	}
+	scd.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run app after stop error:%v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("run app not return after stop")
+	}
+
+	// RestartOnFailure的worker正常返回不影响app运行
+	var failureRuns int32
+	scd = newRunScheduler(t, newAdi(RestartOnFailure, &failureRuns))
+	defer scd.Stop()
+	go scd.runApp(0)
+	time.Sleep(time.Millisecond * 200)
+	if n := atomic.LoadInt32(&failureRuns); n != 1 || scd.getApp(0).restarts != 0 {
+		t.Fatalf("restart on failure app runs:%v, restarts:%v", n, scd.getApp(0).restarts)
+	}
+}
+
+func TestSchedulerRegistry(t *testing.T) {
+	passed := registry.NewStaticRegistry(nil)
+	if r := newApp("db").Registry(passed); r != passed {
+		t.Fatalf("app without scheduler registry should use passed registry:%v", r)
+	}
+
+	mr := registry.NewMemoryRegistry()
+	var got registry.Registry
+	adi := NewApplicationDescInfo("db", func(_ *CommBootFlag, _ interface{}, app *Application) error {
+		got = app.Registry(passed)
+		return nil
+	})
+	scd := NewScheduler(WithSchedulerRegistry(mr))
+	scd.adis = []*ApplicationDescInfo{adi}
+	scd.apps = []*Application{newApp("db")}
+
+	// 重启重新创建的app也使用调度器的注册中心
+	app, err := scd.recreateApp(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.shutdown()
+	if got != mr {
+		t.Fatalf("app of scheduler should use scheduler registry:%v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// DefaultEtcdConfigTimeout 连接etcd、读取起服配置的超时时间
+var DefaultEtcdConfigTimeout = time.Second * 5
+
+// etcdConfig 从etcd的某个key读取起服配置，并监听key的变化
+type etcdConfig struct {
+	key      string
+	client   *clientv3.Client
+	kv       clientv3.KV      // 默认为client，测试时替换
+	watcher  clientv3.Watcher // 默认为client，测试时替换
+	revision atomic.Int64     // 最近一次读取到的配置的etcd版本，watch从下一个版本开始，热加载和watch会同时读写
+}
+
+func (ec *etcdConfig) connect(addrs string) error {
+	var endpoints []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			endpoints = append(endpoints, addr)
+		}
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("boot config etcd key %v is set, but etcd addrs is empty", ec.key)
+	}
+
+	client, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: DefaultEtcdConfigTimeout})
+	if err != nil {
+		return fmt.Errorf("connect boot config etcd %v error:%v", endpoints, err)
+	}
+	ec.client = client
+	ec.kv = client
+	ec.watcher = client
+	return nil
+}
+
+func (ec *etcdConfig) get() ([]byte, error) {
+	content, _, err := ec.load()
+	return content, err
+}
+
+// load 读取最新的配置和版本，并记录版本
+func (ec *etcdConfig) load() ([]byte, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultEtcdConfigTimeout)
+	resp, err := ec.kv.Get(ctx, ec.key)
+	cancel()
+	if err != nil {
+		return nil, 0, fmt.Errorf("get boot config etcd key %v error:%v", ec.key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, fmt.Errorf("boot config etcd key %v not found", ec.key)
+	}
+	ec.revision.Store(resp.Kvs[0].ModRevision)
+	return resp.Kvs[0].Value, resp.Kvs[0].ModRevision, nil
+}
+
+// watch 监听key的修改，每次修改调用onChange，watch中断时(例如版本被压缩)重新读取最新配置再继续监听，直到ctx结束
+func (ec *etcdConfig) watch(ctx context.Context, onChange func(content []byte)) {
+	for {
+		watchChan := ec.watcher.Watch(clientv3.WithRequireLeader(ctx), ec.key, clientv3.WithRev(ec.revision.Load()+1))
+		for resp := range watchChan {
+			if err := resp.Err(); err != nil {
+				log.Warnf("watch boot config etcd key %v error:%v", ec.key, err)
+				break
+			}
+			for _, ev := range resp.Events {
+				if ev.Type != clientv3.EventTypePut {
+					log.Warnf("boot config etcd key %v is deleted, keep current boot config", ec.key)
+					continue
+				}
+				ec.revision.Store(ev.Kv.ModRevision)
+				onChange(ev.Kv.Value)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+
+		last := ec.revision.Load()
+		content, revision, err := ec.load()
+		if err != nil {
+			log.Warnf("rewatch boot config etcd key %v, but get latest boot config error:%v", ec.key, err)
+			continue
+		}
+		if revision != last {
+			onChange(content)
+		}
+	}
+}
+
+func (ec *etcdConfig) close() {
+	if ec.client != nil {
+		ec.client.Close()
+	}
+}
+
+// watchEtcdConfig 监听etcd里的起服配置，修改后解析、校验通过再推送给各个app，失败保留旧配置
+func (scd *Scheduler) watchEtcdConfig() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-scd.stopChan
+		cancel()
+	}()
+
+	log.Noticef("watch boot config etcd key %v from revision %v", scd.etcdConfig.key, scd.etcdConfig.revision.Load())
+	scd.etcdConfig.watch(ctx, func(content []byte) {
+		err := scd.applyBootConfigContent(content)
+		if err != nil {
+			log.Errorf("boot config etcd key %v changed, but apply error:%v", scd.etcdConfig.key, err)
+			return
+		}
+		log.Noticef("boot config etcd key %v changed, apply revision %v ok", scd.etcdConfig.key, scd.etcdConfig.revision.Load())
+	})
+}
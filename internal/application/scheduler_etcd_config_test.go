@@ -0,0 +1,166 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type testBootConfig struct {
+	Rate int `yaml:"rate"`
+}
+
+func (c *testBootConfig) Validate() error {
+	if c.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, not %v", c.Rate)
+	}
+	return nil
+}
+
+func TestApplyBootConfigContent(t *testing.T) {
+	scd := NewScheduler(WithSchedulerBootConfigFileContent(&testBootConfig{Rate: 1}), WithSchedulerEtcdConfig("/game/shard/boot_config.yaml"))
+	app := newApp("game")
+	scd.apps = []*Application{app}
+
+	var rates []int
+	SubscribeBootConfig(app, "rate", func(conf *testBootConfig) error {
+		rates = append(rates, conf.Rate)
+		return nil
+	})
+	SubscribeBootConfig(app, "mismatch type", func(conf *CommBootFlag) error {
+		t.Fatalf("mismatch subscribe type should not be called")
+		return nil
+	})
+
+	if err := scd.applyBootConfigContent([]byte("rate: 5")); err != nil {
+		t.Fatal(err)
+	}
+	if err := scd.applyBootConfigContent([]byte("rate: -1")); err == nil {
+		t.Fatalf("invalid boot config expect error")
+	}
+
+	if len(rates) != 1 || rates[0] != 5 || scd.BootConfigFileContent().(*testBootConfig).Rate != 5 {
+		t.Fatalf("apply boot config error, subscribe rates:%v, current:%+v", rates, scd.BootConfigFileContent())
+	}
+}
+
+// fakeEtcd 内存里的etcd key，Watch返回的事件由测试发送
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+	lock     sync.Mutex
+	value    []byte
+	revision int64
+	watches  chan fakeWatch
+}
+
+type fakeWatch struct {
+	rev int64
+	ch  chan clientv3.WatchResponse
+}
+
+func (f *fakeEtcd) put(value string) *mvccpb.KeyValue {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.revision++
+	f.value = []byte(value)
+	return &mvccpb.KeyValue{Value: f.value, ModRevision: f.revision}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{{Key: []byte(key), Value: f.value, ModRevision: f.revision}}}, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	w := fakeWatch{rev: clientv3.OpGet(key, opts...).Rev(), ch: make(chan clientv3.WatchResponse)}
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp := <-w.ch:
+				out <- resp
+				if resp.Err() != nil {
+					return
+				}
+			}
+		}
+	}()
+	f.watches <- w
+	return out
+}
+
+func TestWatchEtcdConfigAndReload(t *testing.T) {
+	scd := NewScheduler(WithSchedulerBootConfigFileContent(&testBootConfig{Rate: 1}), WithSchedulerEtcdConfig("/game/shard/boot_config.yaml"))
+	fake := &fakeEtcd{watches: make(chan fakeWatch, 1)}
+	fake.put("rate: 1")
+	scd.etcdConfig.kv = fake
+	scd.etcdConfig.watcher = fake
+
+	rate := func() int {
+		return scd.BootConfigFileContent().(*testBootConfig).Rate
+	}
+	waitRate := func(expect int) {
+		for i := 0; i < 300 && rate() != expect; i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+		if rate() != expect {
+			t.Fatalf("boot config rate %v, expect %v", rate(), expect)
+		}
+	}
+	nextWatch := func(expectRev int64) fakeWatch {
+		select {
+		case w := <-fake.watches:
+			if w.rev != expectRev {
+				t.Fatalf("watch from revision %v, expect %v", w.rev, expectRev)
+			}
+			return w
+		case <-time.After(time.Second * 5):
+			t.Fatalf("watch not started")
+		}
+		return fakeWatch{}
+	}
+
+	if err := scd.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		scd.watchEtcdConfig()
+		close(done)
+	}()
+
+	// 修改推送给watch
+	w := nextWatch(2)
+	w.ch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: fake.put("rate: 2")}}}
+	waitRate(2)
+
+	// watch运行中热加载
+	fake.put("rate: 3")
+	if err := scd.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	waitRate(3)
+
+	// watch中断后读取最新配置，从最新版本的下一个版本继续监听
+	fake.put("rate: 4")
+	w.ch <- clientv3.WatchResponse{CompactRevision: 4}
+	waitRate(4)
+	nextWatch(5)
+
+	close(scd.stopChan)
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("watch not stop")
+	}
+}
@@ -0,0 +1,65 @@
+package application
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"net/http"
+	"time"
+)
+
+// DefaultHealthCheckTimeout 每次调用健康检查接口时执行app健康检查的超时时间
+var DefaultHealthCheckTimeout = time.Second * 3
+
+type appHealthInfo struct {
+	Name   string            `json:"name"`
+	State  string            `json:"state"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type healthInfo struct {
+	Status string           `json:"status"`
+	Apps   []*appHealthInfo `json:"apps,omitempty"`
+}
+
+// registerHealthRoutes trace server添加k8s探针接口：
+// /livez 进程存活即返回成功；
+// /healthz 所有app的健康检查都通过返回成功；
+// /readyz 所有app启动完毕、没有在停止并且健康检查都通过返回成功；
+// 通过运维接口停止的app不再检查
+func (scd *Scheduler) registerHealthRoutes() {
+	scd.server.Get("/livez", "存活探针", func(c *prom.Context) {
+		c.GetGinContext().JSON(http.StatusOK, &healthInfo{Status: "ok"})
+	})
+	scd.server.Get("/healthz", "健康检查", func(c *prom.Context) {
+		scd.responseHealth(c, false)
+	})
+	scd.server.Get("/readyz", "就绪探针", func(c *prom.Context) {
+		scd.responseHealth(c, true)
+	})
+}
+
+func (scd *Scheduler) responseHealth(c *prom.Context, isCheckReady bool) {
+	ctx, cancel := context.WithTimeout(c.GetGinContext().Request.Context(), DefaultHealthCheckTimeout)
+	defer cancel()
+
+	info := &healthInfo{Status: "ok"}
+	isOk := !isCheckReady || !scd.stopping()
+	for _, app := range scd.getApps() {
+		if scd.appStoppedByAdmin(app.Name) {
+			info.Apps = append(info.Apps, &appHealthInfo{Name: app.Name, State: app.lifecycleState()})
+			continue
+		}
+		checks, isHealthy := app.checkHealth(ctx)
+		if !isHealthy || (isCheckReady && !app.isReady()) {
+			isOk = false
+		}
+		info.Apps = append(info.Apps, &appHealthInfo{Name: app.Name, State: app.lifecycleState(), Checks: checks})
+	}
+
+	code := http.StatusOK
+	if !isOk {
+		info.Status = "fail"
+		code = http.StatusServiceUnavailable
+	}
+	c.GetGinContext().JSON(code, info)
+}
@@ -0,0 +1,106 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealthRoutes(t *testing.T) {
+	scd := NewScheduler()
+	scd.globalBootFlag = &CommBootFlag{}
+	scd.server = prom.NewEngine(":0", false)
+	scd.registerHealthRoutes()
+
+	// 0健康，1返回错误，2panic
+	var checkerMode int32
+	app := newApp("game").WithHealthChecker("db", func(ctx context.Context) error {
+		switch atomic.LoadInt32(&checkerMode) {
+		case 1:
+			return errors.New("db disconnected")
+		case 2:
+			panic("db checker panic")
+		}
+		return nil
+	})
+	scd.apps = []*Application{app}
+
+	serve := func(path string, expectCode int) *healthInfo {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		scd.server.GetGinEngine().ServeHTTP(w, req)
+		if w.Code != expectCode {
+			t.Fatalf("%v response code %v, expect %v, body:%v", path, w.Code, expectCode, w.Body.String())
+		}
+		info := new(healthInfo)
+		if err := json.Unmarshal(w.Body.Bytes(), info); err != nil {
+			t.Fatalf("%v response body %v error:%v", path, w.Body.String(), err)
+		}
+		expectStatus := "ok"
+		if expectCode != http.StatusOK {
+			expectStatus = "fail"
+		}
+		if info.Status != expectStatus {
+			t.Fatalf("%v response status %v, expect %v", path, info.Status, expectStatus)
+		}
+		return info
+	}
+
+	// 还在启动：存活、健康，但是没有就绪
+	serve("/livez", http.StatusOK)
+	serve("/healthz", http.StatusOK)
+	if info := serve("/readyz", http.StatusServiceUnavailable); len(info.Apps) != 1 || info.Apps[0].State != "starting" {
+		t.Fatalf("readyz of starting app:%+v", info.Apps[0])
+	}
+
+	done := runTestApp(app)
+	waitAppReady(t, app)
+	defer func() {
+		app.shutdown()
+		<-done
+	}()
+	serve("/healthz", http.StatusOK)
+	if info := serve("/readyz", http.StatusOK); info.Apps[0].State != "ready" || info.Apps[0].Checks["db"] != "ok" {
+		t.Fatalf("readyz of ready app:%+v", info.Apps[0])
+	}
+
+	// 健康检查失败
+	atomic.StoreInt32(&checkerMode, 1)
+	if info := serve("/healthz", http.StatusServiceUnavailable); info.Apps[0].Checks["db"] != "db disconnected" {
+		t.Fatalf("healthz of failing checker:%+v", info.Apps[0])
+	}
+	serve("/readyz", http.StatusServiceUnavailable)
+	serve("/livez", http.StatusOK)
+
+	// 健康检查panic报告为不健康
+	atomic.StoreInt32(&checkerMode, 2)
+	if info := serve("/healthz", http.StatusServiceUnavailable); !strings.Contains(info.Apps[0].Checks["db"], "panic") {
+		t.Fatalf("healthz of panic checker:%+v", info.Apps[0])
+	}
+	serve("/readyz", http.StatusServiceUnavailable)
+
+	// 调度器开始停止后不再就绪，仍然存活、健康
+	atomic.StoreInt32(&checkerMode, 0)
+	serve("/readyz", http.StatusOK)
+	scd.appsLock.Lock()
+	scd.isStopping = true
+	scd.appsLock.Unlock()
+	serve("/readyz", http.StatusServiceUnavailable)
+	serve("/healthz", http.StatusOK)
+	serve("/livez", http.StatusOK)
+
+	// app停止后不再就绪
+	scd.appsLock.Lock()
+	scd.isStopping = false
+	scd.appsLock.Unlock()
+	app.shutdown()
+	if info := serve("/readyz", http.StatusServiceUnavailable); info.Apps[0].State != "stopped" {
+		t.Fatalf("readyz of stopped app:%+v", info.Apps[0])
+	}
+}
@@ -1,21 +1,89 @@
 package application
 
-import "github.com/xlkness/lkit-go/internal/log"
+import (
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"github.com/xlkness/lkit-go/internal/log"
+	"os"
+	"sync"
+)
 
-// WithSchedulerBootConfigFileContent 设置启动配置文件的解析结构，不设置默认无起服配置，默认以yaml解析
+// WithSchedulerBootConfigFileContent 设置启动配置文件的解析结构，不设置默认无起服配置
 func WithSchedulerBootConfigFileContent(content interface{}) SchedulerOption {
 	return scdOptionFun(func(scd *Scheduler) {
 		scd.globalBootConfigFileContent = content
 	})
 }
 
-// WithSchedulerBootConfigFileParser 设置起服文件解析函数，默认yaml格式
+// WithSchedulerBootConfigFileParser 设置起服文件解析函数，默认后缀为.toml按toml解析，其它按yaml解析，
+// .json文件也按yaml解析，读取的是yaml tag，需要按json tag解析时设置为json.Unmarshal
 func WithSchedulerBootConfigFileParser(f func(content []byte, out interface{}) error) SchedulerOption {
 	return scdOptionFun(func(scd *Scheduler) {
 		scd.globalBootConfigParser = f
 	})
 }
 
+// WithSchedulerEtcdConfig 从etcd的key读取起服配置代替BootConfigFile，etcd地址由启动参数boot_config_etcd指定，
+// 运行时监听key的修改，解析、校验通过后推送给app(见OnConfigReload、SubscribeBootConfig)，key后缀决定默认解析格式
+func WithSchedulerEtcdConfig(key string) SchedulerOption {
+	return scdOptionFun(func(scd *Scheduler) {
+		scd.etcdConfig = &etcdConfig{key: key}
+	})
+}
+
+// WithSchedulerBootArgs 用args(不含程序名)和env代替os.Args、进程环境变量解析启动参数，并使用新的全局启动参数结构，
+// 不影响全局flag.CommandLine，用于测试在同一个进程里启动调度器
+func WithSchedulerBootArgs(args []string, env map[string]string) SchedulerOption {
+	return scdOptionFun(func(scd *Scheduler) {
+		scd.bootArgs = args
+		scd.bootEnv = env
+		scd.isBootArgsInjected = true
+		scd.globalBootFlag = new(CommBootFlag)
+	})
+}
+
+// WithSchedulerBootConfigContent 使用内存里的起服配置代替BootConfigFile，name的后缀决定默认解析格式，例如"boot.yaml"
+func WithSchedulerBootConfigContent(name string, content []byte) SchedulerOption {
+	return scdOptionFun(func(scd *Scheduler) {
+		scd.bootConfigContent = &memoryBootConfig{name: name, content: content}
+	})
+}
+
+// WithSchedulerSignals 从signals接收信号代替监听进程信号，SIGHUP热加载、SIGUSR2热升级，其它信号优雅停止，用于测试
+func WithSchedulerSignals(signals <-chan os.Signal) SchedulerOption {
+	return scdOptionFun(func(scd *Scheduler) {
+		scd.signals = signals
+	})
+}
+
+// WithSchedulerRegistry app通过Application.Registry获取注册中心时都使用r代替传入的注册中心，
+// 只影响当前调度器的app，用于测试、所有服务打包在一个进程的部署，一般直接用apptest包
+func WithSchedulerRegistry(r registry.Registry) SchedulerOption {
+	return scdOptionFun(func(scd *Scheduler) {
+		scd.registry = r
+	})
+}
+
+// WithSchedulerSupervisor 以监督模式运行，进程作为父进程用相同的二进制和启动参数fork出子进程，每个子进程运行一部分app，
+// 父进程按重启策略重启退出的子进程，转发退出、SIGHUP信号，并在trace server的/metrics聚合子进程的指标
+func WithSchedulerSupervisor(children ...SupervisorChild) SchedulerOption {
+	return scdOptionFun(func(scd *Scheduler) {
+		for _, child := range children {
+			scd.supervisorChildren = append(scd.supervisorChildren, &supervisorChildProcess{
+				SupervisorChild: child,
+				lock:            new(sync.Mutex),
+				state:           "pending",
+			})
+		}
+	})
+}
+
+// WithSchedulerSupervisorRestartPolicy 设置监督模式子进程的重启策略，默认DefaultSupervisorRestartPolicy
+func WithSchedulerSupervisorRestartPolicy(policy RestartPolicy) SchedulerOption {
+	return scdOptionFun(func(scd *Scheduler) {
+		scd.supervisorPolicy = policy
+	})
+}
+
 // WithSchedulerLogFileTimestampFormat 设置日志文件默认时间戳格式，默认"20060102"
 //func WithSchedulerLogFileTimestampFormat(format string) SchedulerOption {
 //	return appOptionFun(func(scd *Scheduler) {
@@ -0,0 +1,404 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/flags"
+	"github.com/xlkness/lkit-go/internal/libsyscal"
+	"github.com/xlkness/lkit-go/internal/log"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	envSupervisorChild = "lkit_supervisor_child" // 子进程名，不为空表示当前为监督模式的子进程
+	envSupervisorApps  = "lkit_supervisor_apps"  // 子进程运行的app名，逗号分隔
+)
+
+// DefaultSupervisorStopTimeout 监督模式停止时等待子进程优雅退出的超时时间，超时后kill
+var DefaultSupervisorStopTimeout = time.Second * 30
+
+// DefaultSupervisorRestartPolicy 监督模式子进程默认的重启策略
+var DefaultSupervisorRestartPolicy = RestartPolicy{Type: RestartAlways, InitialBackoff: time.Second, MaxBackoff: time.Minute}
+
+// SupervisorChild 监督模式下的一个子进程，子进程用相同的二进制和启动参数运行，只运行Apps指定的app
+type SupervisorChild struct {
+	Name      string   // 子进程名，同时作为日志文件名后缀和子进程指标的supervisor_child标签
+	Apps      []string // 子进程运行的app名，app依赖的app必须在同一个子进程
+	TracePort int      // 子进程trace server端口，为0用父进程端口+子进程序号
+	Args      []string // 追加的启动参数，例如-shard_id=1
+	Env       []string // 追加的环境变量，格式key=value
+}
+
+type supervisorChildProcess struct {
+	SupervisorChild
+	lock      *sync.Mutex
+	cmd       *exec.Cmd
+	state     string
+	restarts  int
+	lastError string
+}
+
+type supervisorChildInfo struct {
+	Name      string   `json:"name"`
+	Apps      []string `json:"apps"`
+	TracePort int      `json:"trace_port"`
+	Pid       int      `json:"pid,omitempty"`
+	State     string   `json:"state"`
+	Restarts  int      `json:"restarts"`
+	LastError string   `json:"last_error,omitempty"`
+}
+
+// isSupervisorChild 当前进程是否为监督模式的子进程
+func isSupervisorChild() bool {
+	return os.Getenv(envSupervisorChild) != ""
+}
+
+// isSupervisor 当前进程是否为监督模式的父进程
+func (scd *Scheduler) isSupervisor() bool {
+	return len(scd.supervisorChildren) > 0 && !isSupervisorChild()
+}
+
+// filterSupervisorChildApps 子进程只保留需要运行的app，启动参数已经按所有app注册，父进程传下来的参数不会解析失败
+func (scd *Scheduler) filterSupervisorChildApps() error {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(os.Getenv(envSupervisorApps), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[name] = true
+		}
+	}
+
+	apps := make([]*Application, 0, len(names))
+	adis := make([]*ApplicationDescInfo, 0, len(names))
+	for i, app := range scd.apps {
+		if names[app.Name] {
+			apps = append(apps, app)
+			adis = append(adis, scd.adis[i])
+			delete(names, app.Name)
+		}
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("supervisor child %v run not exists applications %v", os.Getenv(envSupervisorChild), names)
+	}
+
+	scd.apps = apps
+	scd.adis = adis
+	return scd.sortAppsByDependency()
+}
+
+// initSupervisor 检查子进程配置，父进程不运行app
+func (scd *Scheduler) initSupervisor() error {
+	names := make(map[string]bool, len(scd.apps))
+	apps := make(map[string]*Application, len(scd.apps))
+	for _, app := range scd.apps {
+		names[app.Name] = true
+		apps[app.Name] = app
+	}
+
+	tracePort, _ := strconv.Atoi(scd.globalBootFlag.TracePort)
+	assigned := make(map[string]bool)
+	childNames := make(map[string]bool)
+	for i, child := range scd.supervisorChildren {
+		if child.Name == "" || childNames[child.Name] {
+			return fmt.Errorf("supervisor child name %v is empty or duplicated", child.Name)
+		}
+		childNames[child.Name] = true
+		childApps := make(map[string]bool, len(child.Apps))
+		for _, name := range child.Apps {
+			if !names[name] {
+				return fmt.Errorf("supervisor child %v run not exists application %v", child.Name, name)
+			}
+			assigned[name] = true
+			childApps[name] = true
+		}
+		// app依赖的app必须在同一个子进程，否则子进程启动时才报错，父进程会不停重启子进程
+		for _, name := range child.Apps {
+			for _, dep := range apps[name].dependencies {
+				if !childApps[dep] {
+					return fmt.Errorf("supervisor child %v run application %v, but depends application %v not in the same child",
+						child.Name, name, dep)
+				}
+			}
+		}
+		if child.TracePort == 0 {
+			if tracePort == 0 {
+				return fmt.Errorf("supervisor child %v trace port must be set when parent trace port is %v",
+					child.Name, scd.globalBootFlag.TracePort)
+			}
+			child.TracePort = tracePort + i + 1
+		}
+	}
+	for name := range names {
+		if !assigned[name] {
+			log.Warnf("application[%v] not assigned to any supervisor child, will not run", name)
+		}
+	}
+
+	scd.apps = nil
+	scd.adis = nil
+	return nil
+}
+
+// runSupervisor 监督模式运行：启动所有子进程，崩溃的子进程按重启策略重启，转发退出、重载信号，
+// 父进程trace server的/metrics聚合所有子进程的指标
+func (scd *Scheduler) runSupervisor() error {
+	waitChan := make(chan error, len(scd.supervisorChildren)+1)
+
+	go func() {
+		log.Noticef("supervisor trace server listen on:%v", scd.server.Addr)
+		err := scd.server.Run()
+		if err != nil {
+			waitChan <- fmt.Errorf("trace server error:%v", err)
+		}
+	}()
+
+	childrenWg := new(sync.WaitGroup)
+	for _, child := range scd.supervisorChildren {
+		prom.RegisterGatherer("supervisor_child_"+child.Name, &childGatherer{child.Name, child.TracePort})
+		childrenWg.Add(1)
+		go func(child *supervisorChildProcess) {
+			defer childrenWg.Done()
+			err := scd.superviseChild(child)
+			if err != nil {
+				waitChan <- fmt.Errorf("supervisor child %v exit with error:%v", child.Name, err)
+			}
+		}(child)
+	}
+	allExitChan := make(chan struct{})
+	go func() {
+		childrenWg.Wait()
+		close(allExitChan)
+	}()
+
+	watchSignChan, reloadSignChan, upgradeSignChan := scd.watchSignals()
+
+	defer func() {
+		scd.Stop()
+		scd.stopChildren(childrenWg)
+	}()
+
+	for {
+		select {
+		case signal := <-watchSignChan:
+			log.Noticef("supervisor receive signal(%v), will graceful stop all children", signal)
+			return nil
+		case <-scd.stopChan:
+			return nil
+		case signal := <-reloadSignChan:
+			log.Noticef("supervisor receive signal(%v), will forward to all children", signal)
+			scd.signalChildren(syscall.SIGHUP)
+			err := scd.Reload()
+			if err != nil {
+				log.Errorf("reload boot config error:%v", err)
+			}
+		case signal := <-upgradeSignChan:
+			log.Warnf("supervisor receive signal(%v), supervisor mode not support upgrade, ignore", signal)
+		case <-allExitChan:
+			log.Noticef("supervisor all children exit")
+			return nil
+		case err := <-waitChan:
+			log.Errorf("supervisor stop with error:%v", err)
+			return err
+		}
+	}
+}
+
+// superviseChild 运行子进程，退出后按重启策略重启，调度器停止时返回nil，不再重启时返回最后的报错
+func (scd *Scheduler) superviseChild(child *supervisorChildProcess) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path error:%v", err)
+	}
+
+	restarts := 0
+	for {
+		startTime := time.Now()
+		err := scd.runChild(exe, child)
+		if scd.stopping() {
+			return nil
+		}
+
+		if time.Since(startTime) > scd.supervisorPolicy.maxBackoff() {
+			restarts = 0
+		}
+		if !scd.supervisorPolicy.shouldRestart(err, restarts) {
+			return err
+		}
+
+		backoff := scd.supervisorPolicy.backoff(restarts)
+		restarts++
+		child.setRestarts(restarts)
+		log.Warnf("supervisor child %v exit with error:%v, will restart after %v, restart times:%v", child.Name, err, backoff, restarts)
+
+		select {
+		case <-time.After(backoff):
+		case <-scd.stopChan:
+			return nil
+		}
+	}
+}
+
+func (scd *Scheduler) runChild(exe string, child *supervisorChildProcess) error {
+	// 同名参数后面的生效，覆盖父进程的trace端口
+	extra := append([]string{"-trace_port=" + strconv.Itoa(child.TracePort)}, child.Args...)
+	args := supervisorChildArgs(os.Args[1:], flags.Args(), extra)
+
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), envSupervisorChild+"="+child.Name, envSupervisorApps+"="+strings.Join(child.Apps, ","))
+	cmd.Env = append(cmd.Env, child.Env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	libsyscal.SetChildProcessDeathSignal(cmd)
+
+	child.lock.Lock()
+	// 调度器停止后不再启动子进程
+	if scd.stopping() {
+		child.lock.Unlock()
+		return nil
+	}
+	err := cmd.Start()
+	if err != nil {
+		child.lock.Unlock()
+		return fmt.Errorf("start child process error:%v", err)
+	}
+	child.cmd = cmd
+	child.state = "running"
+	child.lock.Unlock()
+
+	log.Noticef("supervisor child %v start with pid %v, apps:%v, trace port:%v", child.Name, cmd.Process.Pid, child.Apps, child.TracePort)
+	err = cmd.Wait()
+
+	child.lock.Lock()
+	child.cmd = nil
+	child.state = "exited"
+	if err != nil {
+		child.lastError = err.Error()
+	}
+	child.lock.Unlock()
+
+	log.Noticef("supervisor child %v pid %v exit, error:%v", child.Name, cmd.Process.Pid, err)
+	return err
+}
+
+// supervisorChildArgs 子进程的启动参数，追加的参数插在位置参数之前，flag解析遇到位置参数就停止，追加在后面不会生效
+// args:父进程的启动参数，positional:args解析后剩下的位置参数
+func supervisorChildArgs(args, positional, extra []string) []string {
+	if len(positional) > len(args) {
+		positional = nil
+	}
+	flagArgs := args[:len(args)-len(positional)]
+	if n := len(flagArgs); n > 0 && flagArgs[n-1] == "--" {
+		flagArgs = flagArgs[:n-1]
+	}
+
+	newArgs := append(append([]string{}, flagArgs...), extra...)
+	if len(positional) > 0 {
+		newArgs = append(append(newArgs, "--"), positional...)
+	}
+	return newArgs
+}
+
+func (scd *Scheduler) signalChildren(sig os.Signal) {
+	for _, child := range scd.supervisorChildren {
+		child.lock.Lock()
+		if child.cmd != nil {
+			err := child.cmd.Process.Signal(sig)
+			if err != nil {
+				log.Warnf("supervisor send signal %v to child %v error:%v", sig, child.Name, err)
+			}
+		}
+		child.lock.Unlock()
+	}
+}
+
+// stopChildren 给所有子进程发送SIGTERM，等待子进程优雅退出，超时kill
+func (scd *Scheduler) stopChildren(childrenWg *sync.WaitGroup) {
+	scd.signalChildren(syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		childrenWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(DefaultSupervisorStopTimeout):
+		log.Warnf("supervisor wait children exit timeout %v, kill them", DefaultSupervisorStopTimeout)
+		scd.signalChildren(syscall.SIGKILL)
+		<-done
+	}
+	log.Noticef("supervisor all children stopped")
+}
+
+func (c *supervisorChildProcess) setRestarts(restarts int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.restarts = restarts
+	c.state = "restarting"
+}
+
+func (c *supervisorChildProcess) info() *supervisorChildInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info := &supervisorChildInfo{
+		Name:      c.Name,
+		Apps:      c.Apps,
+		TracePort: c.TracePort,
+		State:     c.state,
+		Restarts:  c.restarts,
+		LastError: c.lastError,
+	}
+	if c.cmd != nil && c.cmd.Process != nil {
+		info.Pid = c.cmd.Process.Pid
+	}
+	return info
+}
+
+// childGatherer 拉取子进程trace server的/metrics，给所有指标加上supervisor_child标签
+type childGatherer struct {
+	name string
+	port int
+}
+
+var childGatherClient = &http.Client{Timeout: time.Second * 3}
+
+func (g *childGatherer) Gather() ([]*dto.MetricFamily, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), childGatherClient.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%v/metrics", g.port), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := childGatherClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gather supervisor child %v metrics error:%v", g.name, err)
+	}
+	defer resp.Body.Close()
+
+	parser := new(expfmt.TextParser)
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse supervisor child %v metrics error:%v", g.name, err)
+	}
+
+	labelName, labelValue := "supervisor_child", g.name
+	list := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		for _, m := range family.Metric {
+			m.Label = append(m.Label, &dto.LabelPair{Name: &labelName, Value: &labelValue})
+		}
+		list = append(list, family)
+	}
+	return list, nil
+}
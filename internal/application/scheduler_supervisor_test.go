@@ -0,0 +1,91 @@
+package application
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSupervisorAssignApps(t *testing.T) {
+	newScd := func() *Scheduler {
+		scd := NewScheduler(WithSchedulerSupervisor(
+			SupervisorChild{Name: "shard1", Apps: []string{"gateway", "db"}},
+			SupervisorChild{Name: "shard2", Apps: []string{"db"}, TracePort: 9000},
+		))
+		scd.apps = []*Application{newApp("gateway", WithAppDependsOn("db")), newApp("db"), newApp("analytics")}
+		scd.adis = make([]*ApplicationDescInfo, len(scd.apps))
+		for i, app := range scd.apps {
+			scd.adis[i] = NewApplicationDescInfo(app.Name, nil)
+		}
+		scd.globalBootFlag = &CommBootFlag{TracePort: "7788"}
+		return scd
+	}
+
+	scd := newScd()
+	if !scd.isSupervisor() {
+		t.Fatalf("scheduler expect supervisor mode")
+	}
+	if err := scd.initSupervisor(); err != nil {
+		t.Fatal(err)
+	}
+	if len(scd.apps) != 0 || scd.supervisorChildren[0].TracePort != 7789 || scd.supervisorChildren[1].TracePort != 9000 {
+		t.Fatalf("supervisor init error, apps:%v, ports:%v,%v", len(scd.apps),
+			scd.supervisorChildren[0].TracePort, scd.supervisorChildren[1].TracePort)
+	}
+
+	os.Setenv(envSupervisorChild, "shard1")
+	os.Setenv(envSupervisorApps, "gateway,db")
+	defer os.Unsetenv(envSupervisorChild)
+	defer os.Unsetenv(envSupervisorApps)
+
+	scd = newScd()
+	if scd.isSupervisor() {
+		t.Fatalf("supervisor child expect not supervisor mode")
+	}
+	if err := scd.filterSupervisorChildApps(); err != nil {
+		t.Fatal(err)
+	}
+	if len(scd.apps) != 2 || scd.apps[0].Name != "db" || scd.apps[1].Name != "gateway" {
+		t.Fatalf("supervisor child filter apps error:%v", len(scd.apps))
+	}
+
+	os.Setenv(envSupervisorApps, "gateway")
+	if err := newScd().filterSupervisorChildApps(); err == nil {
+		t.Fatalf("supervisor child app depends on app in other child expect error")
+	}
+}
+
+func TestSupervisorDependsInSameChild(t *testing.T) {
+	scd := NewScheduler(WithSchedulerSupervisor(
+		SupervisorChild{Name: "shard1", Apps: []string{"gateway"}},
+		SupervisorChild{Name: "shard2", Apps: []string{"db"}},
+	))
+	scd.apps = []*Application{newApp("gateway", WithAppDependsOn("db")), newApp("db")}
+	scd.globalBootFlag = &CommBootFlag{TracePort: "7788"}
+
+	if err := scd.initSupervisor(); err == nil {
+		t.Fatalf("supervisor child app depends on app in other child expect error")
+	}
+}
+
+func TestSupervisorChildArgs(t *testing.T) {
+	extra := []string{"-trace_port=7789", "-shard_id=1"}
+	cases := []struct {
+		args       []string
+		positional []string
+		expect     []string
+	}{
+		{nil, nil, extra},
+		{[]string{"-log_level=info"}, nil, []string{"-log_level=info", "-trace_port=7789", "-shard_id=1"}},
+		{[]string{"-log_level", "info", "start", "now"}, []string{"start", "now"},
+			[]string{"-log_level", "info", "-trace_port=7789", "-shard_id=1", "--", "start", "now"}},
+		{[]string{"-log_level=info", "--", "-x"}, []string{"-x"},
+			[]string{"-log_level=info", "-trace_port=7789", "-shard_id=1", "--", "-x"}},
+	}
+	for i, c := range cases {
+		got := supervisorChildArgs(c.args, c.positional, extra)
+		if strings.Join(got, " ") != strings.Join(c.expect, " ") {
+			t.Fatalf("case %v child args:%v, expect:%v", i, got, c.expect)
+		}
+	}
+}
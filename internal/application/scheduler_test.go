@@ -0,0 +1,150 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/xlkness/lkit-go/internal/log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testReloadConfig struct {
+	Rate     int    `yaml:"rate"`
+	LogLevel string `yaml:"log_level"`
+}
+
+func (c *testReloadConfig) GetLogLevel() string {
+	return c.LogLevel
+}
+
+func (c *testReloadConfig) Validate() error {
+	if c.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, not %v", c.Rate)
+	}
+	return nil
+}
+
+func TestSchedulerReloadSignal(t *testing.T) {
+	defer log.SetLogLevel(zerolog.GlobalLevel())
+
+	file := filepath.Join(t.TempDir(), "boot_config.yaml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("rate: 1\nlog_level: info\n")
+
+	lock := new(sync.Mutex)
+	var rates []int
+	adi := NewApplicationDescInfo("game", func(f *CommBootFlag, c interface{}, app *Application) error {
+		SubscribeBootConfig(app, "rate", func(conf *testReloadConfig) error {
+			lock.Lock()
+			rates = append(rates, conf.Rate)
+			lock.Unlock()
+			return nil
+		})
+		return nil
+	})
+
+	signals := make(chan os.Signal)
+	scd := NewScheduler(
+		WithSchedulerBootArgs([]string{"-trace_port=0", "-log_dir=" + t.TempDir(), "-boot_config_file=" + file}, nil),
+		WithSchedulerBootConfigFileContent(&testReloadConfig{}),
+		WithSchedulerSignals(signals),
+	).CreateApp(adi)
+	done := make(chan error, 1)
+	go func() {
+		done <- scd.Run()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := scd.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	old := scd.BootConfigFileContent().(*testReloadConfig)
+	if old.Rate != 1 || zerolog.GlobalLevel() != log.LogLevelStr2Enum["info"] {
+		t.Fatalf("boot config:%+v, log level:%v", old, zerolog.GlobalLevel())
+	}
+
+	current := func() *testReloadConfig {
+		return scd.BootConfigFileContent().(*testReloadConfig)
+	}
+	waitRate := func(expect int) {
+		for i := 0; i < 300 && current().Rate != expect; i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+		if current().Rate != expect {
+			t.Fatalf("boot config rate %v, expect %v", current().Rate, expect)
+		}
+	}
+
+	// SIGHUP重新读取配置文件，替换为新的结构体，重设日志等级，推送给app
+	writeConfig("rate: 5\nlog_level: error\n")
+	signals <- syscall.SIGHUP
+	waitRate(5)
+	if current() == old || old.Rate != 1 {
+		t.Fatalf("reload should replace boot config, old:%+v, new:%+v", old, current())
+	}
+	if zerolog.GlobalLevel() != log.LogLevelStr2Enum["error"] {
+		t.Fatalf("log level after reload:%v", zerolog.GlobalLevel())
+	}
+
+	// 校验失败保留旧配置，不推送给app
+	writeConfig("rate: -1\nlog_level: debug\n")
+	signals <- syscall.SIGHUP
+	time.Sleep(time.Millisecond * 200)
+	if current().Rate != 5 || zerolog.GlobalLevel() != log.LogLevelStr2Enum["error"] {
+		t.Fatalf("invalid reload changed boot config:%+v, log level:%v", current(), zerolog.GlobalLevel())
+	}
+	writeConfig("rate: 9\nlog_level: error\n")
+	signals <- syscall.SIGHUP
+	waitRate(9)
+
+	lock.Lock()
+	if len(rates) != 2 || rates[0] != 5 || rates[1] != 9 {
+		t.Fatalf("config reload callback rates:%v", rates)
+	}
+	lock.Unlock()
+
+	signals <- syscall.SIGTERM
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("scheduler not stop after signal")
+	}
+}
+
+func TestBootConfigJsonFileYamlTag(t *testing.T) {
+	type config struct {
+		MaxConn  int    `yaml:"max_conn"`
+		LogLevel string `yaml:"log_level"`
+	}
+	file := filepath.Join(t.TempDir(), "boot_config.json")
+	if err := os.WriteFile(file, []byte(`{"max_conn": 100, "log_level": "info"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scd := NewScheduler(WithSchedulerBootArgs(nil, nil))
+	scd.globalBootFlag.BootConfigFile = file
+
+	// .json文件默认按yaml解析，只有yaml tag的多单词字段也能读取
+	content, err := scd.loadBootConfigContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &config{}
+	if err = scd.parseBootConfigContent(content, conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.MaxConn != 100 || conf.LogLevel != "info" {
+		t.Fatalf("json boot config with yaml tag:%+v", conf)
+	}
+}
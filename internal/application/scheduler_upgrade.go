@@ -0,0 +1,141 @@
+package application
+
+import (
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/libsyscal"
+	"github.com/xlkness/lkit-go/internal/log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// envUpgradeReadyFd 热升级时新进程通知旧进程就绪的管道fd
+const envUpgradeReadyFd = "lkit_upgrade_ready_fd"
+
+// DefaultUpgradeReadyTimeout 热升级等待新进程所有app就绪的超时时间，超时杀掉新进程，旧进程继续服务
+var DefaultUpgradeReadyTimeout = time.Minute
+
+// Upgrade 热升级，启动新的二进制并把web服务、rpc服务、socket服务的监听fd传给新进程，
+// 新进程所有app就绪后返回nil，调用方再优雅停止旧进程；新进程启动失败、就绪前退出或者超时返回error，旧进程继续服务，
+// 等待期间调度器停止时杀掉新进程并返回error
+func (scd *Scheduler) Upgrade() error {
+	if scd.isSupervisor() || isSupervisorChild() {
+		return fmt.Errorf("supervisor mode not support upgrade")
+	}
+
+	keys, files, err := libsyscal.ListenerFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("create upgrade ready pipe error:%v", err)
+	}
+	defer readyReader.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		return fmt.Errorf("get executable error:%v", err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(upgradeFilterEnv(os.Environ()),
+		libsyscal.EnvInheritListeners+"="+strings.Join(keys, ","),
+		envUpgradeReadyFd+"="+strconv.Itoa(3+len(files)))
+	cmd.ExtraFiles = append(append([]*os.File{}, files...), readyWriter)
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("start new process %v error:%v", executable, err)
+	}
+	log.Noticef("upgrade start new process %v pid:%v, inherit listeners:%v", executable, cmd.Process.Pid, keys)
+
+	// 新进程就绪写入一个字节，就绪前退出读到EOF
+	readyChan := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyReader.Read(buf)
+		readyChan <- err
+	}()
+
+	timer := time.NewTimer(DefaultUpgradeReadyTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-readyChan:
+		if err != nil {
+			err = fmt.Errorf("new process pid:%v exit before ready:%v", cmd.Process.Pid, err)
+		}
+	case <-timer.C:
+		err = fmt.Errorf("wait new process pid:%v ready timeout:%v", cmd.Process.Pid, DefaultUpgradeReadyTimeout)
+	case <-scd.stopChan:
+		err = fmt.Errorf("scheduler is stopping, abort new process pid:%v", cmd.Process.Pid)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		go cmd.Wait()
+		return err
+	}
+
+	log.Noticef("upgrade new process pid:%v ready, old process will graceful stop", cmd.Process.Pid)
+	return nil
+}
+
+// markUpgrading 热升级成功后标记所有app，停止时rpc服务不从注册中心注销
+func (scd *Scheduler) markUpgrading() {
+	for _, app := range scd.getApps() {
+		atomic.StoreInt32(&app.isUpgrading, 1)
+	}
+}
+
+// notifyUpgradeReady 热升级启动的新进程等待所有app就绪后通知旧进程，并关闭没有用到的继承监听
+func (scd *Scheduler) notifyUpgradeReady() {
+	value := os.Getenv(envUpgradeReadyFd)
+	if value == "" {
+		return
+	}
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		log.Errorf("invalid upgrade ready fd %v:%v", value, err)
+		return
+	}
+	readyWriter := os.NewFile(uintptr(fd), "upgrade_ready")
+	defer readyWriter.Close()
+
+	for _, app := range scd.getApps() {
+		if !scd.waitAppReady(app.Name, scd.stopChan) {
+			return
+		}
+	}
+
+	libsyscal.CloseInheritedListeners()
+	_, err = readyWriter.Write([]byte{1})
+	if err != nil {
+		log.Errorf("notify upgrade ready error:%v", err)
+		return
+	}
+	log.Noticef("all applications ready, notify old process pid:%v", os.Getppid())
+}
+
+// upgradeFilterEnv 去掉当前进程继承来的热升级环境变量
+func upgradeFilterEnv(env []string) []string {
+	newEnv := make([]string, 0, len(env))
+	for _, v := range env {
+		if strings.HasPrefix(v, libsyscal.EnvInheritListeners+"=") || strings.HasPrefix(v, envUpgradeReadyFd+"=") {
+			continue
+		}
+		newEnv = append(newEnv, v)
+	}
+	return newEnv
+}
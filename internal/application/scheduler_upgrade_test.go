@@ -0,0 +1,91 @@
+package application
+
+import (
+	"github.com/xlkness/lkit-go/internal/libsyscal"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUpgradeFilterEnv(t *testing.T) {
+	env := upgradeFilterEnv([]string{
+		"PATH=/bin",
+		libsyscal.EnvInheritListeners + "=tcp::8080",
+		envUpgradeReadyFd + "=4",
+		libsyscal.EnvInheritListeners + "_x=keep",
+		"HOME=/root",
+	})
+	expect := []string{"PATH=/bin", libsyscal.EnvInheritListeners + "_x=keep", "HOME=/root"}
+	if len(env) != len(expect) {
+		t.Fatalf("filter env:%v, expect:%v", env, expect)
+	}
+	for i := range expect {
+		if env[i] != expect[i] {
+			t.Fatalf("filter env:%v, expect:%v", env, expect)
+		}
+	}
+}
+
+// newReadyPipe 模拟热升级新进程继承的就绪管道，返回旧进程读端
+func newReadyPipe(t *testing.T) *os.File {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(w.Fd()))
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envUpgradeReadyFd, strconv.Itoa(fd))
+	return r
+}
+
+func TestNotifyUpgradeReady(t *testing.T) {
+	app := newApp("game")
+	scd := NewScheduler()
+	scd.apps = []*Application{app}
+
+	r := newReadyPipe(t)
+	defer r.Close()
+	done := make(chan struct{})
+	go func() {
+		scd.notifyUpgradeReady()
+		close(done)
+	}()
+
+	// app就绪前不通知旧进程
+	select {
+	case <-done:
+		t.Fatalf("notify upgrade ready before application ready")
+	case <-time.After(time.Millisecond * 50):
+	}
+	app.readyOnce.Do(func() { close(app.readyChan) })
+
+	r.SetReadDeadline(time.Now().Add(time.Second * 5))
+	buf := make([]byte, 2)
+	n, err := io.ReadFull(r, buf)
+	if n != 1 || buf[0] != 1 || err != io.ErrUnexpectedEOF {
+		t.Fatalf("read upgrade ready:%v, error:%v", buf[:n], err)
+	}
+	<-done
+}
+
+func TestNotifyUpgradeReadyStopped(t *testing.T) {
+	scd := NewScheduler()
+	scd.apps = []*Application{newApp("game")}
+
+	// 就绪前停止，旧进程读到EOF，认为新进程启动失败
+	r := newReadyPipe(t)
+	defer r.Close()
+	go scd.notifyUpgradeReady()
+	scd.Stop()
+
+	r.SetReadDeadline(time.Now().Add(time.Second * 5))
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("read upgrade ready after stop:%v, error:%v", n, err)
+	}
+}
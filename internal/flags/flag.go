@@ -5,28 +5,260 @@ import (
 	"fmt"
 	"os"
 	"reflect"
-	"strconv"
-	"unsafe"
+	"sort"
+	"strings"
+	"sync"
 )
 
+// 启动参数值的来源，优先级从低到高
+const (
+	SourceDefault    = "default"
+	SourceConfigFile = "config_file"
+	SourceEnv        = "env"
+	SourceCli        = "cli"
+)
+
+// secretValueMask secret参数在Sources里显示的值
+const secretValueMask = "******"
+
+// FieldSource 启动参数最终生效的值和来源
+type FieldSource struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Desc   string `json:"desc"`
+}
+
+type fieldEntry struct {
+	key      string
+	desc     string
+	source   string
+	required bool     // 值必须来自配置文件、环境变量或命令行
+	enum     []string // 值必须为其中之一
+	secret   bool     // 值不能输出，Sources里显示为secretValueMask
+	value    *fieldValue
+}
+
+var (
+	fieldsLock  = new(sync.Mutex)
+	fields      = make([]*fieldEntry, 0)
+	commandLine = flag.CommandLine // 启动参数注册、解析的FlagSet
+	cliArgs     []string           // 为空解析os.Args[1:]
+	lookupEnv   = os.LookupEnv
+)
+
+// Reset 清空已注册的启动参数，之后用新的FlagSet解析args(不含程序名)，环境变量从env查找，
+// 用于测试在同一个进程里多次启动调度器，不影响全局flag.CommandLine和进程环境变量
+func Reset(args []string, env map[string]string) {
+	fieldsLock.Lock()
+	defer fieldsLock.Unlock()
+
+	fields = make([]*fieldEntry, 0)
+	commandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	cliArgs = append([]string{}, args...)
+	lookupEnv = func(key string) (string, bool) {
+		value, find := env[key]
+		return value, find
+	}
+}
+
 // ParseWithStructPointers 启动参数解析，如果启动参数没有指定，会去env里查找同名参数
 // flagStructPointers为结构体指针数组，tag描述如下：
 //
 //	type Flag struct {
 //			F1 `env:"f1" desc:"xxx" default:123`
+//			F2 `env:"f2" desc:"xxx" default:"info" enum:"debug|info"`
+//			F3 `env:"f3" desc:"xxx" required:"true"`
+//			F4 `env:"f4" desc:"xxx" secret:"true"` // token、密码等，Sources里不显示值
+//			Redis struct {
+//				Addr string `env:"addr" desc:"xxx"` // 参数名为redis.addr，环境变量也可以用redis_addr
+//			} `env:"redis"`
 //	}
-func ParseWithStructPointers(flagStructPointers ...interface{}) {
+//
+// 支持的字段类型见fieldValue，启动参数值的优先级从低到高为：tag默认值 -> 配置文件(ApplyConfigFileValues) -> 环境变量 -> 命令行，
+// 所有来源都应用后调用Validate校验required、enum
+func ParseWithStructPointers(flagStructPointers ...interface{}) error {
 
 	for _, st := range flagStructPointers {
-		flagParseStruct2Flags(st)
+		err := flagParseStruct2Flags(st)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := cliArgs
+	if args == nil {
+		args = os.Args[1:]
+	}
+	err := commandLine.Parse(args)
+	if err != nil {
+		return fmt.Errorf("parse command line error:%v", err)
+	}
+
+	cliFlags := make(map[string]bool)
+	commandLine.Visit(func(f *flag.Flag) {
+		cliFlags[f.Name] = true
+	})
+
+	fieldsLock.Lock()
+	defer fieldsLock.Unlock()
+	for _, f := range fields {
+		if cliFlags[f.key] {
+			f.source = SourceCli
+			continue
+		}
+		value, find := lookupEnv(f.key)
+		if !find {
+			value, find = lookupEnv(strings.ReplaceAll(f.key, ".", "_"))
+		}
+		if !find {
+			continue
+		}
+		err := commandLine.Set(f.key, value)
+		if err != nil {
+			return fmt.Errorf("parse flag %v from env value %v error:%v", f.key, value, err)
+		}
+		f.source = SourceEnv
+	}
+
+	return nil
+}
+
+// Args 命令行解析后剩下的位置参数，ParseWithStructPointers之后调用
+func Args() []string {
+	return commandLine.Args()
+}
+
+// ApplyConfigFileValues 用配置文件里的值覆盖还是tag默认值的启动参数，命令行、环境变量指定的参数不会被覆盖，
+// values的key为启动参数名，嵌套的配置用"."连接，可以用FlattenConfigValues生成
+func ApplyConfigFileValues(values map[string]string) error {
+	fieldsLock.Lock()
+	defer fieldsLock.Unlock()
+	for _, f := range fields {
+		if f.source != SourceDefault {
+			continue
+		}
+		value, find := values[f.key]
+		if !find && f.value.isMap() {
+			value, find = collectMapConfigValues(f.key, values)
+		}
+		if !find {
+			continue
+		}
+		err := commandLine.Set(f.key, value)
+		if err != nil {
+			return fmt.Errorf("parse flag %v from config file value %v error:%v", f.key, value, err)
+		}
+		f.source = SourceConfigFile
+	}
+	return nil
+}
+
+// collectMapConfigValues map类型的启动参数在配置文件里是嵌套配置，展开后为"key.k1"，合并为"k1=v1,k2=v2"
+func collectMapConfigValues(key string, values map[string]string) (string, bool) {
+	var list []string
+	for k, v := range values {
+		if strings.HasPrefix(k, key+".") {
+			list = append(list, strings.TrimPrefix(k, key+".")+"="+v)
+		}
+	}
+	if len(list) == 0 {
+		return "", false
+	}
+	sort.Strings(list)
+	return strings.Join(list, ","), true
+}
+
+// Validate 校验required的启动参数是否都指定了，enum的启动参数值是否合法，错误信息包含所有不合法的参数
+func Validate() error {
+	fieldsLock.Lock()
+	defer fieldsLock.Unlock()
+	var errs []string
+	for _, f := range fields {
+		if f.required && f.source == SourceDefault {
+			errs = append(errs, fmt.Sprintf("flag %v is required, set it by cli, env or config file", f.key))
+			continue
+		}
+		if len(f.enum) > 0 {
+			value := f.value.String()
+			isValid := false
+			for _, v := range f.enum {
+				if v == value {
+					isValid = true
+					break
+				}
+			}
+			if !isValid {
+				errs = append(errs, fmt.Sprintf("flag %v value %v invalid, must be one of %v", f.key, value, strings.Join(f.enum, "|")))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("validate flags error:%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// FlattenConfigValues 将配置文件解析出的嵌套map展开为"a.b"形式的key，值转换为字符串，数组用","连接
+func FlattenConfigValues(content map[string]interface{}) map[string]string {
+	values := make(map[string]string)
+	flattenConfigValues("", content, values)
+	return values
+}
+
+func flattenConfigValues(prefix string, content map[string]interface{}, values map[string]string) {
+	for k, v := range content {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v1 := v.(type) {
+		case map[string]interface{}:
+			flattenConfigValues(key, v1, values)
+		case map[interface{}]interface{}:
+			m := make(map[string]interface{}, len(v1))
+			for k2, v2 := range v1 {
+				m[fmt.Sprint(k2)] = v2
+			}
+			flattenConfigValues(key, m, values)
+		case []interface{}:
+			str := ""
+			for i, v2 := range v1 {
+				if i > 0 {
+					str += ","
+				}
+				str += fmt.Sprint(v2)
+			}
+			values[key] = str
+		case nil:
+		default:
+			values[key] = fmt.Sprint(v1)
+		}
 	}
+}
 
-	flag.Parse()
+// Sources 所有启动参数最终生效的值和来源，按参数名排序，secret参数有值时只显示掩码
+func Sources() []*FieldSource {
+	fieldsLock.Lock()
+	defer fieldsLock.Unlock()
+	list := make([]*FieldSource, 0, len(fields))
+	for _, f := range fields {
+		fs := &FieldSource{Key: f.key, Source: f.source, Desc: f.desc}
+		if fl := commandLine.Lookup(f.key); fl != nil {
+			fs.Value = fl.Value.String()
+		}
+		if f.secret && fs.Value != "" {
+			fs.Value = secretValueMask
+		}
+		list = append(list, fs)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
 }
 
-func flagParseStruct2Flags(st interface{}) {
+func flagParseStruct2Flags(st interface{}) error {
 	if st == nil {
-		return
+		return nil
 	}
 
 	var stTo = reflect.TypeOf(st)
@@ -38,9 +270,17 @@ func flagParseStruct2Flags(st interface{}) {
 	// case reflect.Struct:
 	// 	break
 	default:
-		panic(fmt.Errorf("invalid flags parse struct(%+v), must be pointer or struct", st))
+		return fmt.Errorf("invalid flags parse struct(%+v), must be pointer or struct", st)
+	}
+	if stTo.Kind() != reflect.Struct {
+		return fmt.Errorf("invalid flags parse struct(%+v), must be pointer or struct", st)
 	}
 
+	return flagParseStructFields("", stTo, stVo)
+}
+
+// flagParseStructFields 注册结构体字段为启动参数，嵌套结构体的字段名为"父字段名.字段名"
+func flagParseStructFields(prefix string, stTo reflect.Type, stVo reflect.Value) error {
 	for i := 0; i < stTo.NumField(); i++ {
 		field := stTo.Field(i)
 
@@ -48,33 +288,60 @@ func flagParseStruct2Flags(st interface{}) {
 		if !find {
 			continue
 		}
+		key = prefix + key
 
-		desc := field.Tag.Get("desc")
+		fieldVo := stVo.Field(i)
+		if field.Type.Kind() == reflect.Struct && !reflect.PtrTo(field.Type).Implements(textUnmarshalerType) {
+			err := flagParseStructFields(key+".", field.Type, fieldVo)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 
-		defaultValue, find := os.LookupEnv(key)
-		if !find {
-			defaultValue, find = field.Tag.Lookup("default")
-			if !find {
-				defaultValue = fmt.Sprintf("not_found_env_%v", key)
+		value, err := newFieldValue(fieldVo)
+		if err != nil {
+			return fmt.Errorf("parse flag %v error:%v", key, err)
+		}
+
+		defaultValue, find := field.Tag.Lookup("default")
+		if !find && field.Type.Kind() == reflect.String {
+			defaultValue = fmt.Sprintf("not_found_env_%v", key)
+		}
+		if defaultValue != "" {
+			err = value.Set(defaultValue)
+			if err != nil {
+				return fmt.Errorf("parse flag %v default value %v error:%v", key, defaultValue, err)
 			}
 		}
 
-		var fieldValuePointer = unsafe.Pointer(stVo.Field(i).Addr().Pointer())
-		switch field.Type.Kind() {
-		case reflect.String:
-			flag.StringVar((*string)(fieldValuePointer), key, defaultValue, desc)
-		case reflect.Int:
-			defaultValue1, _ := strconv.Atoi(defaultValue)
-			flag.IntVar((*int)(fieldValuePointer), key, defaultValue1, desc)
-		case reflect.Int64:
-			defaultValue1, _ := strconv.ParseInt(defaultValue, 10, 64)
-			flag.Int64Var((*int64)(fieldValuePointer), key, defaultValue1, desc)
-		case reflect.Bool:
-			flag.BoolVar((*bool)(fieldValuePointer), key, defaultValue == "true", desc)
-		default:
-			panic(fmt.Errorf("parse flag kind invalid,must be string/int/int64/bool, not %+v", field.Type.Kind()))
+		var enum []string
+		if enumStr := field.Tag.Get("enum"); enumStr != "" {
+			enum = strings.Split(enumStr, "|")
 		}
+
+		desc := field.Tag.Get("desc")
+		if len(enum) > 0 {
+			desc += fmt.Sprintf(" (%v)", strings.Join(enum, "|"))
+		}
+
+		if commandLine.Lookup(key) != nil {
+			return fmt.Errorf("parse flag %v error:flag redefined", key)
+		}
+		commandLine.Var(value, key, desc)
+
+		fieldsLock.Lock()
+		fields = append(fields, &fieldEntry{
+			key:      key,
+			desc:     desc,
+			source:   SourceDefault,
+			required: field.Tag.Get("required") == "true",
+			enum:     enum,
+			secret:   field.Tag.Get("secret") == "true",
+			value:    value,
+		})
+		fieldsLock.Unlock()
 	}
 
-	return
+	return nil
 }
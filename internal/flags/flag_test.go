@@ -0,0 +1,151 @@
+package flags
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLayered(t *testing.T) {
+	type Flag struct {
+		Addr    string `env:"layered_addr" desc:"listen addr" default:"0.0.0.0:80"`
+		Num     int    `env:"layered_num" desc:"number" default:"1"`
+		Debug   bool   `env:"layered_debug" desc:"debug mode" default:"false"`
+		Missing string `env:"layered_missing" desc:"not in any source" default:"def"`
+	}
+
+	os.Setenv("layered_num", "3")
+	defer os.Unsetenv("layered_num")
+
+	f := &Flag{}
+	err := ParseWithStructPointers(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := FlattenConfigValues(map[string]interface{}{
+		"layered_addr":  "127.0.0.1:8080",
+		"layered_num":   5,
+		"layered_debug": true,
+		"redis":         map[string]interface{}{"addr": "127.0.0.1:6379"},
+	})
+	if values["redis.addr"] != "127.0.0.1:6379" {
+		t.Fatalf("flatten nested config error:%+v", values)
+	}
+
+	err = ApplyConfigFileValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Addr != "127.0.0.1:8080" || f.Num != 3 || !f.Debug || f.Missing != "def" {
+		t.Fatalf("layered flag value error:%+v", f)
+	}
+
+	expectSources := map[string]string{
+		"layered_addr":    SourceConfigFile,
+		"layered_num":     SourceEnv,
+		"layered_debug":   SourceConfigFile,
+		"layered_missing": SourceDefault,
+	}
+	for _, fs := range Sources() {
+		if expect, find := expectSources[fs.Key]; find && fs.Source != expect {
+			t.Fatalf("flag %v source expect %v, got %v", fs.Key, expect, fs.Source)
+		}
+	}
+}
+
+type testTextFlag struct {
+	host, port string
+}
+
+func (t *testTextFlag) UnmarshalText(text []byte) error {
+	kv := strings.SplitN(string(text), ":", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("invalid host:port %v", string(text))
+	}
+	t.host, t.port = kv[0], kv[1]
+	return nil
+}
+
+func TestParseRichTypes(t *testing.T) {
+	type Flag struct {
+		Timeout time.Duration     `env:"rich_timeout" desc:"timeout" default:"3s"`
+		Ratio   float64           `env:"rich_ratio" desc:"ratio" default:"0.5"`
+		Port    uint16            `env:"rich_port" desc:"port" default:"8080"`
+		Tags    []string          `env:"rich_tags" desc:"tags" default:"a,b"`
+		Labels  map[string]string `env:"rich_labels" desc:"labels" default:"zone=cn"`
+		Addr    testTextFlag      `env:"rich_addr" desc:"addr" default:"127.0.0.1:80"`
+		Mode    string            `env:"rich_mode" desc:"mode" default:"dev" enum:"dev|prod"`
+		Redis   struct {
+			Addr string `env:"addr" desc:"redis addr" required:"true"`
+			DB   int    `env:"db" desc:"redis db" default:"1"`
+		} `env:"rich_redis"`
+	}
+
+	f := &Flag{}
+	err := ParseWithStructPointers(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Validate(); err == nil || !strings.Contains(err.Error(), "rich_redis.addr") {
+		t.Fatalf("required flag expect error, got %v", err)
+	}
+
+	err = ApplyConfigFileValues(FlattenConfigValues(map[string]interface{}{
+		"rich_timeout": "1m",
+		"rich_tags":    []interface{}{"x", "y", "z"},
+		"rich_labels":  map[string]interface{}{"zone": "us", "shard": 3},
+		"rich_mode":    "test",
+		"rich_redis":   map[string]interface{}{"addr": "127.0.0.1:6379"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Validate(); err == nil || !strings.Contains(err.Error(), "rich_mode") {
+		t.Fatalf("enum flag expect error, got %v", err)
+	}
+
+	if f.Timeout != time.Minute || f.Ratio != 0.5 || f.Port != 8080 || strings.Join(f.Tags, ",") != "x,y,z" ||
+		f.Labels["zone"] != "us" || f.Labels["shard"] != "3" || f.Addr.host != "127.0.0.1" ||
+		f.Redis.Addr != "127.0.0.1:6379" || f.Redis.DB != 1 {
+		t.Fatalf("rich flag value error:%+v", f)
+	}
+
+	type InvalidFlag struct {
+		Ch chan int `env:"rich_invalid_chan" desc:"chan"`
+	}
+	if err := ParseWithStructPointers(&InvalidFlag{}); err == nil {
+		t.Fatalf("not support flag type expect error")
+	}
+}
+
+func TestSourcesSecret(t *testing.T) {
+	type Flag struct {
+		Token string `env:"secret_token" desc:"token" default:"" secret:"true"`
+		Empty string `env:"secret_empty" desc:"empty token" default:"" secret:"true"`
+	}
+
+	os.Setenv("secret_token", "abc123")
+	defer os.Unsetenv("secret_token")
+
+	f := &Flag{}
+	if err := ParseWithStructPointers(f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Token != "abc123" {
+		t.Fatalf("secret flag value error:%+v", f)
+	}
+
+	// secret参数有值时只显示掩码，空值原样显示
+	expectValues := map[string]string{"secret_token": secretValueMask, "secret_empty": ""}
+	for _, fs := range Sources() {
+		if expect, find := expectValues[fs.Key]; find && fs.Value != expect {
+			t.Fatalf("flag %v value expect %q, got %q", fs.Key, expect, fs.Value)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package flags
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// fieldValue 用反射把启动参数结构体字段包装为flag.Value，支持：
+// string、bool、int/int8~int64、uint/uint8~uint64、float32/float64、time.Duration、
+// []string(逗号分隔)、map[string]string(k1=v1,k2=v2)、实现encoding.TextUnmarshaler的类型
+type fieldValue struct {
+	v reflect.Value
+}
+
+// newFieldValue 检查字段类型是否支持，不支持返回错误
+func newFieldValue(v reflect.Value) (*fieldValue, error) {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return &fieldValue{v}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &fieldValue{v}, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return &fieldValue{v}, nil
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.String {
+			return &fieldValue{v}, nil
+		}
+	}
+	return nil, fmt.Errorf("not support flag type %v", v.Type())
+}
+
+func (fv *fieldValue) isMap() bool {
+	return fv.v.Kind() == reflect.Map
+}
+
+// IsBoolFlag bool类型的命令行参数可以只写-name不带值
+func (fv *fieldValue) IsBoolFlag() bool {
+	return fv.v.Kind() == reflect.Bool
+}
+
+func (fv *fieldValue) Set(s string) error {
+	if fv.v.CanAddr() && fv.v.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	if fv.v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.v.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.v.Kind() {
+	case reflect.String:
+		fv.v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, fv.v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 0, fv.v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.v.SetFloat(f)
+	case reflect.Slice:
+		list := reflect.MakeSlice(fv.v.Type(), 0, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(fv.v.Type().Elem()))
+			}
+		}
+		fv.v.Set(list)
+	case reflect.Map:
+		m := reflect.MakeMap(fv.v.Type())
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid map item %v, must be k=v", item)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(kv[0])).Convert(fv.v.Type().Key()),
+				reflect.ValueOf(strings.TrimSpace(kv[1])).Convert(fv.v.Type().Elem()))
+		}
+		fv.v.Set(m)
+	}
+	return nil
+}
+
+func (fv *fieldValue) String() string {
+	// flag包会用零值的fieldValue调用String判断默认值
+	if fv == nil || !fv.v.IsValid() {
+		return ""
+	}
+
+	if fv.v.CanAddr() {
+		if m, ok := fv.v.Addr().Interface().(encoding.TextMarshaler); ok {
+			text, err := m.MarshalText()
+			if err != nil {
+				return ""
+			}
+			return string(text)
+		}
+	}
+
+	switch fv.v.Kind() {
+	case reflect.Slice:
+		list := make([]string, 0, fv.v.Len())
+		for i := 0; i < fv.v.Len(); i++ {
+			list = append(list, fv.v.Index(i).String())
+		}
+		return strings.Join(list, ",")
+	case reflect.Map:
+		list := make([]string, 0, fv.v.Len())
+		iter := fv.v.MapRange()
+		for iter.Next() {
+			list = append(list, iter.Key().String()+"="+iter.Value().String())
+		}
+		sort.Strings(list)
+		return strings.Join(list, ",")
+	}
+	return fmt.Sprint(fv.v.Interface())
+}
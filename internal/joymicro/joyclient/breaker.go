@@ -0,0 +1,351 @@
+package joyclient
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/smallnest/rpcx/client"
+)
+
+// BreakerConfig 节点熔断配置，统计窗口内错误率或慢调用比例超过阈值时熔断节点，
+// 熔断OpenTimeout后进入半开状态放行少量探测请求，探测全部成功恢复，有失败继续熔断
+type BreakerConfig struct {
+	Window         time.Duration // 统计窗口
+	MinRequests    int           // 窗口内请求数达到后才判断是否熔断
+	ErrorRate      float64       // 错误率阈值，服务返回的业务错误不算
+	SlowCallTime   time.Duration // 调用耗时超过算慢调用
+	SlowRate       float64       // 慢调用比例阈值，为0时不按耗时熔断
+	OpenTimeout    time.Duration // 熔断后多久进入半开状态
+	HalfOpenProbes int           // 半开状态放行的探测请求数
+}
+
+// DefaultBreakerConfig JoyClient默认的节点熔断配置
+var DefaultBreakerConfig = BreakerConfig{
+	Window:         time.Second * 10,
+	MinRequests:    20,
+	ErrorRate:      0.5,
+	SlowCallTime:   time.Second * 3,
+	SlowRate:       0.8,
+	OpenTimeout:    time.Second * 5,
+	HalfOpenProbes: 3,
+}
+
+// breakerSelectTries 选中熔断节点时重新选择的次数
+const breakerSelectTries = 5
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var (
+	breakerMetricsOnce          = new(sync.Once)
+	breakerStateGauge           *prom.PromeGaugeStatMgr
+	retryBudgetExhaustedCounter *prom.PromeCounterStatMgr
+)
+
+func initBreakerMetrics() {
+	breakerMetricsOnce.Do(func() {
+		breakerStateGauge = prom.NewGauge("rpc_client_breaker_state").InitLabels([]string{"service", "node"})
+		retryBudgetExhaustedCounter = prom.NewCounter("rpc_client_retry_budget_exhausted_total").InitLabels([]string{"service"})
+	})
+}
+
+// nodeBreaker 一个节点的熔断器
+type nodeBreaker struct {
+	cfg         *BreakerConfig
+	lock        *sync.Mutex
+	state       breakerState
+	windowStart time.Time
+	total       int
+	errors      int
+	slows       int
+	openedAt    time.Time
+	probes      int // 半开状态已放行的探测请求数
+	successes   int // 半开状态成功的探测请求数
+	gauge       prometheus.Gauge
+}
+
+// allow 是否可以调用节点，半开状态只放行HalfOpenProbes个探测请求
+func (b *nodeBreaker) allow(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.probes, b.successes = 0, 0
+		fallthrough
+	case breakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// record 记录一次调用结果，ignore为true时(例如调用方取消)不计入统计
+func (b *nodeBreaker) record(now time.Time, failed, ignore bool, latency time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerHalfOpen:
+		if ignore {
+			b.probes--
+			return
+		}
+		if failed || latency >= b.cfg.SlowCallTime {
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(breakerClosed)
+			b.resetWindow(now)
+		}
+	case breakerClosed:
+		if ignore {
+			return
+		}
+		if now.Sub(b.windowStart) >= b.cfg.Window {
+			b.resetWindow(now)
+		}
+		b.total++
+		if failed {
+			b.errors++
+		}
+		if latency >= b.cfg.SlowCallTime {
+			b.slows++
+		}
+		if b.total < b.cfg.MinRequests {
+			return
+		}
+		if float64(b.errors)/float64(b.total) >= b.cfg.ErrorRate ||
+			(b.cfg.SlowRate > 0 && float64(b.slows)/float64(b.total) >= b.cfg.SlowRate) {
+			b.open(now)
+		}
+	}
+}
+
+func (b *nodeBreaker) open(now time.Time) {
+	b.setState(breakerOpen)
+	b.openedAt = now
+}
+
+func (b *nodeBreaker) resetWindow(now time.Time) {
+	b.windowStart = now
+	b.total, b.errors, b.slows = 0, 0, 0
+}
+
+func (b *nodeBreaker) setState(state breakerState) {
+	b.state = state
+	if b.gauge != nil {
+		b.gauge.Set(float64(state))
+	}
+}
+
+// breakers 一个服务所有节点的熔断器
+type breakers struct {
+	service string
+	cfg     BreakerConfig
+	lock    *sync.Mutex
+	nodes   map[string]*nodeBreaker
+}
+
+func newBreakers(service string, cfg BreakerConfig) *breakers {
+	initBreakerMetrics()
+	return &breakers{
+		service: service,
+		cfg:     cfg,
+		lock:    new(sync.Mutex),
+		nodes:   make(map[string]*nodeBreaker),
+	}
+}
+
+func (bs *breakers) get(node string) *nodeBreaker {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	b := bs.nodes[node]
+	if b == nil {
+		b = &nodeBreaker{cfg: &bs.cfg, lock: new(sync.Mutex), windowStart: time.Now(),
+			gauge: breakerStateGauge.LabelValues(bs.service, node)}
+		b.gauge.Set(float64(breakerClosed))
+		bs.nodes[node] = b
+	}
+	return b
+}
+
+// record 记录节点的调用结果，服务返回的业务错误不算失败，过载错误算失败，调用方取消的调用不统计
+func (bs *breakers) record(node string, err error, latency time.Duration) {
+	_, isServiceError := err.(client.ServiceError)
+	failed := err != nil && (!isServiceError || IsOverloaded(err))
+	ignore := err == context.Canceled || err == client.ErrBreakerOpen
+	bs.get(node).record(time.Now(), failed, ignore, latency)
+}
+
+// DefaultRetryBudgetRatio 默认失败重试占调用数的最大比例
+const DefaultRetryBudgetRatio = 0.1
+
+// DefaultRetryBudgetMinPerSecond 默认每秒至少允许的重试次数，避免调用量小时不能重试
+const DefaultRetryBudgetMinPerSecond = 10
+
+// retryBudget 全局重试预算，所有JoyClient共享，每次调用存入ratio个令牌，每次重试消耗一个，
+// 每秒前minPerSecond次重试不消耗令牌
+type retryBudget struct {
+	lock          *sync.Mutex
+	ratio         float64
+	minPerSecond  int
+	tokens        float64
+	second        int64
+	secondRetries int
+}
+
+var globalRetryBudget = &retryBudget{
+	lock:         new(sync.Mutex),
+	ratio:        DefaultRetryBudgetRatio,
+	minPerSecond: DefaultRetryBudgetMinPerSecond,
+}
+
+// SetRetryBudget 设置全局重试预算
+// ratio:失败重试占调用数的最大比例，例如0.1
+// minPerSecond:每秒至少允许的重试次数
+func SetRetryBudget(ratio float64, minPerSecond int) {
+	globalRetryBudget.lock.Lock()
+	defer globalRetryBudget.lock.Unlock()
+	globalRetryBudget.ratio = ratio
+	globalRetryBudget.minPerSecond = minPerSecond
+}
+
+func (rb *retryBudget) deposit() {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	// 令牌上限为最近1000次调用的重试数，避免长时间正常后积累太多
+	rb.tokens += rb.ratio
+	if max := rb.ratio * 1000; rb.tokens > max {
+		rb.tokens = max
+	}
+}
+
+func (rb *retryBudget) withdraw(now time.Time) bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	if second := now.Unix(); second != rb.second {
+		rb.second, rb.secondRetries = second, 0
+	}
+	if rb.secondRetries < rb.minPerSecond {
+		rb.secondRetries++
+		return true
+	}
+	if rb.tokens >= 1 {
+		rb.tokens--
+		return true
+	}
+	return false
+}
+
+type callAttemptsKey struct{}
+
+// callAttempts 一次调用的所有尝试，记录当前调用的节点，用于统计熔断和重试预算
+type callAttempts struct {
+	lock            sync.Mutex
+	selects         int
+	maxRetries      int    // 最多重试次数，rpcx的Retries为MaxRetries，实际次数在这里限制
+	node            string // 当前尝试调用的节点，调用结束后清空
+	peer            string // 最近一次选中的节点，用于调用监控
+	start           time.Time
+	rejected        bool // 有节点因为熔断被跳过
+	budgetExhausted bool
+}
+
+// finish 结束当前节点的尝试并记录熔断统计
+func (a *callAttempts) finish(bs *breakers, err error) {
+	a.lock.Lock()
+	node, start := a.node, a.start
+	a.node = ""
+	a.lock.Unlock()
+	if node != "" && bs != nil {
+		bs.record(node, err, time.Since(start))
+	}
+}
+
+// breakerPlugin 客户端插件，选择节点时跳过熔断的节点、重试时检查全局重试预算，调用结束统计节点的熔断
+type breakerPlugin struct {
+	s *Service
+}
+
+func (p *breakerPlugin) WrapSelect(fn client.SelectFunc) client.SelectFunc {
+	return func(ctx context.Context, servicePath, serviceMethod string, args interface{}) string {
+		a, _ := ctx.Value(callAttemptsKey{}).(*callAttempts)
+		bs := p.s.getBreakers()
+		if a == nil {
+			return fn(ctx, servicePath, serviceMethod, args)
+		}
+		// 上一次尝试没有调用到节点(例如连接失败)，记为失败
+		if bs != nil {
+			a.finish(bs, client.ErrServerUnavailable)
+		}
+
+		// rpcx的Failover在最后一次尝试失败后还会再选择一次节点，超过重试次数的选择直接返回，
+		// 不消耗重试预算和半开状态的探测请求。没有开启熔断时也检查重试预算
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if a.budgetExhausted || a.selects > a.maxRetries {
+			return ""
+		}
+		if a.selects > 0 {
+			if !globalRetryBudget.withdraw(time.Now()) {
+				a.budgetExhausted = true
+				retryBudgetExhaustedCounter.LabelValues(p.s.ServiceName).Inc()
+				return ""
+			}
+		} else {
+			globalRetryBudget.deposit()
+		}
+		a.selects++
+
+		if bs == nil {
+			a.peer = fn(ctx, servicePath, serviceMethod, args)
+			return a.peer
+		}
+
+		for i := 0; i < breakerSelectTries; i++ {
+			node := fn(ctx, servicePath, serviceMethod, args)
+			if node == "" {
+				return ""
+			}
+			if bs.get(node).allow(time.Now()) {
+				a.node, a.peer, a.start = node, node, time.Now()
+				return node
+			}
+			a.rejected = true
+		}
+		return ""
+	}
+}
+
+func (p *breakerPlugin) PreCall(ctx context.Context, servicePath, serviceMethod string, args interface{}) error {
+	if a, ok := ctx.Value(callAttemptsKey{}).(*callAttempts); ok {
+		a.lock.Lock()
+		a.start = time.Now()
+		a.lock.Unlock()
+	}
+	return nil
+}
+
+func (p *breakerPlugin) PostCall(ctx context.Context, servicePath, serviceMethod string, args interface{}, reply interface{}, err error) error {
+	if a, ok := ctx.Value(callAttemptsKey{}).(*callAttempts); ok {
+		a.finish(p.s.getBreakers(), err)
+	}
+	return err
+}
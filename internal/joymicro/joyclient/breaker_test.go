@@ -0,0 +1,176 @@
+package joyclient
+
+import (
+	"context"
+	"errors"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNodeBreaker(t *testing.T) {
+	cfg := BreakerConfig{Window: time.Second * 10, MinRequests: 4, ErrorRate: 0.5, SlowCallTime: time.Second,
+		OpenTimeout: time.Second, HalfOpenProbes: 2}
+	bs := newBreakers("test_breaker", cfg)
+	b := bs.get("tcp@127.0.0.1:8001")
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		b.record(now, i%2 == 0, false, time.Millisecond)
+	}
+	if b.state != breakerOpen || b.allow(now) {
+		t.Fatalf("breaker should open, state:%v", b.state)
+	}
+
+	// 半开状态只放行2个探测请求，探测失败继续熔断
+	now = now.Add(time.Second)
+	if !b.allow(now) || !b.allow(now) || b.allow(now) {
+		t.Fatal("half open breaker probes error")
+	}
+	b.record(now, true, false, time.Millisecond)
+	if b.state != breakerOpen {
+		t.Fatalf("breaker should reopen, state:%v", b.state)
+	}
+
+	// 探测全部成功后恢复
+	now = now.Add(time.Second)
+	b.allow(now)
+	b.allow(now)
+	b.record(now, false, false, time.Millisecond)
+	b.record(now, false, false, time.Millisecond)
+	if b.state != breakerClosed || !b.allow(now) {
+		t.Fatalf("breaker should close, state:%v", b.state)
+	}
+
+	// 调用错误计入失败
+	for i := 0; i < 4; i++ {
+		bs.record("tcp@127.0.0.1:8002", errors.New("timeout"), time.Millisecond)
+	}
+	if bs.get("tcp@127.0.0.1:8002").state != breakerOpen {
+		t.Fatal("breaker should open by errors")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	rb := &retryBudget{lock: globalRetryBudget.lock, ratio: 0.1, minPerSecond: 1}
+	now := time.Now()
+	if !rb.withdraw(now) || rb.withdraw(now) {
+		t.Fatal("retry budget min per second error")
+	}
+	for i := 0; i < 25; i++ {
+		rb.deposit()
+	}
+	if !rb.withdraw(now) || !rb.withdraw(now) || rb.withdraw(now) {
+		t.Fatalf("retry budget ratio error, tokens:%v", rb.tokens)
+	}
+}
+
+// startBrokenNodes 启动接受连接后立即关闭的节点，调用返回连接错误，Failover会重试其它节点
+func startBrokenNodes(t *testing.T, n int) []string {
+	var addrs []string
+	for i := 0; i < n; i++ {
+		// 监听后马上关闭，连接节点失败，rpcx不会启动连接的读协程
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, ln.Addr().String())
+		ln.Close()
+	}
+	return addrs
+}
+
+func TestBreakerRecordsCalledNodesOnly(t *testing.T) {
+	// 重试预算是全局的，多次运行测试时不能因为预算耗尽少重试
+	SetRetryBudget(DefaultRetryBudgetRatio, 1000)
+	defer SetRetryBudget(DefaultRetryBudgetRatio, DefaultRetryBudgetMinPerSecond)
+
+	r := registry.NewStaticRegistry(map[string][]string{"breaker_test": startBrokenNodes(t, 2)})
+	c := New("breaker_test", r, time.Second*3, false)
+	c.SetBreakerConfig(&BreakerConfig{Window: time.Minute, MinRequests: 100, ErrorRate: 0.5,
+		SlowCallTime: time.Minute, OpenTimeout: time.Minute, HalfOpenProbes: 1})
+
+	total := func() int {
+		bs := c.getBreakers()
+		bs.lock.Lock()
+		defer bs.lock.Unlock()
+		sum := 0
+		for _, b := range bs.nodes {
+			b.lock.Lock()
+			sum += b.total
+			b.lock.Unlock()
+		}
+		return sum
+	}
+
+	// Failover最后一次失败后多出的一次选择不计入节点的统计
+	for i, retries := range []int{1, 0, -1} {
+		before := total()
+		var opts []CallOption
+		expect := DefaultRetries + 1
+		if retries >= 0 {
+			opts = append(opts, WithRetries(retries))
+			expect = retries + 1
+		}
+		err := c.Call(context.Background(), "Add", &struct{}{}, &struct{}{}, opts...)
+		if err == nil {
+			t.Fatalf("call %v broken nodes should fail", i)
+		}
+		if got := total() - before; got != expect {
+			t.Fatalf("call %v with retries %v recorded %v attempts, expect %v", i, retries, got, expect)
+		}
+	}
+}
+
+// countSelector 统计选择次数的选择器
+type countSelector struct {
+	lock    sync.Mutex
+	servers []string
+	selects int
+}
+
+func (s *countSelector) Select(ctx context.Context, servicePath, serviceMethod string, args interface{}) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.servers) == 0 {
+		return ""
+	}
+	s.selects++
+	return s.servers[s.selects%len(s.servers)]
+}
+
+func (s *countSelector) UpdateServer(servers map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.servers = s.servers[:0]
+	for k := range servers {
+		s.servers = append(s.servers, k)
+	}
+}
+
+func TestRetryBudgetWithoutBreaker(t *testing.T) {
+	// 没有重试预算，关闭熔断后也不能重试
+	SetRetryBudget(0, 0)
+	globalRetryBudget.lock.Lock()
+	globalRetryBudget.tokens = 0
+	globalRetryBudget.lock.Unlock()
+	defer SetRetryBudget(DefaultRetryBudgetRatio, DefaultRetryBudgetMinPerSecond)
+
+	r := registry.NewStaticRegistry(map[string][]string{"budget_test": startBrokenNodes(t, 2)})
+	c := New("budget_test", r, time.Second*3, false)
+	c.SetBreakerConfig(nil)
+	selector := new(countSelector)
+	c.SetSelector(selector)
+
+	err := c.Call(context.Background(), "Add", &struct{}{}, &struct{}{}, WithRetries(2))
+	if err == nil {
+		t.Fatal("call broken nodes should fail")
+	}
+	selector.lock.Lock()
+	defer selector.lock.Unlock()
+	if selector.selects != 1 {
+		t.Fatalf("call without retry budget selected %v nodes, expect 1", selector.selects)
+	}
+}
@@ -0,0 +1,111 @@
+package joyclient
+
+import (
+	"context"
+	"time"
+)
+
+// 兼容旧版本生成代码的ctx字符串key，新代码使用CallOption
+const (
+	legacySelectKey  = "select_key"
+	legacyOneWay     = "one_way"
+	legacyToAllNodes = "to_all_nodes"
+)
+
+// CallOption 调用选项，通过WithCallOptions放入ctx，JoyClient、选择器、生成代码从ctx读取
+type CallOption func(o *callOptions)
+
+type callOptions struct {
+	selectKey interface{} // 选择器选择节点的key，为空时没有设置
+	oneWay    bool
+	broadcast bool
+	timeout   time.Duration // 大于0时覆盖JoyClient的调用超时时间
+	retries   int           // 失败重试其它节点的次数，小于0时使用JoyClient的默认次数
+	quorum    int           // Fork调用成功节点数达到后返回，小于等于0时等待所有节点
+}
+
+type callOptionsKey struct{}
+
+// WithSelectKey 选择节点的key，一致性hash选择器相同key选择相同节点，点对点选择器选择主键为key的节点
+func WithSelectKey(key interface{}) CallOption {
+	return func(o *callOptions) {
+		o.selectKey = key
+	}
+}
+
+// OneWay 单向调用，只把请求发到服务端，不等待回复
+func OneWay() CallOption {
+	return func(o *callOptions) {
+		o.oneWay = true
+	}
+}
+
+// Broadcast 调用服务的所有节点
+func Broadcast() CallOption {
+	return func(o *callOptions) {
+		o.broadcast = true
+	}
+}
+
+// WithTimeout 本次调用的超时时间，ctx已有更早的deadline时以deadline为准
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetries 本次调用失败后重试其它节点的最大次数，0为不重试，默认DefaultRetries，最大MaxRetries
+func WithRetries(retries int) CallOption {
+	return func(o *callOptions) {
+		o.retries = retries
+	}
+}
+
+// WithQuorum Fork调用有quorum个节点成功后立即返回，不等待其它节点，默认等待所有节点
+func WithQuorum(quorum int) CallOption {
+	return func(o *callOptions) {
+		o.quorum = quorum
+	}
+}
+
+// WithCallOptions 把调用选项放入ctx，和ctx里已有的调用选项合并
+func WithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	o := getCallOptions(ctx)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+func getCallOptions(ctx context.Context) callOptions {
+	if o, ok := ctx.Value(callOptionsKey{}).(callOptions); ok {
+		return o
+	}
+	return callOptions{retries: -1}
+}
+
+// SelectKey 选择节点的key，没有用WithSelectKey设置时兼容读取ctx的"select_key"
+func SelectKey(ctx context.Context) interface{} {
+	if key := getCallOptions(ctx).selectKey; key != nil {
+		return key
+	}
+	return ctx.Value(legacySelectKey)
+}
+
+// IsOneWay 是否为单向调用，兼容读取ctx的"one_way"
+func IsOneWay(ctx context.Context) bool {
+	if getCallOptions(ctx).oneWay {
+		return true
+	}
+	v, _ := ctx.Value(legacyOneWay).(bool)
+	return v
+}
+
+// IsBroadcast 是否调用所有节点，兼容读取ctx的"to_all_nodes"
+func IsBroadcast(ctx context.Context) bool {
+	if getCallOptions(ctx).broadcast {
+		return true
+	}
+	v, _ := ctx.Value(legacyToAllNodes).(bool)
+	return v
+}
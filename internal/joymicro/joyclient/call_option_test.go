@@ -0,0 +1,28 @@
+package joyclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCallOptions(t *testing.T) {
+	// 兼容旧版本生成代码的字符串key
+	ctx := context.WithValue(context.Background(), "select_key", "node1")
+	ctx = context.WithValue(ctx, "one_way", true)
+	if SelectKey(ctx) != "node1" || !IsOneWay(ctx) || IsBroadcast(ctx) {
+		t.Fatal("legacy call options error")
+	}
+
+	ctx = WithCallOptions(ctx, WithSelectKey("node2"))
+	ctx = WithCallOptions(ctx, Broadcast(), WithRetries(0))
+	o := getCallOptions(ctx)
+	if SelectKey(ctx) != "node2" || !IsBroadcast(ctx) || o.retries != 0 || o.timeout != 0 {
+		t.Fatalf("call options error:%+v", o)
+	}
+
+	s := NewPeerSelector()
+	s.UpdateServer(map[string]string{"node1@127.0.0.1:8001": "", "node2@127.0.0.1:8002": ""})
+	if addr := s.Select(ctx, "hello", "Say", nil); addr != "tcp@127.0.0.1:8002" {
+		t.Fatalf("peer selector select key error:%v", addr)
+	}
+}
@@ -2,9 +2,13 @@ package joyclient
 
 import (
 	"context"
+	"fmt"
 	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"github.com/xlkness/lkit-go/internal/joymicro/rpc_context"
 	"github.com/xlkness/lkit-go/internal/joymicro/rpc_tracer"
 	"github.com/xlkness/lkit-go/internal/joymicro/util"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,9 +16,15 @@ import (
 	"github.com/smallnest/rpcx/client"
 )
 
+// DefaultRetries 调用失败后默认重试其它节点的次数
+const DefaultRetries = 4
+
+// MaxRetries WithRetries可以设置的最大重试次数
+const MaxRetries = 16
+
 type Service struct {
 	ServiceName string
-	etcdAddrs   []string
+	registry    registry.Registry
 	// 阻塞调用超时时间
 	callTimeout time.Duration
 	// 默认跟rpc server不是永久连接，如果实时通讯量大的话，设置为true，
@@ -22,42 +32,74 @@ type Service struct {
 	// 用来避免长链接，有通信需求的双方节点形成强联通图，无用established套接字太多
 	isPermanentSocketLink bool
 	client                client.XClient
+	discovery             client.ServiceDiscovery // 服务发现，流式调用选择节点时使用
 	selector              client.Selector
 	plugins               client.PluginContainer
+	breakers              *breakers // 节点熔断，为空时不熔断
+	metrics               *metricsPlugin
 	peerServicesLock      *sync.Mutex
-	once                  *sync.Once
+	clientLock            *sync.Mutex
+	isClosed              bool // Close之后不再创建rpc客户端
 }
 
 // New 创建对某个节点的rpc客户端管理结构
-// etcdServerAddrs:etcd服务的多个节点地址
+// r:注册中心，例如registry.NewEtcdRegistry
 // callTimeout:调用服务超时时间
 // isPermanentSocketLink:默认跟rpc server不是永久连接，如果实时通讯量大的话，设置为true，
 //
 //	字段作用：如果跟server读超时就关闭socket连接，等待之后的请求重新connect，
 //	用来避免长链接，有通信需求的双方节点形成强联通图，无用established套接字太多
-func New(service string, etcdServerAddrs []string, callTimeout time.Duration, isPermanentSocketLink bool) *Service {
-	etcdServerAddrs = util.PreHandleEtcdHttpAddrs(etcdServerAddrs)
-
+func New(service string, r registry.Registry, callTimeout time.Duration, isPermanentSocketLink bool) *Service {
 	c := &Service{
 		ServiceName:           service,
-		etcdAddrs:             etcdServerAddrs,
+		registry:              r,
 		callTimeout:           callTimeout,
 		isPermanentSocketLink: isPermanentSocketLink,
 		peerServicesLock:      &sync.Mutex{},
-		once:                  new(sync.Once),
+		clientLock:            new(sync.Mutex),
 		plugins:               client.NewPluginContainer(),
+		breakers:              newBreakers(service, DefaultBreakerConfig),
+		metrics:               newMetricsPlugin(service),
 	}
+	c.plugins.Add(&forkPlugin{})
+	c.plugins.Add(&breakerPlugin{s: c})
+	c.plugins.Add(c.metrics)
 
 	return c
 }
 
 func (s *Service) SetSelector(selector client.Selector) {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
 	s.selector = selector
 	if s.client != nil {
 		s.client.SetSelector(selector)
 	}
 }
 
+// SetBreakerConfig 设置节点熔断配置，为空时关闭熔断，默认DefaultBreakerConfig
+func (s *Service) SetBreakerConfig(cfg *BreakerConfig) {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	if cfg == nil {
+		s.breakers = nil
+		return
+	}
+	s.breakers = newBreakers(s.ServiceName, *cfg)
+}
+
+func (s *Service) getBreakers() *breakers {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	return s.breakers
+}
+
+func (s *Service) getSelector() client.Selector {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	return s.selector
+}
+
 func (s *Service) enableTracer() {
 	tp := rpc_tracer.GetJaegerTracerProvider()
 	if tp == nil {
@@ -69,45 +111,176 @@ func (s *Service) enableTracer() {
 	s.client.GetPlugins().Add(p)
 }
 
-// Call 根据负载算法从服务中挑一个调用
-func (s *Service) Call(ctx context.Context, method string, args interface{}, reply interface{}) error {
-	if _, find := ctx.Deadline(); !find {
+// IsOverloaded 是否为服务端限流拒绝调用的过载错误，过载错误是服务错误，不会重试其它节点
+func IsOverloaded(err error) bool {
+	return util.IsOverloadedError(err)
+}
+
+// Call 根据负载算法从服务中挑一个调用，opts和ctx里WithCallOptions设置的调用选项合并，
+// Broadcast选项调用所有节点，OneWay选项不等待回复
+func (s *Service) Call(ctx context.Context, method string, args interface{}, reply interface{}, opts ...CallOption) error {
+	if len(opts) > 0 {
+		ctx = WithCallOptions(ctx, opts...)
+	}
+	if IsBroadcast(ctx) {
+		return s.CallAll(ctx, method, args, reply)
+	}
+	if IsOneWay(ctx) {
+		reply = nil
+	}
+	return s.call(ctx, method, args, reply)
+}
+
+// call 调用一个节点，ctx里有forkNodeKey时只调用指定的节点
+func (s *Service) call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	o := getCallOptions(ctx)
+	if o.timeout > 0 {
+		newCtx, f := context.WithTimeout(ctx, o.timeout)
+		defer f()
+		ctx = newCtx
+	} else if _, find := ctx.Deadline(); !find {
 		newCtx, f := context.WithTimeout(ctx, s.callTimeout)
 		defer f()
 		ctx = newCtx
 	}
-	c := s.getXClient()
-	return c.Call(ctx, method, args, reply)
+	c, err := s.getXClient()
+	if err != nil {
+		s.metrics.observe(method, clientMetricsNoneNode, err, 0)
+		return err
+	}
+
+	// 传递调用方、请求id、透传数据
+	ctx = rpc_context.Outgoing(ctx)
+
+	// 统计处理中请求数的选择器，调用结束后释放选中的节点
+	if r, ok := s.getSelector().(inflightReleaser); ok {
+		record := new(selectedNodes)
+		ctx = context.WithValue(ctx, selectedNodesKey{}, record)
+		defer record.releaseTo(r)
+	}
+
+	// 熔断跳过的节点、重试次数、重试预算在breakerPlugin里处理，这里记录最后一次尝试的结果
+	attempts := &callAttempts{maxRetries: o.retries}
+	if attempts.maxRetries < 0 {
+		attempts.maxRetries = DefaultRetries
+	} else if attempts.maxRetries > MaxRetries {
+		attempts.maxRetries = MaxRetries
+	}
+	ctx = context.WithValue(ctx, callAttemptsKey{}, attempts)
+	err = c.Call(ctx, method, args, reply)
+	attempts.finish(s.getBreakers(), err)
+	if err == client.ErrXClientNoServer && attempts.rejected {
+		err = client.ErrBreakerOpen
+	}
+	// 没有选中节点的调用插件统计不到，这里统计
+	if err == client.ErrXClientNoServer || err == client.ErrBreakerOpen {
+		s.metrics.observe(method, clientMetricsNoneNode, err, 0)
+	}
+	return err
 }
 
 /*
 	以下为脱离服务概念的接口
 */
 
-// CallAll 调用所有节点，有一个调用返回错误，整个调用都错误
-func (s *Service) CallAll(ctx context.Context, method string, args interface{}, reply interface{}) error {
-	if _, find := ctx.Deadline(); !find {
+// CallAll 调用所有节点，有一个调用返回错误，整个调用都错误，返回节点key(tcp@ip:port)排序后第一个失败节点的原始错误，
+// 都成功时reply为节点key排序后第一个节点的回复
+func (s *Service) CallAll(ctx context.Context, method string, args interface{}, reply interface{}, opts ...CallOption) error {
+	if len(opts) > 0 {
+		ctx = WithCallOptions(ctx, opts...)
+	}
+	if IsOneWay(ctx) {
+		reply = nil
+	}
+	if timeout := getCallOptions(ctx).timeout; timeout > 0 {
+		newCtx, f := context.WithTimeout(ctx, timeout)
+		defer f()
+		ctx = newCtx
+	} else if _, find := ctx.Deadline(); !find {
 		newCtx, f := context.WithTimeout(ctx, s.callTimeout*2)
 		defer f()
 		ctx = newCtx
 	}
-	c := s.getXClient()
-	return c.Broadcast(ctx, method, args, reply)
+	// 通过Fork逐个节点调用，监控和熔断统计到实际调用的节点
+	newReply := func() interface{} {
+		if reply == nil {
+			return nil
+		}
+		return reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+	}
+	result, err := s.Fork(ctx, method, args, newReply)
+	if err != nil {
+		// 返回节点的原始错误，业务错误仍然是client.ServiceError
+		if result != nil && len(result.Errors) > 0 {
+			return result.Errors[sortedNodes(result.Errors)[0]]
+		}
+		return err
+	}
+	if reply == nil {
+		return nil
+	}
+	// 按节点key排序取第一个节点的回复，不依赖map遍历顺序和节点返回顺序
+	if nodes := sortedNodes(result.Replies); len(nodes) > 0 {
+		reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(result.Replies[nodes[0]]).Elem())
+	}
+	return nil
+}
+
+// sortedNodes 排序后的节点key
+func sortedNodes[T any](m map[string]T) []string {
+	nodes := make([]string, 0, len(m))
+	for node := range m {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
 }
 
-func (s *Service) getXClient() client.XClient {
+// getXClient 第一次调用时创建rpc客户端，注册中心创建服务发现失败返回错误，下次调用重试
+func (s *Service) getXClient() (client.XClient, error) {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
 	if s.client != nil {
-		return s.client
+		return s.client, nil
+	}
+	if s.isClosed {
+		return nil, fmt.Errorf("rpc client of service %v is closed", s.ServiceName)
 	}
 
-	s.once.Do(s.newXClient)
+	err := s.newXClient()
+	if err != nil {
+		return nil, fmt.Errorf("rpc client of service %v error:%v", s.ServiceName, err)
+	}
+	return s.client, nil
+}
 
-	return s.client
+// Close 关闭rpc客户端和服务发现，注册中心不再推送节点变化，之后的调用返回错误
+func (s *Service) Close() error {
+	s.clientLock.Lock()
+	defer s.clientLock.Unlock()
+	s.isClosed = true
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.discovery.Close()
+	s.client = nil
+	s.discovery = nil
+	return err
 }
 
-func (s *Service) newXClient() {
+func (s *Service) newXClient() error {
+	if s.registry == nil {
+		return fmt.Errorf("registry is nil")
+	}
+	d, err := s.registry.Discovery(s.ServiceName)
+	if err != nil {
+		return err
+	}
+
 	conf := client.DefaultOption
-	conf.Retries = 4
+	// 重试次数由breakerPlugin按调用选项限制
+	conf.Retries = MaxRetries
 
 	// 默认维持2min连接，读超时就和服务器断开链接
 	conf.IdleTimeout = time.Minute * 2
@@ -119,7 +292,6 @@ func (s *Service) newXClient() {
 	// conf.ReadTimeout = time.Second * 10
 	// conf.WriteTimeout = time.Second * 10
 
-	d := registry.GetEtcdRegistryClientPlugin(s.ServiceName, s.etcdAddrs)
 	xclient := client.NewXClient(s.ServiceName, client.Failover, client.RandomSelect, d, conf)
 	if s.selector != nil {
 		xclient.SetSelector(s.selector)
@@ -128,5 +300,7 @@ func (s *Service) newXClient() {
 		xclient.SetPlugins(s.plugins)
 	}
 	s.client = xclient
+	s.discovery = d
 	s.enableTracer()
+	return nil
 }
@@ -0,0 +1,145 @@
+package joyclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/smallnest/rpcx/client"
+)
+
+// Future 异步调用的结果，Done关闭后Reply、Error可以读取
+type Future struct {
+	Reply interface{}
+	Error error
+	done  chan struct{}
+}
+
+// NewFuture 在新的goroutine里执行fn，返回保存fn结果的Future
+func NewFuture(fn func() (interface{}, error)) *Future {
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		f.Reply, f.Error = fn()
+	}()
+	return f
+}
+
+// Done 调用结束后关闭
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait 等待调用结束，返回调用的错误
+func (f *Future) Wait() error {
+	<-f.done
+	return f.Error
+}
+
+// Go 异步调用，立即返回，调用选项和Call相同，调用结束后reply保存回复
+func (s *Service) Go(ctx context.Context, method string, args interface{}, reply interface{}, opts ...CallOption) *Future {
+	return NewFuture(func() (interface{}, error) {
+		return reply, s.Call(ctx, method, args, reply, opts...)
+	})
+}
+
+type forkNodeKey struct{}
+
+// forkPlugin Fork调用时选择指定的节点，在熔断插件之前添加，熔断的节点仍然被跳过
+type forkPlugin struct{}
+
+func (p *forkPlugin) WrapSelect(fn client.SelectFunc) client.SelectFunc {
+	return func(ctx context.Context, servicePath, serviceMethod string, args interface{}) string {
+		if node, ok := ctx.Value(forkNodeKey{}).(string); ok {
+			return node
+		}
+		return fn(ctx, servicePath, serviceMethod, args)
+	}
+}
+
+// ForkResult Fork调用每个节点的结果，key为节点tcp@ip:port，
+// 达到quorum提前返回时，还没有返回的节点不在结果里
+type ForkResult struct {
+	Replies map[string]interface{} // 调用成功节点的回复
+	Errors  map[string]error       // 调用失败节点的错误
+}
+
+type forkReply struct {
+	node  string
+	reply interface{}
+	err   error
+}
+
+// Fork 并发调用服务的所有节点，收集每个节点的回复和错误，单个节点失败不影响其它节点，节点失败不重试，
+// 默认等待所有节点，有节点失败时返回错误；WithQuorum设置成功节点数达到后立即返回并取消其它节点的调用，
+// 成功节点数不可能达到时立即返回错误
+// newReply:创建一个节点的回复
+func (s *Service) Fork(ctx context.Context, method string, args interface{}, newReply func() interface{}, opts ...CallOption) (*ForkResult, error) {
+	ctx = WithCallOptions(WithCallOptions(ctx, opts...), WithRetries(0))
+	nodes, err := s.nodes()
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		s.metrics.observe(method, clientMetricsNoneNode, client.ErrXClientNoServer, 0)
+		return nil, client.ErrXClientNoServer
+	}
+	quorum := getCallOptions(ctx).quorum
+	if quorum > len(nodes) {
+		quorum = len(nodes)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replies := make(chan *forkReply, len(nodes))
+	for _, node := range nodes {
+		go func(node string) {
+			reply := newReply()
+			err := s.call(context.WithValue(ctx, forkNodeKey{}, node), method, args, reply)
+			replies <- &forkReply{node: node, reply: reply, err: err}
+		}(node)
+	}
+
+	result := &ForkResult{Replies: make(map[string]interface{}), Errors: make(map[string]error)}
+	var lastErr error
+	for range nodes {
+		r := <-replies
+		if r.err != nil {
+			result.Errors[r.node] = r.err
+			lastErr = r.err
+			if quorum > 0 && len(result.Errors) > len(nodes)-quorum {
+				break
+			}
+			continue
+		}
+		result.Replies[r.node] = r.reply
+		if quorum > 0 && len(result.Replies) >= quorum {
+			return result, nil
+		}
+	}
+	if lastErr != nil {
+		return result, fmt.Errorf("fork call %v.%v %v of %v nodes failed, last error:%v",
+			s.ServiceName, method, len(result.Errors), len(nodes), lastErr)
+	}
+	return result, nil
+}
+
+// nodes 服务发现的所有节点，统一为tcp@ip:port
+func (s *Service) nodes() ([]string, error) {
+	if _, err := s.getXClient(); err != nil {
+		return nil, err
+	}
+	s.clientLock.Lock()
+	pairs := s.discovery.GetServices()
+	s.clientLock.Unlock()
+
+	nodes := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		node := pair.Key
+		if strs := strings.SplitN(node, "@", 2); len(strs) == 2 {
+			node = "tcp@" + strs[1]
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,204 @@
+package joyclient
+
+import (
+	"context"
+	"errors"
+	"github.com/xlkness/lkit-go/internal/joymicro/joyservice"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/smallnest/rpcx/client"
+)
+
+type forkTestService struct {
+	id    int
+	fail  bool
+	delay time.Duration
+}
+
+func (s *forkTestService) Id(ctx context.Context, args *struct{}, reply *int) error {
+	time.Sleep(s.delay)
+	if s.fail {
+		return errors.New("fork test failed")
+	}
+	*reply = s.id
+	return nil
+}
+
+// startForkTestServices 启动服务节点，返回节点地址，顺序和services相同
+func startForkTestServices(t *testing.T, r registry.Registry, services ...*forkTestService) []string {
+	addrs := make([]string, 0, len(services))
+	for _, handler := range services {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := ln.Addr().String()
+		ln.Close()
+
+		s, err := joyservice.New(addr, addr, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.DisableGateway()
+		if err = s.RegisterOneService("fork_test", handler, nil); err != nil {
+			t.Fatal(err)
+		}
+		go s.Run()
+		t.Cleanup(s.Stop)
+		for i := 0; i < 100; i++ {
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Close()
+				break
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+func TestFork(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	startForkTestServices(t, r, &forkTestService{id: 1}, &forkTestService{id: 2},
+		&forkTestService{id: 3, fail: true}, &forkTestService{id: 4, delay: time.Second})
+	c := New("fork_test", r, time.Second*3, false)
+	newReply := func() interface{} { return new(int) }
+
+	// 默认等待所有节点，有节点失败返回错误，成功节点的回复仍然保留
+	result, err := c.Fork(context.Background(), "Id", &struct{}{}, newReply)
+	if err == nil || len(result.Replies) != 3 || len(result.Errors) != 1 {
+		t.Fatalf("fork all nodes error:%v, result:%+v", err, result)
+	}
+	sum := 0
+	for _, reply := range result.Replies {
+		sum += *reply.(*int)
+	}
+	if sum != 7 {
+		t.Fatalf("fork replies error:%+v", result.Replies)
+	}
+
+	// 两个节点成功就返回，不等待慢节点
+	start := time.Now()
+	result, err = c.Fork(context.Background(), "Id", &struct{}{}, newReply, WithQuorum(2))
+	if err != nil || len(result.Replies) != 2 || time.Since(start) >= time.Second {
+		t.Fatalf("fork quorum error:%v, result:%+v, cost:%v", err, result, time.Since(start))
+	}
+
+	// 失败节点过多，成功节点数不可能达到quorum
+	result, err = c.Fork(context.Background(), "Id", &struct{}{}, newReply, WithQuorum(4))
+	if err == nil || len(result.Errors) != 1 {
+		t.Fatalf("fork quorum not reached error:%v, result:%+v", err, result)
+	}
+
+	reply := new(int)
+	f := c.Go(context.Background(), "Id", &struct{}{}, reply, WithTimeout(time.Millisecond*500))
+	<-f.Done()
+	if f.Reply != reply || (f.Error == nil) != (*reply != 0) {
+		t.Fatalf("go call error:%v, reply:%v", f.Error, *reply)
+	}
+}
+
+func TestCallAllMetricsPeer(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	startForkTestServices(t, r, &forkTestService{id: 1}, &forkTestService{id: 2})
+	c := New("fork_test", r, time.Second*3, false)
+	nodes, err := c.nodes()
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("nodes error:%v, nodes:%v", err, nodes)
+	}
+
+	count := func(peer string) float64 {
+		return testutil.ToFloat64(clientCallCounter.LabelValues("fork_test", "Id", peer, "ok"))
+	}
+	before := map[string]float64{clientMetricsNoneNode: count(clientMetricsNoneNode)}
+	for _, node := range nodes {
+		before[node] = count(node)
+	}
+
+	reply := new(int)
+	if err = c.CallAll(context.Background(), "Id", &struct{}{}, reply); err != nil {
+		t.Fatal(err)
+	}
+	if *reply != 1 && *reply != 2 {
+		t.Fatalf("call all reply:%v", *reply)
+	}
+
+	// 广播调用按实际调用的节点统计，不统计到none
+	for _, node := range nodes {
+		if got := count(node) - before[node]; got != 1 {
+			t.Fatalf("node %v recorded %v calls", node, got)
+		}
+	}
+	if got := count(clientMetricsNoneNode) - before[clientMetricsNoneNode]; got != 0 {
+		t.Fatalf("none node recorded %v calls", got)
+	}
+}
+
+func TestCallAllReply(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	services := []*forkTestService{{id: 1, delay: time.Millisecond * 100}, {id: 2, delay: time.Millisecond * 50}, {id: 3}}
+	addrs := startForkTestServices(t, r, services...)
+	c := New("fork_test", r, time.Second*3, false)
+
+	// 回复取节点key排序后的第一个节点，和返回快慢无关
+	expect, first := 0, ""
+	for i, addr := range addrs {
+		if node := "tcp@" + addr; first == "" || node < first {
+			expect, first = services[i].id, node
+		}
+	}
+	for i := 0; i < 10; i++ {
+		reply := new(int)
+		if err := c.CallAll(context.Background(), "Id", &struct{}{}, reply); err != nil {
+			t.Fatal(err)
+		}
+		if *reply != expect {
+			t.Fatalf("call all reply %v, expect node %v reply %v", *reply, first, expect)
+		}
+	}
+}
+
+func TestCallAllServiceError(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	startForkTestServices(t, r, &forkTestService{id: 1}, &forkTestService{id: 2, fail: true})
+	c := New("fork_test", r, time.Second*3, false)
+
+	// 业务错误原样返回，不包装成fork错误
+	err := c.CallAll(context.Background(), "Id", &struct{}{}, new(int))
+	if _, ok := err.(client.ServiceError); !ok || err.Error() != "fork test failed" {
+		t.Fatalf("call all error:%#v", err)
+	}
+	err = c.Call(context.Background(), "Id", &struct{}{}, new(int), Broadcast())
+	if _, ok := err.(client.ServiceError); !ok || err.Error() != "fork test failed" {
+		t.Fatalf("broadcast call error:%#v", err)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	r := registry.NewMemoryRegistry()
+	startForkTestServices(t, r, &forkTestService{id: 1})
+	c := New("fork_test", r, time.Second*3, false)
+
+	reply := new(int)
+	if err := c.Call(context.Background(), "Id", &struct{}{}, reply); err != nil || *reply != 1 {
+		t.Fatalf("call before close error:%v, reply:%v", err, *reply)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("close twice error:%v", err)
+	}
+
+	// 关闭后不再重新创建客户端
+	if err := c.Call(context.Background(), "Id", &struct{}{}, reply); err == nil {
+		t.Fatalf("call after close should return error")
+	}
+	if _, err := c.Fork(context.Background(), "Id", &struct{}{}, func() interface{} { return new(int) }); err == nil {
+		t.Fatalf("fork after close should return error")
+	}
+}
@@ -0,0 +1,94 @@
+package joyclient
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"sync"
+	"time"
+
+	"github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/share"
+)
+
+var (
+	clientMetricsOnce     = new(sync.Once)
+	clientCallCounter     *prom.PromeCounterStatMgr
+	clientCallHistogram   *prom.PromeHistogramStatMgr
+	clientMetricsBuckets  = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 3, 10}
+	clientMetricsNoneNode = "none"
+)
+
+func initClientMetrics() {
+	clientMetricsOnce.Do(func() {
+		clientCallCounter = prom.NewCounter("rpc_client_calls_total").InitLabels([]string{"service", "method", "peer", "code"})
+		clientCallHistogram = prom.NewHistogram("rpc_client_call_duration_seconds", clientMetricsBuckets).
+			InitLabels([]string{"service", "method", "peer"})
+	})
+}
+
+// ErrorCode 调用错误的分类，用于监控的code标签
+func ErrorCode(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if IsOverloaded(err) {
+		return "overloaded"
+	}
+	if _, ok := err.(client.ServiceError); ok {
+		return "service_error"
+	}
+	switch err {
+	case context.DeadlineExceeded:
+		return "timeout"
+	case context.Canceled:
+		return "canceled"
+	case client.ErrBreakerOpen:
+		return "breaker_open"
+	case client.ErrXClientNoServer:
+		return "no_server"
+	}
+	return "error"
+}
+
+type metricsStartKey struct{}
+
+// metricsPlugin 客户端监控插件，统计每次调用节点的调用数、错误码、耗时，失败重试的每次尝试分别统计
+type metricsPlugin struct {
+	service string
+}
+
+func newMetricsPlugin(service string) *metricsPlugin {
+	initClientMetrics()
+	return &metricsPlugin{service: service}
+}
+
+func (p *metricsPlugin) PreCall(ctx context.Context, servicePath, serviceMethod string, args interface{}) error {
+	if sctx, ok := ctx.(*share.Context); ok {
+		sctx.SetValue(metricsStartKey{}, time.Now())
+	}
+	return nil
+}
+
+func (p *metricsPlugin) PostCall(ctx context.Context, servicePath, serviceMethod string, args interface{}, reply interface{}, err error) error {
+	start, ok := ctx.Value(metricsStartKey{}).(time.Time)
+	if !ok {
+		return err
+	}
+	peer := clientMetricsNoneNode
+	if a, ok := ctx.Value(callAttemptsKey{}).(*callAttempts); ok {
+		a.lock.Lock()
+		if a.peer != "" {
+			peer = a.peer
+		}
+		a.lock.Unlock()
+	}
+	p.observe(serviceMethod, peer, err, time.Since(start))
+	return err
+}
+
+func (p *metricsPlugin) observe(method, peer string, err error, cost time.Duration) {
+	clientCallCounter.LabelValues(p.service, method, peer, ErrorCode(err)).Inc()
+	if peer != clientMetricsNoneNode {
+		clientCallHistogram.LabelValues(p.service, method, peer).Observe(cost.Seconds())
+	}
+}
@@ -29,13 +29,13 @@ func NewPeerSelector() client.Selector {
 	return new(PeerSelector)
 }
 
-// Select 根据context里的select_key选择匹配的服务器进行调用
+// Select 根据context里的select key(WithSelectKey)选择匹配的服务器进行调用
 func (ms *PeerSelector) Select(ctx context.Context, servicePath, serviceMethod string, args interface{}) string {
 	if len(ms.servers) <= 0 {
 		return ""
 	}
 
-	key := ctx.Value("select_key")
+	key := SelectKey(ctx)
 
 	if key == nil {
 		server := ms.servers[rand.Intn(len(ms.servers))]
@@ -113,7 +113,7 @@ func (s *consistentHashSelector) Select(ctx context.Context, servicePath, servic
 		return ""
 	}
 
-	key := ctx.Value("select_key")
+	key := SelectKey(ctx)
 
 	if key == nil || key == "" {
 		return s.servers[rand.Intn(len(s.servers))]
@@ -0,0 +1,215 @@
+package joyclient
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/smallnest/rpcx/client"
+)
+
+// balanceNode 负载均衡选择器里的一个服务节点
+type balanceNode struct {
+	addr          string // tcp@ip:port
+	meta          registry.NodeMeta
+	inflight      int64 // 处理中的请求数
+	currentWeight int   // 平滑加权轮询的当前权重
+}
+
+// balanceNodes 负载均衡选择器的节点列表，按注册的weight、zone筛选候选节点
+type balanceNodes struct {
+	zone  string // 本地可用区，不为空时优先选择相同zone的节点
+	lock  *sync.Mutex
+	nodes []*balanceNode
+	index map[string]*balanceNode
+}
+
+func newBalanceNodes(zone string) *balanceNodes {
+	return &balanceNodes{
+		zone:  zone,
+		lock:  new(sync.Mutex),
+		index: make(map[string]*balanceNode),
+	}
+}
+
+// update 更新节点列表，保留已有节点的处理中请求数和轮询权重
+func (bn *balanceNodes) update(servers map[string]string) {
+	bn.lock.Lock()
+	defer bn.lock.Unlock()
+
+	nodes := make([]*balanceNode, 0, len(servers))
+	index := make(map[string]*balanceNode, len(servers))
+	for k, v := range servers {
+		addr := k
+		if strs := strings.SplitN(k, "@", 2); len(strs) == 2 {
+			addr = "tcp@" + strs[1]
+		}
+		node := bn.index[addr]
+		if node == nil {
+			node = &balanceNode{addr: addr}
+		}
+		node.meta = registry.ParseNodeMeta(v)
+		nodes = append(nodes, node)
+		index[addr] = node
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].addr < nodes[j].addr })
+	bn.nodes = nodes
+	bn.index = index
+}
+
+// candidates 候选节点，权重为0的节点不分配流量，相同zone有可用节点时只选相同zone，
+// 所有节点权重都为0时退化为全部节点，调用方需要持有锁
+func (bn *balanceNodes) candidates() []*balanceNode {
+	var available, sameZone []*balanceNode
+	for _, node := range bn.nodes {
+		if node.meta.Weight <= 0 {
+			continue
+		}
+		available = append(available, node)
+		if bn.zone != "" && node.meta.Zone == bn.zone {
+			sameZone = append(sameZone, node)
+		}
+	}
+	if len(sameZone) > 0 {
+		return sameZone
+	}
+	if len(available) > 0 {
+		return available
+	}
+	return bn.nodes
+}
+
+// acquire 选中节点后增加处理中请求数，调用结束时由Service释放，
+// 不是通过Service调用的(context里没有记录)不统计
+func (bn *balanceNodes) acquire(ctx context.Context, node *balanceNode) {
+	if record, ok := ctx.Value(selectedNodesKey{}).(*selectedNodes); ok {
+		node.inflight++
+		record.add(node.addr)
+	}
+}
+
+func (bn *balanceNodes) release(addr string) {
+	bn.lock.Lock()
+	defer bn.lock.Unlock()
+	if node := bn.index[addr]; node != nil && node.inflight > 0 {
+		node.inflight--
+	}
+}
+
+// inflightReleaser 统计处理中请求数的选择器，Service调用结束时释放选中的节点
+type inflightReleaser interface {
+	release(addr string)
+}
+
+type selectedNodesKey struct{}
+
+// selectedNodes 一次调用选中的所有节点，包括失败重试选中的节点
+type selectedNodes struct {
+	lock  sync.Mutex
+	nodes []string
+}
+
+func (sn *selectedNodes) add(addr string) {
+	sn.lock.Lock()
+	sn.nodes = append(sn.nodes, addr)
+	sn.lock.Unlock()
+}
+
+func (sn *selectedNodes) releaseTo(r inflightReleaser) {
+	sn.lock.Lock()
+	defer sn.lock.Unlock()
+	for _, addr := range sn.nodes {
+		r.release(addr)
+	}
+	sn.nodes = nil
+}
+
+// weightedRoundRobinSelector 平滑加权轮询选择器，按节点注册的weight分配流量，优先相同zone
+type weightedRoundRobinSelector struct {
+	*balanceNodes
+}
+
+// NewWeightedRoundRobinSelector 创建平滑加权轮询选择器
+// zone:本地可用区，不为空时优先选择注册了相同zone的节点，相同zone没有可用节点时选择其它zone
+func NewWeightedRoundRobinSelector(zone string) client.Selector {
+	return &weightedRoundRobinSelector{balanceNodes: newBalanceNodes(zone)}
+}
+
+func (s *weightedRoundRobinSelector) Select(ctx context.Context, servicePath, serviceMethod string, args interface{}) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	nodes := s.candidates()
+	if len(nodes) == 0 {
+		return ""
+	}
+
+	var best *balanceNode
+	total := 0
+	for _, node := range nodes {
+		weight := node.meta.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		node.currentWeight += weight
+		total += weight
+		if best == nil || node.currentWeight > best.currentWeight {
+			best = node
+		}
+	}
+	best.currentWeight -= total
+	s.acquire(ctx, best)
+	return best.addr
+}
+
+func (s *weightedRoundRobinSelector) UpdateServer(servers map[string]string) {
+	s.update(servers)
+}
+
+// leastInflightSelector 最少处理中请求选择器，按处理中请求数/weight选择负载最低的节点，优先相同zone
+type leastInflightSelector struct {
+	*balanceNodes
+}
+
+// NewLeastInflightSelector 创建最少处理中请求选择器，处理中请求数只统计本客户端发出的调用
+// zone:本地可用区，不为空时优先选择注册了相同zone的节点，相同zone没有可用节点时选择其它zone
+func NewLeastInflightSelector(zone string) client.Selector {
+	return &leastInflightSelector{balanceNodes: newBalanceNodes(zone)}
+}
+
+func (s *leastInflightSelector) Select(ctx context.Context, servicePath, serviceMethod string, args interface{}) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	nodes := s.candidates()
+	if len(nodes) == 0 {
+		return ""
+	}
+
+	// 负载相同的节点随机选择，避免总是压到第一个节点
+	var bests []*balanceNode
+	var bestLoad float64
+	for _, node := range nodes {
+		weight := node.meta.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		load := float64(node.inflight+1) / float64(weight)
+		if len(bests) == 0 || load < bestLoad {
+			bests = append(bests[:0], node)
+			bestLoad = load
+		} else if load == bestLoad {
+			bests = append(bests, node)
+		}
+	}
+	best := bests[rand.Intn(len(bests))]
+	s.acquire(ctx, best)
+	return best.addr
+}
+
+func (s *leastInflightSelector) UpdateServer(servers map[string]string) {
+	s.update(servers)
+}
@@ -0,0 +1,55 @@
+package joyclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWeightedRoundRobinSelector(t *testing.T) {
+	s := NewWeightedRoundRobinSelector("sz")
+	s.UpdateServer(map[string]string{
+		"tcp@127.0.0.1:8001": "weight=300&zone=sz",
+		"tcp@127.0.0.1:8002": "zone=sz",
+		"tcp@127.0.0.1:8003": "weight=1000&zone=gz",
+		"tcp@127.0.0.1:8004": "weight=0&zone=sz",
+	})
+
+	counts := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		counts[s.Select(context.Background(), "hello", "Say", nil)]++
+	}
+	if counts["tcp@127.0.0.1:8001"] != 300 || counts["tcp@127.0.0.1:8002"] != 100 {
+		t.Fatalf("weighted round robin select error:%+v", counts)
+	}
+
+	// 相同zone没有可用节点时选择其它zone
+	s.UpdateServer(map[string]string{
+		"tcp@127.0.0.1:8003": "weight=1000&zone=gz",
+		"tcp@127.0.0.1:8004": "weight=0&zone=sz",
+	})
+	if addr := s.Select(context.Background(), "hello", "Say", nil); addr != "tcp@127.0.0.1:8003" {
+		t.Fatalf("weighted round robin select other zone error:%v", addr)
+	}
+}
+
+func TestLeastInflightSelector(t *testing.T) {
+	s := NewLeastInflightSelector("")
+	s.UpdateServer(map[string]string{
+		"tcp@127.0.0.1:8001":   "",
+		"node1@127.0.0.1:8002": "",
+	})
+
+	record := new(selectedNodes)
+	ctx := context.WithValue(context.Background(), selectedNodesKey{}, record)
+	first := s.Select(ctx, "hello", "Say", nil)
+	second := s.Select(ctx, "hello", "Say", nil)
+	if first == second || (second != "tcp@127.0.0.1:8001" && second != "tcp@127.0.0.1:8002") {
+		t.Fatalf("least inflight select error:%v %v", first, second)
+	}
+
+	// 释放后再次平分
+	record.releaseTo(s.(inflightReleaser))
+	if s.Select(ctx, "hello", "Say", nil) == s.Select(ctx, "hello", "Say", nil) {
+		t.Fatal("least inflight select after release error")
+	}
+}
@@ -0,0 +1,304 @@
+package joyclient
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"github.com/xlkness/lkit-go/internal/joymicro/util"
+	"github.com/xlkness/lkit-go/internal/log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/share"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRouteEtcdTimeout 连接etcd、读取路由规则的超时时间
+var DefaultRouteEtcdTimeout = time.Second * 5
+
+// RouteRule 版本路由规则，命中的调用发往注册了对应version的节点，规则按顺序匹配，第一个命中的生效，
+// 对应version没有节点时不生效
+type RouteRule struct {
+	Service string  `json:"service" yaml:"service"` // 只对某个服务生效，为空对所有服务生效
+	Version string  `json:"version" yaml:"version"` // 目标节点版本，对应节点注册的version
+	Header  string  `json:"header" yaml:"header"`   // 调用携带的rpcx metadata key，为空时只按比例命中
+	Value   string  `json:"value" yaml:"value"`     // header的值，为空时携带header就命中
+	Percent float64 `json:"percent" yaml:"percent"` // 命中的调用比例0-100，设置了header时为0表示全部命中
+}
+
+// match 调用是否命中规则，按比例命中时context里有select key用key哈希，同一个key始终命中或不命中
+func (r *RouteRule) match(ctx context.Context, servicePath string) bool {
+	if r.Service != "" && r.Service != servicePath {
+		return false
+	}
+	if r.Header != "" {
+		meta, _ := ctx.Value(share.ReqMetaDataKey).(map[string]string)
+		value, find := meta[r.Header]
+		if !find || (r.Value != "" && r.Value != value) {
+			return false
+		}
+		if r.Percent <= 0 {
+			return true
+		}
+	}
+	if r.Percent <= 0 {
+		return false
+	}
+	if r.Percent >= 100 {
+		return true
+	}
+
+	var n float64
+	if key := SelectKey(ctx); key != nil && key != "" {
+		n = float64(genKey(servicePath, key)%10000) / 100
+	} else {
+		n = rand.Float64() * 100
+	}
+	return n < r.Percent
+}
+
+// ParseRouteRules 解析路由规则，格式为yaml或json数组
+func ParseRouteRules(content []byte) ([]*RouteRule, error) {
+	var rules []*RouteRule
+	err := yaml.Unmarshal(content, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("parse route rules error:%v", err)
+	}
+	for i, rule := range rules {
+		if rule == nil || rule.Version == "" {
+			return nil, fmt.Errorf("route rule %v version is empty", i)
+		}
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return nil, fmt.Errorf("route rule %v percent %v out of range [0,100]", i, rule.Percent)
+		}
+	}
+	return rules, nil
+}
+
+// RouteSelector 版本路由选择器，按路由规则把调用发往不同version的节点，
+// 节点按version分组，每组用newSelector创建的选择器负载均衡，没有命中规则的调用发往规则目标版本以外的节点
+type RouteSelector struct {
+	newSelector func() client.Selector
+	lock        *sync.RWMutex
+	rules       []*RouteRule
+	servers     map[string]string
+	groups      map[string]client.Selector // 规则目标version -> 该版本节点的选择器
+	stable      client.Selector            // 规则目标版本以外的节点，没有时为所有节点
+	stopChan    chan struct{}
+	stopOnce    *sync.Once
+}
+
+// NewRouteSelector 创建版本路由选择器
+// newSelector:创建每组节点的选择器，例如NewLeastInflightSelector，为空时用加权轮询
+func NewRouteSelector(newSelector func() client.Selector) *RouteSelector {
+	if newSelector == nil {
+		newSelector = func() client.Selector { return NewWeightedRoundRobinSelector("") }
+	}
+	return &RouteSelector{
+		newSelector: newSelector,
+		lock:        new(sync.RWMutex),
+		servers:     make(map[string]string),
+		groups:      make(map[string]client.Selector),
+		stable:      newSelector(),
+		stopChan:    make(chan struct{}),
+		stopOnce:    new(sync.Once),
+	}
+}
+
+func (s *RouteSelector) Select(ctx context.Context, servicePath, serviceMethod string, args interface{}) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, rule := range s.rules {
+		group := s.groups[rule.Version]
+		if group == nil || !rule.match(ctx, servicePath) {
+			continue
+		}
+		return group.Select(ctx, servicePath, serviceMethod, args)
+	}
+	return s.stable.Select(ctx, servicePath, serviceMethod, args)
+}
+
+// UpdateServer 更新节点，节点key统一为tcp@ip:port后保存，不修改传入的map
+func (s *RouteSelector) UpdateServer(servers map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.servers = make(map[string]string, len(servers))
+	for k, v := range servers {
+		if strs := strings.SplitN(k, "@", 2); len(strs) == 2 {
+			k = "tcp@" + strs[1]
+		}
+		s.servers[k] = v
+	}
+	s.regroup()
+}
+
+// SetRules 替换路由规则，立即生效
+func (s *RouteSelector) SetRules(rules []*RouteRule) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rules = rules
+	s.regroup()
+}
+
+// Rules 当前的路由规则
+func (s *RouteSelector) Rules() []*RouteRule {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.rules
+}
+
+// regroup 按规则的目标version重新给节点分组，已有版本的选择器保留负载状态，调用方需要持有锁
+func (s *RouteSelector) regroup() {
+	targets := make(map[string]map[string]string)
+	for _, rule := range s.rules {
+		targets[rule.Version] = make(map[string]string)
+	}
+
+	stable := make(map[string]string)
+	for k, v := range s.servers {
+		if nodes, find := targets[registry.ParseNodeMeta(v).Version]; find {
+			nodes[k] = v
+		} else {
+			stable[k] = v
+		}
+	}
+	if len(stable) == 0 {
+		for k, v := range s.servers {
+			stable[k] = v
+		}
+	}
+	s.stable.UpdateServer(stable)
+
+	groups := make(map[string]client.Selector, len(targets))
+	for version, nodes := range targets {
+		if len(nodes) == 0 {
+			continue
+		}
+		group := s.groups[version]
+		if group == nil {
+			group = s.newSelector()
+		}
+		group.UpdateServer(nodes)
+		groups[version] = group
+	}
+	s.groups = groups
+}
+
+// release 分组选择器统计处理中请求数时转发释放
+func (s *RouteSelector) release(addr string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if r, ok := s.stable.(inflightReleaser); ok {
+		r.release(addr)
+	}
+	for _, group := range s.groups {
+		if r, ok := group.(inflightReleaser); ok {
+			r.release(addr)
+		}
+	}
+}
+
+// routeEtcd 读取、监听路由规则的etcd接口，*clientv3.Client实现，测试时替换
+type routeEtcd interface {
+	clientv3.KV
+	clientv3.Watcher
+}
+
+// WatchEtcd 从etcd的key读取路由规则并监听修改，修改后热更新，解析失败保留旧规则，key不存在时没有规则
+func (s *RouteSelector) WatchEtcd(etcdAddrs []string, key string) error {
+	cli, err := clientv3.New(clientv3.Config{Endpoints: util.PreHandleEtcdHttpAddrs(etcdAddrs), DialTimeout: DefaultRouteEtcdTimeout})
+	if err != nil {
+		return fmt.Errorf("connect route rules etcd %v error:%v", etcdAddrs, err)
+	}
+
+	revision, err := s.loadEtcd(cli, key)
+	if err != nil {
+		cli.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.stopChan
+		cancel()
+	}()
+	go func() {
+		defer cli.Close()
+		s.watchEtcd(ctx, cli, key, revision)
+	}()
+	return nil
+}
+
+// loadEtcd 读取etcd里的路由规则，返回读取的etcd版本
+func (s *RouteSelector) loadEtcd(cli routeEtcd, key string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRouteEtcdTimeout)
+	resp, err := cli.Get(ctx, key)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("get route rules etcd key %v error:%v", key, err)
+	}
+	if len(resp.Kvs) == 0 {
+		s.SetRules(nil)
+		return resp.Header.Revision, nil
+	}
+	rules, err := ParseRouteRules(resp.Kvs[0].Value)
+	if err != nil {
+		return 0, fmt.Errorf("route rules etcd key %v error:%v", key, err)
+	}
+	s.SetRules(rules)
+	return resp.Header.Revision, nil
+}
+
+// watchEtcd 监听路由规则的修改，watch中断时重新读取最新规则再继续监听，直到ctx结束
+func (s *RouteSelector) watchEtcd(ctx context.Context, cli routeEtcd, key string, revision int64) {
+	for {
+		watchChan := cli.Watch(clientv3.WithRequireLeader(ctx), key, clientv3.WithRev(revision+1))
+		for resp := range watchChan {
+			if err := resp.Err(); err != nil {
+				log.Warnf("watch route rules etcd key %v error:%v", key, err)
+				break
+			}
+			for _, ev := range resp.Events {
+				revision = ev.Kv.ModRevision
+				if ev.Type != clientv3.EventTypePut {
+					log.Noticef("route rules etcd key %v is deleted, clear route rules", key)
+					s.SetRules(nil)
+					continue
+				}
+				rules, err := ParseRouteRules(ev.Kv.Value)
+				if err != nil {
+					log.Errorf("route rules etcd key %v changed, but keep old rules, error:%v", key, err)
+					continue
+				}
+				s.SetRules(rules)
+				log.Noticef("route rules etcd key %v changed, apply revision %v ok", key, revision)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+
+		newRevision, err := s.loadEtcd(cli, key)
+		if err != nil {
+			log.Warnf("rewatch route rules etcd key %v, but get latest rules error:%v", key, err)
+			continue
+		}
+		revision = newRevision
+	}
+}
+
+// Close 停止监听etcd里的路由规则
+func (s *RouteSelector) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+}
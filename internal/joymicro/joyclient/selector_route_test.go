@@ -0,0 +1,208 @@
+package joyclient
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallnest/rpcx/share"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestRouteSelector(t *testing.T) {
+	s := NewRouteSelector(nil)
+	servers := map[string]string{
+		"tcp@127.0.0.1:8001": "version=1",
+		"tcp@127.0.0.1:8002": "version=2",
+		"tcp@127.0.0.1:8003": "version=canary",
+	}
+	s.UpdateServer(servers)
+	if len(servers) != 3 || servers["tcp@127.0.0.1:8001"] != "version=1" {
+		t.Fatalf("route selector update modify servers:%v", servers)
+	}
+
+	rules, err := ParseRouteRules([]byte(`
+- {version: canary, header: X-Canary}
+- {version: "2", percent: 5}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetRules(rules)
+
+	ctx := context.WithValue(context.Background(), share.ReqMetaDataKey, map[string]string{"X-Canary": "1"})
+	if addr := s.Select(ctx, "hello", "Say", nil); addr != "tcp@127.0.0.1:8003" {
+		t.Fatalf("route selector header rule error:%v", addr)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		ctx := context.WithValue(context.Background(), "select_key", strconv.Itoa(i))
+		counts[s.Select(ctx, "hello", "Say", nil)]++
+	}
+	if counts["tcp@127.0.0.1:8003"] != 0 || counts["tcp@127.0.0.1:8002"] < 300 || counts["tcp@127.0.0.1:8002"] > 700 {
+		t.Fatalf("route selector percent rule error:%+v", counts)
+	}
+
+	// 去掉规则后所有节点都是稳定节点
+	s.SetRules(nil)
+	counts = make(map[string]int)
+	for i := 0; i < 30; i++ {
+		counts[s.Select(context.Background(), "hello", "Say", nil)]++
+	}
+	if len(counts) != 3 {
+		t.Fatalf("route selector without rules error:%+v", counts)
+	}
+}
+
+func TestRouteSelectorNormalizeKeys(t *testing.T) {
+	s := NewRouteSelector(nil)
+	servers := map[string]string{"shard1@127.0.0.1:8001": "version=1"}
+	s.UpdateServer(servers)
+	if _, find := servers["shard1@127.0.0.1:8001"]; !find || len(servers) != 1 {
+		t.Fatalf("route selector update modify servers:%v", servers)
+	}
+	if addr := s.Select(context.Background(), "hello", "Say", nil); addr != "tcp@127.0.0.1:8001" {
+		t.Fatalf("route selector select not normalized key:%v", addr)
+	}
+}
+
+// fakeRouteEtcd 内存里的etcd key，Watch返回的事件由测试发送
+type fakeRouteEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+	lock     sync.Mutex
+	value    []byte
+	revision int64
+	watches  chan fakeRouteWatch
+}
+
+type fakeRouteWatch struct {
+	rev int64
+	ch  chan clientv3.WatchResponse
+}
+
+func (f *fakeRouteEtcd) put(value string) *mvccpb.KeyValue {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.revision++
+	f.value = []byte(value)
+	return &mvccpb.KeyValue{Value: f.value, ModRevision: f.revision}
+}
+
+func (f *fakeRouteEtcd) del() *mvccpb.KeyValue {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.revision++
+	f.value = nil
+	return &mvccpb.KeyValue{ModRevision: f.revision}
+}
+
+func (f *fakeRouteEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	resp := &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: f.revision}}
+	if f.value != nil {
+		resp.Kvs = []*mvccpb.KeyValue{{Key: []byte(key), Value: f.value, ModRevision: f.revision}}
+	}
+	return resp, nil
+}
+
+func (f *fakeRouteEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	w := fakeRouteWatch{rev: clientv3.OpGet(key, opts...).Rev(), ch: make(chan clientv3.WatchResponse)}
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp := <-w.ch:
+				out <- resp
+				if resp.Err() != nil {
+					return
+				}
+			}
+		}
+	}()
+	f.watches <- w
+	return out
+}
+
+func TestRouteSelectorWatchEtcd(t *testing.T) {
+	s := NewRouteSelector(nil)
+	fake := &fakeRouteEtcd{watches: make(chan fakeRouteWatch, 1)}
+	fake.put("- {version: canary, header: X-Canary}")
+
+	revision, err := s.loadEtcd(fake, "/route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules := s.Rules(); len(rules) != 1 || rules[0].Version != "canary" {
+		t.Fatalf("load route rules error:%+v", rules)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.watchEtcd(ctx, fake, "/route", revision)
+		close(done)
+	}()
+
+	nextWatch := func(expectRev int64) fakeRouteWatch {
+		select {
+		case w := <-fake.watches:
+			if w.rev != expectRev {
+				t.Fatalf("watch from revision %v, expect %v", w.rev, expectRev)
+			}
+			return w
+		case <-time.After(time.Second * 5):
+			t.Fatalf("watch not started")
+		}
+		return fakeRouteWatch{}
+	}
+	waitRules := func(expect string) {
+		version := func() string {
+			if rules := s.Rules(); len(rules) > 0 {
+				return rules[0].Version
+			}
+			return ""
+		}
+		for i := 0; i < 300 && version() != expect; i++ {
+			time.Sleep(time.Millisecond * 10)
+		}
+		if version() != expect {
+			t.Fatalf("route rules version %v, expect %v", version(), expect)
+		}
+	}
+	put := func(w fakeRouteWatch, value string) {
+		w.ch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypePut, Kv: fake.put(value)}}}
+	}
+
+	// 修改后热更新，解析失败保留旧规则，删除后清空规则
+	w := nextWatch(2)
+	put(w, "- {version: \"2\", percent: 5}")
+	waitRules("2")
+	put(w, "- {percent: 5}")
+	put(w, "- {version: \"3\", percent: 5}")
+	waitRules("3")
+	w.ch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: clientv3.EventTypeDelete, Kv: fake.del()}}}
+	waitRules("")
+
+	// watch中断后读取最新规则，从最新版本的下一个版本继续监听
+	fake.put("- {version: \"4\", percent: 5}")
+	w.ch <- clientv3.WatchResponse{CompactRevision: 6}
+	waitRules("4")
+	nextWatch(7)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("watch not stop")
+	}
+}
@@ -0,0 +1,94 @@
+package joyclient
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/joymicro/joystream"
+	"github.com/xlkness/lkit-go/internal/joymicro/rpc_context"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/share"
+)
+
+// Stream 建立到服务一个节点的流式调用，节点按选择器选择，没有设置选择器时随机选择，
+// 连接和握手的超时时间为callTimeout，流本身只在ctx结束或者WithTimeout选项超时后关闭
+func (s *Service) Stream(ctx context.Context, method string, opts ...CallOption) (*joystream.Stream, error) {
+	if len(opts) > 0 {
+		ctx = WithCallOptions(ctx, opts...)
+	}
+	cancel := func() {}
+	if timeout := getCallOptions(ctx).timeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	stream, err := s.dialStream(ctx, method)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		<-stream.Context().Done()
+		cancel()
+	}()
+	return stream, nil
+}
+
+func (s *Service) dialStream(ctx context.Context, method string) (*joystream.Stream, error) {
+	addr, err := s.selectStreamNode(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = rpc_context.Outgoing(ctx)
+	header := &joystream.Header{Service: s.ServiceName, Method: method}
+	header.Metadata, _ = ctx.Value(share.ReqMetaDataKey).(map[string]string)
+	if deadline, find := ctx.Deadline(); find {
+		header.Timeout = time.Until(deadline).Milliseconds()
+		if header.Timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: s.callTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial stream %v.%v node %v error:%v", s.ServiceName, method, addr, err)
+	}
+	stream, err := joystream.Dial(ctx, conn, header, s.callTimeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// selectStreamNode 选择流式调用的节点，返回ip:port
+func (s *Service) selectStreamNode(ctx context.Context, method string) (string, error) {
+	if _, err := s.getXClient(); err != nil {
+		return "", err
+	}
+
+	var node string
+	if selector := s.getSelector(); selector != nil {
+		node = selector.Select(ctx, s.ServiceName, method, nil)
+	} else {
+		nodes, err := s.nodes()
+		if err != nil {
+			return "", err
+		}
+		if len(nodes) > 0 {
+			node = nodes[rand.Intn(len(nodes))]
+		}
+	}
+	if node == "" {
+		return "", client.ErrXClientNoServer
+	}
+	if strs := strings.SplitN(node, "@", 2); len(strs) == 2 {
+		node = strs[1]
+	}
+	return node, nil
+}
@@ -0,0 +1,20 @@
+package joyservice
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/joymicro/rpc_context"
+
+	"github.com/smallnest/rpcx/protocol"
+	"github.com/smallnest/rpcx/share"
+)
+
+// contextPlugin 从请求metadata恢复调用方、请求id、透传数据到处理调用的ctx，
+// 处理中再发起的JoyClient调用会继续传递，剩余超时时间由rpcx恢复为ctx的deadline
+type contextPlugin struct{}
+
+func (p *contextPlugin) PreHandleRequest(ctx context.Context, req *protocol.Message) error {
+	if sctx, ok := ctx.(*share.Context); ok {
+		rpc_context.Incoming(sctx, req.ServicePath, req.Metadata)
+	}
+	return nil
+}
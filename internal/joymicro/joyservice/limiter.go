@@ -0,0 +1,194 @@
+package joyservice
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/joymicro/util"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/smallnest/rpcx/protocol"
+	"github.com/smallnest/rpcx/share"
+)
+
+// LimitConfig 服务端限流配置
+type LimitConfig struct {
+	Rate        float64 // 每秒允许的调用数，令牌桶限流，<=0时不限
+	Burst       int     // 令牌桶容量，<=0时为Rate
+	MaxInflight int     // 最多同时处理的调用数，<=0时不限，单向调用(oneway)不统计
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Max(rate, 1)
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// reset 修改速率和容量，保留当前令牌数
+func (tb *tokenBucket) reset(rate float64, burst int) {
+	nb := newTokenBucket(rate, burst)
+	tb.rate, tb.burst = nb.rate, nb.burst
+	tb.tokens = math.Min(tb.tokens, tb.burst)
+}
+
+// refill 按经过的时间补充令牌，返回是否有可用令牌
+func (tb *tokenBucket) refill(now time.Time) bool {
+	tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+	return tb.tokens >= 1
+}
+
+// limiter 一个限流维度(所有服务、某个服务、某个方法)的限流器
+type limiter struct {
+	name     string
+	cfg      LimitConfig
+	bucket   *tokenBucket
+	inflight int
+}
+
+// limitKey 限流维度，service为空表示所有服务，method为空表示服务的所有方法
+type limitKey struct {
+	service string
+	method  string
+}
+
+type limitReleaseKey struct{}
+
+type limitOnewayKey struct{}
+
+// limitPlugin 服务端限流插件，调用前依次检查所有服务、服务、方法三个维度的限流，
+// 超过限制返回过载错误，调用结束写回复前释放处理中调用数
+type limitPlugin struct {
+	lock     *sync.Mutex
+	limiters map[limitKey]*limiter
+}
+
+func newLimitPlugin() *limitPlugin {
+	return &limitPlugin{
+		lock:     new(sync.Mutex),
+		limiters: make(map[limitKey]*limiter),
+	}
+}
+
+func (p *limitPlugin) set(service, method string, cfg LimitConfig) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := limitKey{service: service, method: method}
+	name := "*"
+	if service != "" {
+		name = service
+		if method != "" {
+			name += "." + method
+		}
+	}
+	// 已有的限流器原地修改配置，处理中的调用持有同一个限流器，释放时计数正确
+	l := p.limiters[key]
+	if l == nil {
+		l = &limiter{name: name}
+		p.limiters[key] = l
+	}
+	l.cfg = cfg
+	switch {
+	case cfg.Rate <= 0:
+		l.bucket = nil
+	case l.bucket == nil:
+		l.bucket = newTokenBucket(cfg.Rate, cfg.Burst)
+	default:
+		l.bucket.reset(cfg.Rate, cfg.Burst)
+	}
+}
+
+// acquire 检查限流，所有维度都通过后才消耗令牌、增加处理中调用数，返回需要释放的限流器
+func (p *limitPlugin) acquire(service, method string, countInflight bool) ([]*limiter, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	var passed []*limiter
+	for _, key := range []limitKey{{}, {service: service}, {service: service, method: method}} {
+		l := p.limiters[key]
+		if l == nil {
+			continue
+		}
+		if countInflight && l.cfg.MaxInflight > 0 && l.inflight >= l.cfg.MaxInflight {
+			return nil, fmt.Errorf("%v: %v inflight calls reach limit %v", util.OverloadedError, l.name, l.cfg.MaxInflight)
+		}
+		if l.bucket != nil && !l.bucket.refill(now) {
+			return nil, fmt.Errorf("%v: %v calls exceed rate limit %v/s", util.OverloadedError, l.name, l.cfg.Rate)
+		}
+		passed = append(passed, l)
+	}
+
+	var acquired []*limiter
+	for _, l := range passed {
+		if l.bucket != nil {
+			l.bucket.tokens--
+		}
+		if countInflight {
+			l.inflight++
+			acquired = append(acquired, l)
+		}
+	}
+	return acquired, nil
+}
+
+func (p *limitPlugin) releaseLocked(acquired []*limiter) {
+	for _, l := range acquired {
+		l.inflight--
+	}
+}
+
+func (p *limitPlugin) release(acquired []*limiter) {
+	if len(acquired) == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.releaseLocked(acquired)
+}
+
+// PreHandleRequest 标记单向调用，单向调用不写回复，无法释放处理中调用数，只做速率限制
+func (p *limitPlugin) PreHandleRequest(ctx context.Context, req *protocol.Message) error {
+	if sctx, ok := ctx.(*share.Context); ok && req.IsOneway() {
+		sctx.SetValue(limitOnewayKey{}, true)
+	}
+	return nil
+}
+
+func (p *limitPlugin) PreCall(ctx context.Context, serviceName, methodName string, args interface{}) (interface{}, error) {
+	sctx, isShareContext := ctx.(*share.Context)
+	countInflight := isShareContext && sctx.Value(limitOnewayKey{}) == nil
+	acquired, err := p.acquire(serviceName, methodName, countInflight)
+	if err != nil {
+		return args, err
+	}
+	if len(acquired) > 0 {
+		sctx.SetValue(limitReleaseKey{}, acquired)
+	}
+	return args, nil
+}
+
+// PreWriteResponse 调用处理完写回复前释放处理中调用数
+func (p *limitPlugin) PreWriteResponse(ctx context.Context, req *protocol.Message, res *protocol.Message, err error) error {
+	sctx, ok := ctx.(*share.Context)
+	if !ok {
+		return nil
+	}
+	if acquired, ok := sctx.Value(limitReleaseKey{}).([]*limiter); ok {
+		sctx.DeleteKey(limitReleaseKey{})
+		p.release(acquired)
+	}
+	return nil
+}
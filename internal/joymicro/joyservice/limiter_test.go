@@ -0,0 +1,90 @@
+package joyservice
+
+import (
+	"github.com/xlkness/lkit-go/internal/joymicro/util"
+	"testing"
+)
+
+func TestLimitPlugin(t *testing.T) {
+	p := newLimitPlugin()
+	p.set("", "", LimitConfig{MaxInflight: 3})
+	p.set("hello", "Say", LimitConfig{MaxInflight: 1})
+	p.set("hello", "Ping", LimitConfig{Rate: 1, Burst: 2})
+
+	acquired, err := p.acquire("hello", "Say", true)
+	if err != nil || len(acquired) != 2 {
+		t.Fatalf("acquire error:%v, acquired:%v", err, len(acquired))
+	}
+	_, err = p.acquire("hello", "Say", true)
+	if !util.IsOverloadedError(err) {
+		t.Fatalf("method inflight limit error:%v", err)
+	}
+
+	// 方法限流拒绝后回滚所有服务维度的处理中调用数
+	if _, err = p.acquire("hello", "Ping", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.acquire("hello", "Ping", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.acquire("hello", "Ping", false); !util.IsOverloadedError(err) {
+		t.Fatalf("method rate limit error:%v", err)
+	}
+	if inflight := p.limiters[limitKey{}].inflight; inflight != 2 {
+		t.Fatalf("global inflight error:%v", inflight)
+	}
+
+	p.releaseLocked(acquired)
+	if _, err = p.acquire("hello", "Say", true); err != nil {
+		t.Fatalf("acquire after release error:%v", err)
+	}
+}
+
+func TestLimitPluginReconfigure(t *testing.T) {
+	p := newLimitPlugin()
+	p.set("hello", "", LimitConfig{MaxInflight: 2, Rate: 100})
+
+	acquired, err := p.acquire("hello", "Say", true)
+	if err != nil || len(acquired) != 1 {
+		t.Fatalf("acquire error:%v, acquired:%v", err, len(acquired))
+	}
+
+	// 有处理中的调用时修改配置，调用结束释放后新配置的容量完整
+	p.set("hello", "", LimitConfig{MaxInflight: 1, Rate: 100})
+	if _, err = p.acquire("hello", "Say", true); !util.IsOverloadedError(err) {
+		t.Fatalf("inflight limit after reconfigure error:%v", err)
+	}
+	p.releaseLocked(acquired)
+	if acquired, err = p.acquire("hello", "Say", true); err != nil {
+		t.Fatalf("acquire after reconfigure release error:%v", err)
+	}
+	p.releaseLocked(acquired)
+
+	p.set("hello", "", LimitConfig{MaxInflight: 1})
+	if l := p.limiters[limitKey{service: "hello"}]; l.inflight != 0 || l.bucket != nil {
+		t.Fatalf("reconfigure limiter error, inflight:%v, bucket:%v", l.inflight, l.bucket)
+	}
+}
+
+func TestLimitPluginRejectKeepsTokens(t *testing.T) {
+	p := newLimitPlugin()
+	p.set("", "", LimitConfig{Rate: 0.001, Burst: 2})
+	p.set("hello", "", LimitConfig{Rate: 0.001, Burst: 2})
+	p.set("hello", "Say", LimitConfig{Rate: 0.001, Burst: 1})
+
+	if _, err := p.acquire("hello", "Say", false); err != nil {
+		t.Fatal(err)
+	}
+	// 方法维度拒绝的调用不消耗所有服务、服务维度的令牌
+	for i := 0; i < 3; i++ {
+		if _, err := p.acquire("hello", "Say", false); !util.IsOverloadedError(err) {
+			t.Fatalf("method rate limit error:%v", err)
+		}
+	}
+	if _, err := p.acquire("hello", "Ping", false); err != nil {
+		t.Fatalf("rejected calls consume service tokens:%v", err)
+	}
+	if _, err := p.acquire("hello", "Ping", false); !util.IsOverloadedError(err) {
+		t.Fatalf("service rate limit error:%v", err)
+	}
+}
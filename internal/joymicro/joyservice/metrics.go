@@ -0,0 +1,103 @@
+package joyservice
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/joymicro/util"
+	"github.com/xlkness/lkit-go/internal/trace/prom"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/smallnest/rpcx/protocol"
+	"github.com/smallnest/rpcx/server"
+	"github.com/smallnest/rpcx/share"
+)
+
+var (
+	serverMetricsOnce    = new(sync.Once)
+	serverCallCounter    *prom.PromeCounterStatMgr
+	serverCallHistogram  *prom.PromeHistogramStatMgr
+	serverMetricsBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 3, 10}
+)
+
+func initServerMetrics() {
+	serverMetricsOnce.Do(func() {
+		serverCallCounter = prom.NewCounter("rpc_server_handled_total").InitLabels([]string{"service", "method", "peer", "code"})
+		serverCallHistogram = prom.NewHistogram("rpc_server_handling_duration_seconds", serverMetricsBuckets).
+			InitLabels([]string{"service", "method", "peer"})
+	})
+}
+
+type metricsStartKey struct{}
+type metricsOnewayKey struct{}
+
+// metricsPlugin 服务端监控插件，统计每个服务方法、调用方ip的调用数、错误码、处理耗时。
+// 单向调用不写回复，处理成功后在PostCall统计，rpcx处理失败时不调用PostCall，失败的单向调用统计不到
+type metricsPlugin struct{}
+
+func newMetricsPlugin() *metricsPlugin {
+	initServerMetrics()
+	return &metricsPlugin{}
+}
+
+// PreHandleRequest 记录开始处理时间，标记单向调用
+func (p *metricsPlugin) PreHandleRequest(ctx context.Context, req *protocol.Message) error {
+	if sctx, ok := ctx.(*share.Context); ok {
+		sctx.SetValue(metricsStartKey{}, time.Now())
+		if req.IsOneway() {
+			sctx.SetValue(metricsOnewayKey{}, true)
+		}
+	}
+	return nil
+}
+
+// PostCall 统计处理成功的单向调用
+func (p *metricsPlugin) PostCall(ctx context.Context, serviceName, methodName string, args, reply interface{}) (interface{}, error) {
+	if ctx.Value(metricsOnewayKey{}) != nil {
+		p.observe(ctx, serviceName, methodName, nil)
+	}
+	return reply, nil
+}
+
+func (p *metricsPlugin) PreWriteResponse(ctx context.Context, req *protocol.Message, res *protocol.Message, err error) error {
+	if req == nil {
+		return nil
+	}
+	p.observe(ctx, req.ServicePath, req.ServiceMethod, err)
+	return nil
+}
+
+func (p *metricsPlugin) observe(ctx context.Context, service, method string, err error) {
+	start, ok := ctx.Value(metricsStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+
+	peer := "unknown"
+	if conn, ok := ctx.Value(server.RemoteConnContextKey).(net.Conn); ok {
+		peer = remotePeer(conn)
+	}
+	observeServerCall(service, method, peer, start, err)
+}
+
+// remotePeer 调用方ip
+func remotePeer(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// observeServerCall 统计一次调用，流式调用流结束时统计
+func observeServerCall(service, method, peer string, start time.Time, err error) {
+	code := "ok"
+	if err != nil {
+		code = "error"
+		if util.IsOverloadedError(err) {
+			code = "overloaded"
+		}
+	}
+	serverCallCounter.LabelValues(service, method, peer, code).Inc()
+	serverCallHistogram.LabelValues(service, method, peer).Observe(time.Since(start).Seconds())
+}
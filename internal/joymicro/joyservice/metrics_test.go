@@ -0,0 +1,39 @@
+package joyservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/smallnest/rpcx/protocol"
+	"github.com/smallnest/rpcx/share"
+)
+
+func TestMetricsPluginOneway(t *testing.T) {
+	p := newMetricsPlugin()
+	count := func() float64 {
+		return testutil.ToFloat64(serverCallCounter.LabelValues("metrics_test", "Notify", "unknown", "ok"))
+	}
+	before := count()
+
+	// 单向调用不写回复，处理成功后统计
+	req := protocol.NewMessage()
+	req.ServicePath, req.ServiceMethod = "metrics_test", "Notify"
+	req.SetOneway(true)
+	ctx := share.NewContext(context.Background())
+	p.PreHandleRequest(ctx, req)
+	p.PostCall(ctx, req.ServicePath, req.ServiceMethod, nil, nil)
+	if got := count() - before; got != 1 {
+		t.Fatalf("oneway call counted %v times", got)
+	}
+
+	// 普通调用在写回复前统计，PostCall不重复统计
+	req.SetOneway(false)
+	ctx = share.NewContext(context.Background())
+	p.PreHandleRequest(ctx, req)
+	p.PostCall(ctx, req.ServicePath, req.ServiceMethod, nil, nil)
+	p.PreWriteResponse(ctx, req, nil, nil)
+	if got := count() - before; got != 2 {
+		t.Fatalf("calls counted %v times", got)
+	}
+}
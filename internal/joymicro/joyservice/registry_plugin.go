@@ -0,0 +1,55 @@
+package joyservice
+
+import (
+	"sync/atomic"
+
+	"github.com/smallnest/rpcx/server"
+)
+
+// registryPlugin 包装注册中心插件，停止时先分离，rpcx停止时不再重复注销，
+// rpcx的插件列表没有加锁，运行中不能用Plugins.Remove移除
+type registryPlugin struct {
+	plugin   server.Plugin
+	detached int32
+}
+
+func newRegistryPlugin(p server.Plugin) *registryPlugin {
+	return &registryPlugin{plugin: p}
+}
+
+func (p *registryPlugin) Register(name string, rcvr interface{}, metadata string) error {
+	if r, ok := p.plugin.(server.RegisterPlugin); ok && !p.isDetached() {
+		return r.Register(name, rcvr, metadata)
+	}
+	return nil
+}
+
+func (p *registryPlugin) RegisterFunction(serviceName, fname string, fn interface{}, metadata string) error {
+	if r, ok := p.plugin.(server.RegisterFunctionPlugin); ok && !p.isDetached() {
+		return r.RegisterFunction(serviceName, fname, fn, metadata)
+	}
+	return nil
+}
+
+func (p *registryPlugin) Unregister(name string) error {
+	if r, ok := p.plugin.(server.RegisterPlugin); ok && !p.isDetached() {
+		return r.Unregister(name)
+	}
+	return nil
+}
+
+// detach 分离注册中心，之后的注册、注销都不再转发
+func (p *registryPlugin) detach() {
+	atomic.StoreInt32(&p.detached, 1)
+}
+
+func (p *registryPlugin) isDetached() bool {
+	return atomic.LoadInt32(&p.detached) == 1
+}
+
+// stop 停止注册中心插件，例如consul的心跳
+func (p *registryPlugin) stop() {
+	if stopper, ok := p.plugin.(interface{ Stop() error }); ok {
+		stopper.Stop()
+	}
+}
@@ -2,47 +2,65 @@ package joyservice
 
 import (
 	"context"
+	"fmt"
 	"github.com/xlkness/lkit-go/internal/joymicro/registry"
 	"github.com/xlkness/lkit-go/internal/joymicro/rpc_tracer"
-	"github.com/xlkness/lkit-go/internal/joymicro/util"
+	"github.com/xlkness/lkit-go/internal/libsyscal"
+	"net"
 	"net/url"
+	"sync"
 	"time"
 
 	rotel "github.com/rpcxio/rpcx-plugins/client/otel"
 	"github.com/smallnest/rpcx/server"
 )
 
-var DefaultEtcdHeartBeatInterval = time.Second * 3
-
 type ServicesManager struct {
 	ListenAddr string
-	Addr       string         // 节点提供rpc服务的地址
-	rpcserver  *server.Server // rpc服务器，用来注册服务，服务发现等
+	Addr       string          // 节点提供rpc服务的地址
+	rpcserver  *server.Server  // rpc服务器，用来注册服务，服务发现等
+	registry   *registryPlugin // 注册中心插件，停止时需要注销
+	limiter    *limitPlugin    // 限流插件，没有设置限流时不限制
+	streams    *streamPlugin   // 流式调用
+	stateLock  *sync.Mutex
+	ln         net.Listener  // Run的监听，停止时关闭
+	bound      chan struct{} // Run监听成功后关闭
 	isRunning  bool
+	isStopped  bool // 已经停止，之后Run直接返回
+	stopOnce   *sync.Once
 }
 
+// DefaultDeregisterWait 停止服务时从注册中心注销后，等待调用方感知节点下线的时间，之后再停止监听
+var DefaultDeregisterWait = time.Second
+
 // New 创建一个服务
 // service:服务器名称
 // addr:当前节点服务对外可以访问的地址，不是监听地址，必须为"ip+:+port"格式
-// etcdServerAddrs:etcd服务地址
-func New(listenAddr, exposeAddr string, etcdServerAddrs []string) (*ServicesManager, error) {
-	return NewWithKey("", listenAddr, exposeAddr, etcdServerAddrs)
+// r:注册中心，例如registry.NewEtcdRegistry
+func New(listenAddr, exposeAddr string, r registry.Registry) (*ServicesManager, error) {
+	return NewWithKey("", listenAddr, exposeAddr, r)
 }
 
 // NewWithKey 创建一个带主键的服务，用于点对点通信
 // service:服务器名称
 // addr:当前节点服务对外可以访问的地址，不是监听地址，必须为"ip+:+port"格式
-// etcdServerAddrs:etcd服务地址
-func NewWithKey(key string, listenAddr, exposeAddr string, etcdServerAddrs []string) (*ServicesManager, error) {
-	etcdServerAddrs = util.PreHandleEtcdHttpAddrs(etcdServerAddrs)
+// r:注册中心，例如registry.NewEtcdRegistry
+func NewWithKey(key string, listenAddr, exposeAddr string, r registry.Registry) (*ServicesManager, error) {
+	if r == nil {
+		return nil, fmt.Errorf("registry is nil")
+	}
+	if key == "" {
+		key = "tcp"
+	}
 	m := newServersManager(listenAddr, exposeAddr)
 
-	// 添加etcd注册中心
-	r, err := registry.GetEtcdRegistryServerPlugin(key, m.Addr, etcdServerAddrs, DefaultEtcdHeartBeatInterval)
+	// 添加注册中心
+	p, err := r.ServerPlugin(key + "@" + m.Addr)
 	if err != nil {
 		return nil, err
 	}
-	m.rpcserver.Plugins.Add(r)
+	m.registry = newRegistryPlugin(p)
+	m.rpcserver.Plugins.Add(m.registry)
 	m.enableTracer()
 
 	return m, nil
@@ -69,6 +87,13 @@ func (m *ServicesManager) RegisterOneService(service string, handler interface{}
 		return nil
 	}
 
+	m.streams.lock.Lock()
+	m.streams.services[service] = true
+	m.streams.lock.Unlock()
+	return m.registerName(service, handler, metaKVs)
+}
+
+func (m *ServicesManager) registerName(service string, handler interface{}, metaKVs map[string]string) error {
 	values := make(url.Values)
 	for k, v := range metaKVs {
 		values.Add(k, v)
@@ -76,6 +101,28 @@ func (m *ServicesManager) RegisterOneService(service string, handler interface{}
 	return m.rpcserver.RegisterName(service, handler, values.Encode())
 }
 
+// SetLimit 设置限流，超过限制的调用返回过载错误，客户端不会重试，可以在运行中修改
+// service:服务名，为空时对所有服务生效
+// method:方法名，为空时对服务的所有方法生效
+// 所有服务、服务、方法三个维度的限流同时生效
+func (m *ServicesManager) SetLimit(service, method string, cfg LimitConfig) {
+	if m == nil {
+		return
+	}
+	m.limiter.set(service, method, cfg)
+}
+
+// DisableGateway 关闭rpcx的http网关和jsonrpc，只支持rpcx协议调用，必须在Run之前调用。
+// rpcx在ServeListener的goroutine里无锁创建这两个服务器，Shutdown无锁读取，
+// 刚启动就停止的服务（例如测试）关闭它们可以避免数据竞争
+func (m *ServicesManager) DisableGateway() {
+	if m == nil {
+		return
+	}
+	m.rpcserver.DisableHTTPGateway = true
+	m.rpcserver.DisableJSONRPC = true
+}
+
 // Run 启动rpc服务
 // addr：监听地址，可以忽略ip，例如":8888"格式
 // 注意：register过程必须在start之前
@@ -84,29 +131,132 @@ func (m *ServicesManager) Run() error {
 		return nil
 	}
 
-	if m.isRunning {
+	m.stateLock.Lock()
+	if m.isRunning || m.isStopped {
+		m.stateLock.Unlock()
 		return nil
 	}
+	// 通过libsyscal监听，热升级时监听会传递给新进程
+	ln, err := libsyscal.Listen("tcp", m.ListenAddr)
+	if err != nil {
+		m.stateLock.Unlock()
+		return err
+	}
+	m.ln = ln
 	m.isRunning = true
-	err := m.rpcserver.Serve("tcp", m.ListenAddr)
+	select {
+	case <-m.bound:
+	default:
+		close(m.bound)
+	}
+	m.stateLock.Unlock()
+
+	err = m.rpcserver.ServeListener("tcp", ln)
 	if err == server.ErrServerClosed {
 		err = nil
 	}
+	m.stateLock.Lock()
 	m.isRunning = false
+	m.stateLock.Unlock()
 	return err
 }
 
-func (m *ServicesManager) Stop() {
+// Bound Run监听成功后关闭，之后可以接收rpc调用
+func (m *ServicesManager) Bound() <-chan struct{} {
 	if m == nil {
-		return
+		bound := make(chan struct{})
+		close(bound)
+		return bound
 	}
+	return m.bound
+}
+
+// stop 标记停止，返回Run的监听，没有运行时为空
+func (m *ServicesManager) stop() net.Listener {
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+	m.isStopped = true
 	if !m.isRunning {
-		return
+		return nil
 	}
-	m.isRunning = false
+	return m.ln
+}
+
+// closeListener 停止rpc服务后关闭监听，rpcx还没有开始accept时关闭不到监听，Run会一直阻塞
+func (m *ServicesManager) closeListener(ctx context.Context, ln net.Listener) error {
+	err := m.rpcserver.Shutdown(ctx)
+	ln.Close()
+	m.streams.closeAll()
+	return err
+}
+
+func (m *ServicesManager) Stop() {
 	ctx, f := context.WithTimeout(context.Background(), time.Second*5)
 	defer f()
-	m.rpcserver.Shutdown(ctx)
+	m.Shutdown(ctx)
+}
+
+// Shutdown 优雅停止rpc服务，先从注册中心注销所有服务，让调用方不再选中本节点，
+// 再停止监听并等待处理中的请求完成或者ctx超时
+func (m *ServicesManager) Shutdown(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+
+	var err error
+	m.stopOnce.Do(func() {
+		ln := m.stop()
+		err = m.Deregister()
+		if m.registry != nil {
+			// 已经注销，rpcx停止时不再重复注销
+			m.registry.detach()
+			m.registry.stop()
+		}
+
+		if ln == nil {
+			return
+		}
+		if DefaultDeregisterWait > 0 {
+			select {
+			case <-time.After(DefaultDeregisterWait):
+			case <-ctx.Done():
+			}
+		}
+		if err1 := m.closeListener(ctx, ln); err1 != nil && err == nil {
+			err = err1
+		}
+	})
+	return err
+}
+
+// ShutdownForUpgrade 热升级时停止rpc服务，新进程已经用同样的地址注册了服务，所以不从注册中心注销，
+// 只停止监听并等待处理中的请求完成或者ctx超时
+func (m *ServicesManager) ShutdownForUpgrade(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+
+	var err error
+	m.stopOnce.Do(func() {
+		ln := m.stop()
+		if m.registry != nil {
+			m.registry.detach()
+		}
+
+		if ln == nil {
+			return
+		}
+		err = m.closeListener(ctx, ln)
+	})
+	return err
+}
+
+// Deregister 从注册中心注销本节点的所有服务，但不停止rpc服务
+func (m *ServicesManager) Deregister() error {
+	if m == nil {
+		return nil
+	}
+	return m.rpcserver.UnregisterAll()
 }
 
 func newServersManager(listenAddr, exposeAddr string) *ServicesManager {
@@ -114,7 +264,16 @@ func newServersManager(listenAddr, exposeAddr string) *ServicesManager {
 		ListenAddr: listenAddr,
 		Addr:       exposeAddr,
 		rpcserver:  server.NewServer(),
+		limiter:    newLimitPlugin(),
+		bound:      make(chan struct{}),
+		stateLock:  new(sync.Mutex),
+		stopOnce:   new(sync.Once),
 	}
+	m.streams = newStreamPlugin(m.limiter)
+	m.rpcserver.Plugins.Add(&contextPlugin{})
+	m.rpcserver.Plugins.Add(m.limiter)
+	m.rpcserver.Plugins.Add(newMetricsPlugin())
+	m.rpcserver.Plugins.Add(m.streams)
 
 	return m
 }
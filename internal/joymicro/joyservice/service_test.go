@@ -0,0 +1,137 @@
+package joyservice
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T, r registry.Registry) *ServicesManager {
+	m, err := New("127.0.0.1:0", "127.0.0.1:1", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.DisableGateway()
+	if err = m.RegisterOneService("hello", new(streamPlaceholder), nil); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func runService(m *ServicesManager) chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run()
+	}()
+	return done
+}
+
+func TestShutdownBeforeRun(t *testing.T) {
+	m := newTestService(t, registry.NewMemoryRegistry())
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-runService(m):
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("run after shutdown not return")
+	}
+}
+
+func TestShutdownDeregisterWait(t *testing.T) {
+	old := DefaultDeregisterWait
+	DefaultDeregisterWait = time.Millisecond * 300
+	defer func() { DefaultDeregisterWait = old }()
+
+	r := registry.NewMemoryRegistry()
+	m := newTestService(t, r)
+	done := runService(m)
+
+	var addr string
+	for i := 0; i < 100 && addr == ""; i++ {
+		m.stateLock.Lock()
+		if m.isRunning {
+			addr = m.ln.Addr().String()
+		}
+		m.stateLock.Unlock()
+		time.Sleep(time.Millisecond * 10)
+	}
+	if addr == "" {
+		t.Fatal("service not running")
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- m.Shutdown(context.Background())
+	}()
+
+	// 注销后等待期间节点已经不在注册中心，但是仍然接受连接
+	time.Sleep(time.Millisecond * 100)
+	if nodes := r.Services("hello"); len(nodes) != 0 {
+		t.Fatalf("nodes after deregister:%v", nodes)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial during deregister wait error:%v", err)
+	}
+	conn.Close()
+
+	if err = <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("run not return after shutdown")
+	}
+}
+
+func TestGatewayEnabledByDefault(t *testing.T) {
+	m, err := New("127.0.0.1:0", "127.0.0.1:1", registry.NewMemoryRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.rpcserver.DisableHTTPGateway || m.rpcserver.DisableJSONRPC {
+		t.Fatalf("rpcx http gateway and jsonrpc should be enabled by default")
+	}
+	m.DisableGateway()
+	if !m.rpcserver.DisableHTTPGateway || !m.rpcserver.DisableJSONRPC {
+		t.Fatalf("rpcx http gateway and jsonrpc should be disabled")
+	}
+}
+
+func TestShutdownRightAfterRun(t *testing.T) {
+	old := DefaultDeregisterWait
+	DefaultDeregisterWait = 0
+	defer func() { DefaultDeregisterWait = old }()
+
+	m := newTestService(t, registry.NewMemoryRegistry())
+	done := runService(m)
+	<-m.Bound()
+
+	// http网关、jsonrpc关闭，刚启动就停止-race下不能有数据竞争
+	start := time.Now()
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("shutdown right after run cost:%v", cost)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("run not return after shutdown")
+	}
+}
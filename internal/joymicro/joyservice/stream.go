@@ -0,0 +1,164 @@
+package joyservice
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/joymicro/joystream"
+	"github.com/xlkness/lkit-go/internal/joymicro/rpc_context"
+	"github.com/xlkness/lkit-go/internal/log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/smallnest/rpcx/share"
+	"github.com/soheilhy/cmux"
+)
+
+// StreamHandler 流式调用处理函数，返回后流结束，返回错误时对端Recv收到错误，否则收到io.EOF
+type StreamHandler func(ctx context.Context, stream *joystream.Stream) error
+
+// streamPlaceholder 只有流式方法的服务注册到rpcx的占位处理，rpcx不允许注册没有方法的服务，
+// 注册后服务节点才会出现在注册中心被客户端发现
+type streamPlaceholder struct{}
+
+func (p *streamPlaceholder) StreamPing(ctx context.Context, args *struct{}, reply *struct{}) error {
+	return nil
+}
+
+// streamPlugin 流式调用和rpcx共用监听端口，按魔数分出流式连接，每个连接一个流，
+// 流不经过rpcx的插件，这里和普通调用一样限流、统计监控，流存在期间占用处理中调用数
+type streamPlugin struct {
+	lock     *sync.Mutex
+	limiter  *limitPlugin
+	handlers map[string]StreamHandler // service.method -> 处理函数
+	services map[string]bool          // 已经注册到rpcx的服务
+	streams  map[*joystream.Stream]struct{}
+}
+
+func newStreamPlugin(limiter *limitPlugin) *streamPlugin {
+	initServerMetrics()
+	return &streamPlugin{
+		lock:     new(sync.Mutex),
+		limiter:  limiter,
+		handlers: make(map[string]StreamHandler),
+		services: make(map[string]bool),
+		streams:  make(map[*joystream.Stream]struct{}),
+	}
+}
+
+func (p *streamPlugin) MuxMatch(m cmux.CMux) {
+	ln := m.Match(joystream.Matcher)
+	go p.serve(ln)
+}
+
+// serve 接收流式连接，rpc服务停止时监听关闭后返回
+func (p *streamPlugin) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *streamPlugin) handle(conn net.Conn) {
+	header, reader, err := joystream.Accept(conn)
+	if err != nil {
+		log.Warnf("accept stream from %v error:%v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	start := time.Now()
+	peer := remotePeer(conn)
+	p.lock.Lock()
+	handler := p.handlers[header.Service+"."+header.Method]
+	p.lock.Unlock()
+	if handler == nil {
+		err = fmt.Errorf("stream %v.%v not found", header.Service, header.Method)
+		observeServerCall(header.Service, header.Method, peer, start, err)
+		joystream.Reject(conn, err)
+		conn.Close()
+		return
+	}
+
+	acquired, err := p.limiter.acquire(header.Service, header.Method, true)
+	if err != nil {
+		observeServerCall(header.Service, header.Method, peer, start, err)
+		joystream.Reject(conn, err)
+		conn.Close()
+		return
+	}
+	defer p.limiter.release(acquired)
+
+	ctx := context.Background()
+	if header.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(header.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	sctx := share.NewContext(ctx)
+	sctx.SetValue(share.ReqMetaDataKey, header.Metadata)
+	rpc_context.Incoming(sctx, header.Service, header.Metadata)
+
+	stream, err := joystream.Ack(sctx, conn, reader)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	p.lock.Lock()
+	p.streams[stream] = struct{}{}
+	p.lock.Unlock()
+	defer func() {
+		p.lock.Lock()
+		delete(p.streams, stream)
+		p.lock.Unlock()
+	}()
+
+	err = p.call(header.Service+"."+header.Method, handler, stream)
+	stream.Finish(err)
+	observeServerCall(header.Service, header.Method, peer, start, err)
+}
+
+// call 调用处理函数，panic转换为错误返回给对端
+func (p *streamPlugin) call(name string, handler StreamHandler, stream *joystream.Stream) (err error) {
+	defer log.CatchWithInfoError(fmt.Sprintf("stream handler %v", name), &err)
+	return handler(stream.Context(), stream)
+}
+
+// closeAll 关闭所有处理中的流
+func (p *streamPlugin) closeAll() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for stream := range p.streams {
+		stream.Close()
+	}
+}
+
+// RegisterStream 注册流式调用的处理函数
+// service:服务名
+// method:方法名
+// metaKVs:服务只有流式方法时，注册服务节点的metadata，服务有普通方法时使用RegisterOneService的metadata
+// 注意：服务有普通方法时先调用RegisterOneService
+func (m *ServicesManager) RegisterStream(service, method string, handler StreamHandler, metaKVs map[string]string) error {
+	if m == nil {
+		return nil
+	}
+
+	m.streams.lock.Lock()
+	m.streams.handlers[service+"."+method] = handler
+	registered := m.streams.services[service]
+	m.streams.services[service] = true
+	m.streams.lock.Unlock()
+	if registered {
+		return nil
+	}
+	err := m.registerName(service, new(streamPlaceholder), metaKVs)
+	if err != nil {
+		m.streams.lock.Lock()
+		delete(m.streams.services, service)
+		m.streams.lock.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package joyservice
+
+import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/joymicro/joystream"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"github.com/xlkness/lkit-go/internal/joymicro/util"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func dialTestStream(t *testing.T, addr, service, method string) (*joystream.Stream, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := joystream.Dial(context.Background(), conn, &joystream.Header{Service: service, Method: method}, time.Second)
+	if err != nil {
+		conn.Close()
+	}
+	return stream, err
+}
+
+func TestStreamLimitAndMetrics(t *testing.T) {
+	m := newTestService(t, registry.NewMemoryRegistry())
+	finish := make(chan struct{})
+	err := m.RegisterStream("hello", "Watch", func(ctx context.Context, stream *joystream.Stream) error {
+		<-finish
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetLimit("hello", "Watch", LimitConfig{MaxInflight: 1})
+	go m.Run()
+	defer m.Stop()
+	<-m.Bound()
+	addr := m.ln.Addr().String()
+
+	count := func(code string) float64 {
+		return testutil.ToFloat64(serverCallCounter.LabelValues("hello", "Watch", "127.0.0.1", code))
+	}
+	beforeOk, beforeOverloaded := count("ok"), count("overloaded")
+
+	// 流存在期间占用处理中调用数，第二个流被拒绝
+	stream, err := dialTestStream(t, addr, "hello", "Watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dialTestStream(t, addr, "hello", "Watch"); !util.IsOverloadedError(err) {
+		t.Fatalf("stream over inflight limit error:%v", err)
+	}
+
+	close(finish)
+	if err = stream.Recv(new(struct{})); err != io.EOF {
+		t.Fatalf("stream recv error:%v", err)
+	}
+	// 流结束后释放处理中调用数
+	for i := 0; i < 100; i++ {
+		m.limiter.lock.Lock()
+		inflight := m.limiter.limiters[limitKey{service: "hello", method: "Watch"}].inflight
+		m.limiter.lock.Unlock()
+		if inflight == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	stream, err = dialTestStream(t, addr, "hello", "Watch")
+	if err != nil {
+		t.Fatalf("stream after release error:%v", err)
+	}
+	stream.Close()
+
+	if got := count("ok") - beforeOk; got < 1 {
+		t.Fatalf("stream ok counted %v times", got)
+	}
+	if got := count("overloaded") - beforeOverloaded; got != 1 {
+		t.Fatalf("stream overloaded counted %v times", got)
+	}
+}
+
+func TestStreamHandlerPanic(t *testing.T) {
+	m := newTestService(t, registry.NewMemoryRegistry())
+	err := m.RegisterStream("hello", "Panic", func(ctx context.Context, stream *joystream.Stream) error {
+		panic("stream test panic")
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.Run()
+	defer m.Stop()
+	<-m.Bound()
+
+	// 处理函数panic不影响服务，对端收到错误
+	stream, err := dialTestStream(t, m.ln.Addr().String(), "hello", "Panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if err = stream.Recv(new(struct{})); err == nil || err == io.EOF || !strings.Contains(err.Error(), "stream test panic") {
+		t.Fatalf("stream recv after handler panic error:%v", err)
+	}
+}
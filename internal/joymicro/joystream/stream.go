@@ -0,0 +1,251 @@
+package joystream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/protocol"
+	"github.com/smallnest/rpcx/share"
+)
+
+// Magic 流式调用连接开头的魔数，rpc服务端按它把流式连接和rpcx连接区分开，和rpc服务共用监听端口
+var Magic = []byte("LKSTREAM")
+
+// MaxFrameSize 一帧数据的最大长度
+var MaxFrameSize = 16 << 20
+
+// HandshakeTimeout 服务端等待握手信息的超时时间
+var HandshakeTimeout = time.Second * 10
+
+// 帧类型，帧格式为1字节类型+4字节长度+数据
+const (
+	frameData  byte = 1 // 一条消息
+	frameEOF   byte = 2 // 发送方不再发送，对端Recv返回io.EOF
+	frameError byte = 3 // 处理函数返回的错误，对端Recv返回client.ServiceError
+)
+
+// Header 流式调用的握手信息，客户端发送魔数后发送
+type Header struct {
+	Service  string            `json:"service"`
+	Method   string            `json:"method"`
+	Timeout  int64             `json:"timeout"`  // 剩余超时时间毫秒，0为不超时
+	Metadata map[string]string `json:"metadata"` // 调用方、请求id、透传数据
+}
+
+// Stream 双向流，消息用rpcx默认的msgpack编码，Send和Recv可以在不同的goroutine里同时调用，
+// ctx结束或者Close后连接关闭
+type Stream struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeLock *sync.Mutex
+	closeOnce *sync.Once
+}
+
+// New 用已经完成握手的连接创建流
+func New(ctx context.Context, conn net.Conn) *Stream {
+	return newStream(ctx, conn, bufio.NewReader(conn))
+}
+
+func newStream(ctx context.Context, conn net.Conn, reader *bufio.Reader) *Stream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{
+		ctx:       ctx,
+		cancel:    cancel,
+		conn:      conn,
+		reader:    reader,
+		writeLock: new(sync.Mutex),
+		closeOnce: new(sync.Once),
+	}
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+	return s
+}
+
+// Pipe 创建一对内存中相连的流，用于本地调试模式
+func Pipe(ctx context.Context) (*Stream, *Stream) {
+	c1, c2 := net.Pipe()
+	return New(ctx, c1), New(ctx, c2)
+}
+
+// Context 流的ctx，流关闭后结束
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// Send 发送一条消息
+func (s *Stream) Send(msg interface{}) error {
+	data, err := share.Codecs[protocol.MsgPack].Encode(msg)
+	if err != nil {
+		return fmt.Errorf("encode stream message error:%v", err)
+	}
+	return s.writeFrame(frameData, data)
+}
+
+// Recv 接收一条消息，对端CloseSend或者处理函数正常返回后返回io.EOF
+func (s *Stream) Recv(msg interface{}) error {
+	typ, data, err := readFrame(s.reader)
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return s.ctx.Err()
+		}
+		return err
+	}
+	switch typ {
+	case frameData:
+		err = share.Codecs[protocol.MsgPack].Decode(data, msg)
+		if err != nil {
+			return fmt.Errorf("decode stream message error:%v", err)
+		}
+		return nil
+	case frameEOF:
+		return io.EOF
+	case frameError:
+		return client.NewServiceError(string(data))
+	}
+	return fmt.Errorf("unknown stream frame type %v", typ)
+}
+
+// CloseSend 通知对端不再发送消息，之后仍然可以Recv
+func (s *Stream) CloseSend() error {
+	return s.writeFrame(frameEOF, nil)
+}
+
+// Finish 服务端处理函数返回后结束流，err不为空时对端Recv收到错误，否则收到io.EOF
+func (s *Stream) Finish(err error) {
+	if err != nil {
+		s.writeFrame(frameError, []byte(err.Error()))
+	} else {
+		s.CloseSend()
+	}
+	s.Close()
+}
+
+// Close 关闭流和连接
+func (s *Stream) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.cancel()
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *Stream) writeFrame(typ byte, data []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	err := writeFrame(s.conn, typ, data)
+	if err != nil && s.ctx.Err() != nil {
+		return s.ctx.Err()
+	}
+	return err
+}
+
+func writeFrame(w io.Writer, typ byte, data []byte) error {
+	buf := make([]byte, 5+len(data))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(data)))
+	copy(buf[5:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(head[1:5])
+	if int(size) > MaxFrameSize {
+		return 0, nil, fmt.Errorf("stream frame size %v exceeds %v", size, MaxFrameSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return head[0], data, nil
+}
+
+// Dial 客户端握手，发送魔数和握手信息，服务端确认后返回流，timeout为握手超时时间
+func Dial(ctx context.Context, conn net.Conn, header *Header, timeout time.Duration) (*Stream, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("encode stream header error:%v", err)
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(Magic)
+	writeFrame(buf, frameData, data)
+	if _, err = conn.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("write stream header error:%v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	typ, data, err := readFrame(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read stream handshake error:%v", err)
+	}
+	if typ == frameError {
+		return nil, client.NewServiceError(string(data))
+	}
+	conn.SetDeadline(time.Time{})
+	return newStream(ctx, conn, reader), nil
+}
+
+// Accept 服务端握手，读取魔数和握手信息，由调用方找到处理函数后调用Ack确认或者Reject拒绝
+func Accept(conn net.Conn) (*Header, *bufio.Reader, error) {
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	reader := bufio.NewReader(conn)
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(reader, magic); err != nil || !bytes.Equal(magic, Magic) {
+		return nil, nil, fmt.Errorf("read stream magic error:%v", err)
+	}
+	typ, data, err := readFrame(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read stream header error:%v", err)
+	}
+	header := new(Header)
+	if typ != frameData {
+		return nil, nil, fmt.Errorf("stream header frame type %v invalid", typ)
+	}
+	if err = json.Unmarshal(data, header); err != nil {
+		return nil, nil, fmt.Errorf("decode stream header error:%v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+	return header, reader, nil
+}
+
+// Ack 服务端确认握手，返回流
+func Ack(ctx context.Context, conn net.Conn, reader *bufio.Reader) (*Stream, error) {
+	if err := writeFrame(conn, frameData, nil); err != nil {
+		return nil, fmt.Errorf("write stream handshake error:%v", err)
+	}
+	return newStream(ctx, conn, reader), nil
+}
+
+// Reject 服务端拒绝握手，客户端收到err的错误信息
+func Reject(conn net.Conn, err error) {
+	writeFrame(conn, frameError, []byte(err.Error()))
+}
+
+// Matcher 按魔数匹配流式连接的cmux匹配函数
+func Matcher(r io.Reader) bool {
+	buf := make([]byte, len(Magic))
+	n, _ := io.ReadFull(r, buf)
+	return n == len(Magic) && bytes.Equal(buf, Magic)
+}
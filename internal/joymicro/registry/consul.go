@@ -0,0 +1,326 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/log"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xclient "github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/server"
+)
+
+// DefaultConsulCheckTTL consul服务节点TTL健康检查的超时时间，注册插件每1/3 TTL上报一次存活
+var DefaultConsulCheckTTL = time.Second * 15
+
+// DefaultConsulDeregisterAfter TTL检查持续失败多久后consul自动注销节点，避免进程崩溃残留节点
+var DefaultConsulDeregisterAfter = time.Minute
+
+// DefaultConsulWaitTime 服务发现阻塞查询的最长等待时间
+var DefaultConsulWaitTime = time.Second * 55
+
+const (
+	consulMetaKey      = "rpcx_key"      // 节点key，普通服务为tcp，点对点服务为节点主键
+	consulMetaMetadata = "rpcx_metadata" // rpc服务注册的metadata
+)
+
+// ConsulRegistry consul注册中心，通过consul agent的http接口注册服务并用TTL检查保活，服务发现用阻塞查询监听健康节点的变化
+type ConsulRegistry struct {
+	addr   string // consul agent的http地址，例如http://127.0.0.1:8500
+	token  string
+	client *http.Client
+}
+
+// NewConsulRegistry 创建consul注册中心
+// addr:consul agent地址，例如"127.0.0.1:8500"，可以带http://、https://
+// token:consul acl token，没有开启acl传空
+func NewConsulRegistry(addr string, token string) *ConsulRegistry {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &ConsulRegistry{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: DefaultConsulWaitTime + time.Second*10},
+	}
+}
+
+func (r *ConsulRegistry) ServerPlugin(serviceAddress string) (server.Plugin, error) {
+	strs := strings.SplitN(serviceAddress, "@", 2)
+	if len(strs) != 2 {
+		return nil, fmt.Errorf("invalid consul service address:%v", serviceAddress)
+	}
+	host, portStr, err := net.SplitHostPort(strs[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid consul service address:%v, error:%v", serviceAddress, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid consul service address:%v, error:%v", serviceAddress, err)
+	}
+
+	p := &consulRegisterPlugin{
+		registry:       r,
+		serviceAddress: serviceAddress,
+		key:            strs[0],
+		host:           host,
+		port:           port,
+		services:       make(map[string]string),
+		lock:           new(sync.Mutex),
+		stopChan:       make(chan struct{}),
+		stopOnce:       new(sync.Once),
+	}
+	go p.heartbeat()
+	return p, nil
+}
+
+func (r *ConsulRegistry) Discovery(service string) (xclient.ServiceDiscovery, error) {
+	nodes, index, err := r.healthNodes(context.Background(), service, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &watchDiscovery{cancel: cancel}
+	d.MultipleServersDiscovery, _ = xclient.NewMultipleServersDiscovery(nodes2Pairs(nodes))
+	go r.watch(ctx, service, index, d.MultipleServersDiscovery)
+	return d, nil
+}
+
+// watch 阻塞查询服务的健康节点，consul index变化时推送新的节点列表
+func (r *ConsulRegistry) watch(ctx context.Context, service string, index uint64, d *xclient.MultipleServersDiscovery) {
+	for {
+		nodes, newIndex, err := r.healthNodes(ctx, service, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warnf("consul watch service %v error:%v", service, err)
+			select {
+			case <-time.After(time.Second * 3):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		// index变小说明consul重建了数据，从头开始监听
+		if newIndex < index {
+			newIndex = 0
+		}
+		if newIndex != index {
+			d.Update(nodes2Pairs(nodes))
+		}
+		index = newIndex
+	}
+}
+
+type consulServiceEntry struct {
+	Service struct {
+		ID      string
+		Service string
+		Address string
+		Port    int
+		Meta    map[string]string
+	}
+}
+
+// healthNodes 查询服务通过健康检查的节点，index大于0时为阻塞查询，返回节点和新的consul index
+func (r *ConsulRegistry) healthNodes(ctx context.Context, service string, index uint64) (map[string]string, uint64, error) {
+	query := url.Values{"passing": []string{"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%vs", int(DefaultConsulWaitTime.Seconds())))
+	}
+
+	var entries []*consulServiceEntry
+	header, err := r.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(service)+"?"+query.Encode(), nil, &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	newIndex, _ := strconv.ParseUint(header.Get("X-Consul-Index"), 10, 64)
+
+	nodes := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		key := entry.Service.Meta[consulMetaKey]
+		if key == "" {
+			key = "tcp"
+		}
+		addr := net.JoinHostPort(entry.Service.Address, strconv.Itoa(entry.Service.Port))
+		nodes[key+"@"+addr] = entry.Service.Meta[consulMetaMetadata]
+	}
+	return nodes, newIndex, nil
+}
+
+// do 调用consul http接口，out不为空时解析返回的json
+func (r *ConsulRegistry) do(ctx context.Context, method, path string, in interface{}, out interface{}) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.addr+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if r.token != "" {
+		req.Header.Set("X-Consul-Token", r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul %v %v error:%v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		content, _ := io.ReadAll(resp.Body)
+		return nil, &consulStatusError{code: resp.StatusCode, msg: fmt.Sprintf("consul %v %v response %v:%s", method, path, resp.StatusCode, content)}
+	}
+	if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			return nil, fmt.Errorf("consul %v %v decode response error:%v", method, path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+type consulStatusError struct {
+	code int
+	msg  string
+}
+
+func (e *consulStatusError) Error() string {
+	return e.msg
+}
+
+// consulRegisterPlugin rpc服务注册到consul的插件，每个rpc服务注册为一个consul服务
+type consulRegisterPlugin struct {
+	registry       *ConsulRegistry
+	serviceAddress string
+	key            string
+	host           string
+	port           int
+	services       map[string]string // 已经注册的rpc服务名 -> metadata
+	lock           *sync.Mutex
+	stopChan       chan struct{}
+	stopOnce       *sync.Once
+}
+
+func (p *consulRegisterPlugin) Register(name string, rcvr interface{}, metadata string) error {
+	err := p.register(name, metadata)
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	p.services[name] = metadata
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *consulRegisterPlugin) RegisterFunction(serviceName, fname string, fn interface{}, metadata string) error {
+	return p.Register(serviceName, nil, metadata)
+}
+
+func (p *consulRegisterPlugin) Unregister(name string) error {
+	p.lock.Lock()
+	delete(p.services, name)
+	p.lock.Unlock()
+	_, err := p.registry.do(context.Background(), http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(p.serviceID(name)), nil, nil)
+	return err
+}
+
+// Stop 停止上报存活并注销所有服务
+func (p *consulRegisterPlugin) Stop() error {
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+
+	p.lock.Lock()
+	names := make([]string, 0, len(p.services))
+	for name := range p.services {
+		names = append(names, name)
+	}
+	p.lock.Unlock()
+
+	var err error
+	for _, name := range names {
+		if err1 := p.Unregister(name); err1 != nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+func (p *consulRegisterPlugin) serviceID(name string) string {
+	return name + "-" + p.serviceAddress
+}
+
+func (p *consulRegisterPlugin) register(name, metadata string) error {
+	registration := map[string]interface{}{
+		"ID":      p.serviceID(name),
+		"Name":    name,
+		"Address": p.host,
+		"Port":    p.port,
+		"Meta": map[string]string{
+			consulMetaKey:      p.key,
+			consulMetaMetadata: metadata,
+		},
+		"Check": map[string]interface{}{
+			"CheckID":                        "service:" + p.serviceID(name),
+			"TTL":                            DefaultConsulCheckTTL.String(),
+			"DeregisterCriticalServiceAfter": DefaultConsulDeregisterAfter.String(),
+			"Status":                         "passing",
+		},
+	}
+	_, err := p.registry.do(context.Background(), http.MethodPut, "/v1/agent/service/register", registration, nil)
+	return err
+}
+
+// heartbeat 定时上报TTL检查通过，consul agent重启丢失注册信息时重新注册
+func (p *consulRegisterPlugin) heartbeat() {
+	ticker := time.NewTicker(DefaultConsulCheckTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stopChan:
+			return
+		}
+
+		p.lock.Lock()
+		services := make(map[string]string, len(p.services))
+		for name, metadata := range p.services {
+			services[name] = metadata
+		}
+		p.lock.Unlock()
+
+		for name, metadata := range services {
+			_, err := p.registry.do(context.Background(), http.MethodPut,
+				"/v1/agent/check/pass/"+url.PathEscape("service:"+p.serviceID(name)), nil, nil)
+			if err == nil {
+				continue
+			}
+			if se, ok := err.(*consulStatusError); ok && se.code == http.StatusNotFound {
+				err = p.register(name, metadata)
+			}
+			if err != nil {
+				log.Warnf("consul service %v heartbeat error:%v", p.serviceID(name), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsulAgent 模拟consul agent的注册、注销、健康节点阻塞查询接口
+type fakeConsulAgent struct {
+	lock     sync.Mutex
+	index    uint64
+	changed  chan struct{}
+	services map[string]map[string]interface{}
+}
+
+func (a *fakeConsulAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lock.Lock()
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var reg map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&reg)
+		a.services[reg["ID"].(string)] = reg
+		a.change()
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		delete(a.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+		a.change()
+	case strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+		for index > 0 && index == a.index {
+			changed := a.changed
+			a.lock.Unlock()
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			a.lock.Lock()
+		}
+
+		var entries []map[string]interface{}
+		for _, reg := range a.services {
+			if reg["Name"] == strings.TrimPrefix(r.URL.Path, "/v1/health/service/") {
+				entries = append(entries, map[string]interface{}{"Service": map[string]interface{}{
+					"ID": reg["ID"], "Service": reg["Name"], "Address": reg["Address"], "Port": reg["Port"], "Meta": reg["Meta"],
+				}})
+			}
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(a.index, 10))
+		json.NewEncoder(w).Encode(entries)
+	}
+	a.lock.Unlock()
+}
+
+func (a *fakeConsulAgent) change() {
+	a.index++
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func TestConsulRegistry(t *testing.T) {
+	agent := &fakeConsulAgent{index: 1, changed: make(chan struct{}), services: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(agent)
+	defer server.Close()
+
+	r := NewConsulRegistry(server.URL, "")
+	d, err := r.Discovery("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if len(d.GetServices()) != 0 {
+		t.Fatalf("consul discovery services not empty:%+v", d.GetServices())
+	}
+	watchChan := d.WatchService()
+
+	p, err := r.ServerPlugin("node1@127.0.0.1:8001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin := p.(*consulRegisterPlugin)
+	err = plugin.Register("hello", nil, "version=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case pairs := <-watchChan:
+		if len(pairs) != 1 || pairs[0].Key != "node1@127.0.0.1:8001" || pairs[0].Value != "version=1" {
+			t.Fatalf("consul discovery services error:%+v", pairs)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("wait consul register timeout")
+	}
+
+	err = plugin.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case pairs := <-watchChan:
+		if len(pairs) != 0 {
+			t.Fatalf("consul discovery services not empty after stop:%+v", pairs)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("wait consul deregister timeout")
+	}
+}
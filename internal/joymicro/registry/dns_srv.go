@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/xlkness/lkit-go/internal/log"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	xclient "github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/server"
+)
+
+// DefaultDnsSrvRefreshInterval DNS-SRV服务发现重新解析的间隔
+var DefaultDnsSrvRefreshInterval = time.Second * 10
+
+// DnsSrvRegistry 只读的DNS-SRV服务发现，服务节点由k8s headless service、consul dns等平台注册，服务端不会注册
+type DnsSrvRegistry struct {
+	nameFormat string // SRV记录名格式，%s替换为服务名
+	lookupSRV  func(ctx context.Context, name string) ([]*net.SRV, error)
+}
+
+// NewDnsSrvRegistry 创建DNS-SRV服务发现
+// nameFormat:SRV记录名格式，%s替换为服务名，例如"_rpc._tcp.%s.default.svc.cluster.local"、"%s.service.consul"
+func NewDnsSrvRegistry(nameFormat string) *DnsSrvRegistry {
+	return &DnsSrvRegistry{
+		nameFormat: nameFormat,
+		lookupSRV: func(ctx context.Context, name string) ([]*net.SRV, error) {
+			_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+			return srvs, err
+		},
+	}
+}
+
+// ServerPlugin DNS-SRV不需要注册，返回空插件
+func (r *DnsSrvRegistry) ServerPlugin(serviceAddress string) (server.Plugin, error) {
+	return &staticRegisterPlugin{}, nil
+}
+
+func (r *DnsSrvRegistry) Discovery(service string) (xclient.ServiceDiscovery, error) {
+	name := fmt.Sprintf(r.nameFormat, service)
+	nodes, err := r.lookup(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &watchDiscovery{cancel: cancel}
+	d.MultipleServersDiscovery, _ = xclient.NewMultipleServersDiscovery(nodes2Pairs(nodes))
+	go r.refresh(ctx, name, nodes, d.MultipleServersDiscovery)
+	return d, nil
+}
+
+// refresh 定时重新解析SRV记录，节点变化时推送
+func (r *DnsSrvRegistry) refresh(ctx context.Context, name string, nodes map[string]string, d *xclient.MultipleServersDiscovery) {
+	ticker := time.NewTicker(DefaultDnsSrvRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		newNodes, err := r.lookup(ctx, name)
+		if err != nil {
+			log.Warnf("dns srv refresh %v error:%v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(nodes, newNodes) {
+			nodes = newNodes
+			d.Update(nodes2Pairs(nodes))
+		}
+	}
+}
+
+func (r *DnsSrvRegistry) lookup(ctx context.Context, name string) (map[string]string, error) {
+	srvs, err := r.lookupSRV(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup srv %v error:%v", name, err)
+	}
+	nodes := make(map[string]string, len(srvs))
+	for _, srv := range srvs {
+		addr := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+		nodes["tcp@"+addr] = ""
+	}
+	return nodes, nil
+}
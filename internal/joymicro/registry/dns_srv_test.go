@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver 替换DnsSrvRegistry的lookupSRV，返回测试设置的SRV记录或错误
+type fakeResolver struct {
+	lock    sync.Mutex
+	srvs    []*net.SRV
+	err     error
+	names   []string
+	lookups chan error // 每次解析返回的错误，满了丢弃
+}
+
+func (f *fakeResolver) set(srvs []*net.SRV, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.srvs, f.err = srvs, err
+}
+
+func (f *fakeResolver) lookupSRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	f.lock.Lock()
+	f.names = append(f.names, name)
+	srvs, err := f.srvs, f.err
+	f.lock.Unlock()
+	select {
+	case f.lookups <- err:
+	default:
+	}
+	return srvs, err
+}
+
+func TestDnsSrvRegistry(t *testing.T) {
+	old := DefaultDnsSrvRefreshInterval
+	DefaultDnsSrvRefreshInterval = time.Millisecond * 20
+	defer func() { DefaultDnsSrvRefreshInterval = old }()
+
+	resolver := &fakeResolver{lookups: make(chan error, 1)}
+	r := NewDnsSrvRegistry("_rpc._tcp.%s.default.svc.cluster.local")
+	r.lookupSRV = resolver.lookupSRV
+
+	// 首次解析失败返回错误
+	resolver.set(nil, errors.New("no such host"))
+	if _, err := r.Discovery("hello"); err == nil {
+		t.Fatal("discovery with lookup error should fail")
+	}
+
+	resolver.set([]*net.SRV{{Target: "hello-0.hello.", Port: 8001}, {Target: "hello-1.hello.", Port: 8001}}, nil)
+	d, err := r.Discovery("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	resolver.lock.Lock()
+	name := resolver.names[0]
+	resolver.lock.Unlock()
+	if name != "_rpc._tcp.hello.default.svc.cluster.local" {
+		t.Fatalf("lookup name error:%v", name)
+	}
+	pairs := d.GetServices()
+	if len(pairs) != 2 || pairs[0].Key != "tcp@hello-0.hello:8001" || pairs[1].Key != "tcp@hello-1.hello:8001" {
+		t.Fatalf("dns srv services error:%+v", pairs)
+	}
+
+	// 刷新失败保留原来的节点，之后节点变化推送新的节点列表
+	watchChan := d.WatchService()
+	select {
+	case <-resolver.lookups: // 丢弃首次解析失败的结果
+	default:
+	}
+	resolver.set(nil, errors.New("timeout"))
+	for err = nil; err == nil; {
+		select {
+		case err = <-resolver.lookups:
+		case <-time.After(time.Second):
+			t.Fatal("wait dns srv refresh timeout")
+		}
+	}
+	if pairs = d.GetServices(); len(pairs) != 2 {
+		t.Fatalf("dns srv services after refresh error:%+v", pairs)
+	}
+	resolver.set([]*net.SRV{{Target: "hello-1.hello.", Port: 8001}, {Target: "hello-2.hello.", Port: 8002}}, nil)
+
+	select {
+	case pairs = <-watchChan:
+	case <-time.After(time.Second):
+		t.Fatal("wait dns srv update timeout")
+	}
+	if len(pairs) != 2 || pairs[0].Key != "tcp@hello-1.hello:8001" || pairs[1].Key != "tcp@hello-2.hello:8002" {
+		t.Fatalf("dns srv refresh services error:%+v", pairs)
+	}
+	if pairs = d.GetServices(); len(pairs) != 2 || pairs[1].Key != "tcp@hello-2.hello:8002" {
+		t.Fatalf("dns srv services after refresh error:%+v", pairs)
+	}
+}
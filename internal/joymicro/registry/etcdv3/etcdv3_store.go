@@ -89,11 +89,18 @@ func (s *EtcdV3) Close() {
 }
 
 func (s *EtcdV3) Delete(key string) error {
-	return nil
+	return s.session.Delete(key)
 }
 
 func (s *EtcdV3) Exists(key string) (bool, error) {
-	return false, nil
+	_, err := s.session.Get(key)
+	if err == store.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Watch for changes on a key
@@ -214,6 +221,10 @@ func (session *etcdV3Session) Get(key string) (*store.KVPair, error) {
 		return nil, store.ErrCallNotSupported
 	}
 
+	if session.etcdClient.client == nil {
+		return nil, store.ErrKeyNotFound
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), session.etcdClient.invokeTimeout)
 	resp, err := session.etcdClient.client.Get(ctx, key)
 	cancel()
@@ -281,6 +292,24 @@ func (session *etcdV3Session) Put(key string, value []byte, ttl int) error {
 	return err
 }
 
+func (session *etcdV3Session) Delete(key string) error {
+	if atomic.LoadInt32(&session.isSessionAlive) != 1 {
+		return store.ErrCallNotSupported
+	}
+
+	if session.etcdClient.client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), session.etcdClient.invokeTimeout)
+	_, err := session.etcdClient.client.Delete(ctx, key)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("delete key(%v) error:%v", key, err)
+	}
+	return nil
+}
+
 func (session *etcdV3Session) Close() {
 	if atomic.LoadInt32(&session.isSessionAlive) != 1 {
 		return
@@ -3,6 +3,7 @@ package registry
 import (
 	"fmt"
 	"github.com/xlkness/lkit-go/internal/joymicro/registry/etcdv3"
+	"github.com/xlkness/lkit-go/internal/joymicro/util"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
@@ -11,35 +12,47 @@ import (
 	"github.com/smallnest/rpcx/server"
 )
 
-// todo etcd插件不支持注册函数服务
-func GetEtcdRegistryServerPlugin(key string, serviceAddr string, etcdAddress []string, hbInterval time.Duration) (server.Plugin, error) {
-	if key == "" {
-		key = "tcp"
-	}
+// DefaultEtcdHeartBeatInterval etcd注册中心刷新服务节点ttl的间隔，最小3秒
+var DefaultEtcdHeartBeatInterval = time.Second * 3
+
+// EtcdRegistry etcd注册中心
+type EtcdRegistry struct {
+	etcdAddrs []string
+}
+
+// NewEtcdRegistry 创建etcd注册中心
+// etcdServerAddrs:etcd服务的多个节点地址
+func NewEtcdRegistry(etcdServerAddrs []string) *EtcdRegistry {
+	return &EtcdRegistry{etcdAddrs: util.PreHandleEtcdHttpAddrs(etcdServerAddrs)}
+}
 
+// ServerPlugin todo etcd插件不支持注册函数服务
+func (r *EtcdRegistry) ServerPlugin(serviceAddress string) (server.Plugin, error) {
+	hbInterval := DefaultEtcdHeartBeatInterval
 	if hbInterval < time.Second*3 {
 		hbInterval = time.Second * 3
 	}
 
-	baseDir := getBaseDir()
-
-	r := &etcdv3.EtcdV3RegisterPlugin{
-		ServiceAddress: key + "@" + serviceAddr,
-		EtcdServers:    etcdAddress,
-		BasePath:       baseDir,
+	p := &etcdv3.EtcdV3RegisterPlugin{
+		ServiceAddress: serviceAddress,
+		EtcdServers:    r.etcdAddrs,
+		BasePath:       getBaseDir(),
 		Metrics:        metrics.NewRegistry(),
 		UpdateInterval: hbInterval,
 	}
-	err := r.Start()
-	return r, err
+	err := p.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start etcd register plugin error:%v", err)
+	}
+	return p, nil
 }
 
-func GetEtcdRegistryClientPlugin(service string, etcdServerAddrs []string) xclient.ServiceDiscovery {
-	d, err := client.NewEtcdV3Discovery(getBaseDir(), service, etcdServerAddrs, true, nil)
+func (r *EtcdRegistry) Discovery(service string) (xclient.ServiceDiscovery, error) {
+	d, err := client.NewEtcdV3Discovery(getBaseDir(), service, r.etcdAddrs, true, nil)
 	if err != nil {
-		panic(fmt.Errorf("NewEtcdV3Discovery error:%v", err))
+		return nil, fmt.Errorf("new etcd discovery error:%v", err)
 	}
-	return d
+	return d, nil
 }
 
 func getBaseDir() string {
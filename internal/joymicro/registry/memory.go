@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"sync"
+
+	xclient "github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/server"
+)
+
+// MemoryRegistry 进程内的内存注册中心，服务注册、发现不依赖外部组件，用于测试、所有服务打包在一个进程的部署
+type MemoryRegistry struct {
+	lock        *sync.Mutex
+	services    map[string]map[string]string // 服务名 -> "key@地址" -> metadata
+	discoveries *discoveries
+}
+
+// NewMemoryRegistry 创建内存注册中心
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		lock:        new(sync.Mutex),
+		services:    make(map[string]map[string]string),
+		discoveries: newDiscoveries(),
+	}
+}
+
+func (r *MemoryRegistry) ServerPlugin(serviceAddress string) (server.Plugin, error) {
+	return &memoryRegisterPlugin{registry: r, serviceAddress: serviceAddress}, nil
+}
+
+func (r *MemoryRegistry) Discovery(service string) (xclient.ServiceDiscovery, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.discoveries.add(service, r.services[service]), nil
+}
+
+// Services 服务当前注册的所有节点，key为"key@地址"，value为metadata
+func (r *MemoryRegistry) Services(service string) map[string]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	nodes := make(map[string]string, len(r.services[service]))
+	for k, v := range r.services[service] {
+		nodes[k] = v
+	}
+	return nodes
+}
+
+func (r *MemoryRegistry) register(service, serviceAddress, metadata string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.services[service] == nil {
+		r.services[service] = make(map[string]string)
+	}
+	r.services[service][serviceAddress] = metadata
+	r.discoveries.notify(service, r.services[service])
+}
+
+func (r *MemoryRegistry) unregister(service, serviceAddress string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.services[service], serviceAddress)
+	r.discoveries.notify(service, r.services[service])
+}
+
+// memoryRegisterPlugin rpc服务注册到内存注册中心的插件
+type memoryRegisterPlugin struct {
+	registry       *MemoryRegistry
+	serviceAddress string
+}
+
+func (p *memoryRegisterPlugin) Register(name string, rcvr interface{}, metadata string) error {
+	p.registry.register(name, p.serviceAddress, metadata)
+	return nil
+}
+
+func (p *memoryRegisterPlugin) RegisterFunction(serviceName, fname string, fn interface{}, metadata string) error {
+	p.registry.register(serviceName, p.serviceAddress, metadata)
+	return nil
+}
+
+func (p *memoryRegisterPlugin) Unregister(name string) error {
+	p.registry.unregister(name, p.serviceAddress)
+	return nil
+}
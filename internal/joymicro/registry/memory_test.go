@@ -0,0 +1,36 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestMemoryRegistryDiscoveryClose(t *testing.T) {
+	r := NewMemoryRegistry()
+	d1, _ := r.Discovery("hello")
+	d2, _ := r.Discovery("hello")
+	if n := len(r.discoveries.items["hello"]); n != 2 {
+		t.Fatalf("discoveries of hello:%v", n)
+	}
+
+	// Clone返回的仍然是同一个服务发现，Close时能移除
+	clone, _ := d1.Clone("hello")
+	clone.Close()
+	d1.Close()
+	if n := len(r.discoveries.items["hello"]); n != 1 || r.discoveries.items["hello"][0] != d2 {
+		t.Fatalf("discoveries of hello after close:%+v", r.discoveries.items["hello"])
+	}
+
+	// 关闭的服务发现不再收到节点变化
+	r.register("hello", "tcp@127.0.0.1:8001", "")
+	if pairs := d1.GetServices(); len(pairs) != 0 {
+		t.Fatalf("closed discovery updated:%+v", pairs)
+	}
+	if pairs := d2.GetServices(); len(pairs) != 1 || pairs[0].Key != "tcp@127.0.0.1:8001" {
+		t.Fatalf("discovery not updated:%+v", pairs)
+	}
+
+	d2.Close()
+	if _, find := r.discoveries.items["hello"]; find {
+		t.Fatalf("discoveries of hello not removed:%+v", r.discoveries.items)
+	}
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// 服务节点注册的metadata key，通过joyservice.RegisterOneService的metaKVs传入，客户端选择器读取
+const (
+	MetaWeight  = "weight"  // 节点权重，默认DefaultNodeWeight，为0时不分配流量
+	MetaZone    = "zone"    // 节点所在机房/可用区
+	MetaVersion = "version" // 节点的服务版本
+)
+
+// DefaultNodeWeight 没有注册weight的节点默认权重
+const DefaultNodeWeight = 100
+
+// NodeMeta 解析后的服务节点metadata
+type NodeMeta struct {
+	Weight  int
+	Zone    string
+	Version string
+	Values  url.Values
+}
+
+// ParseNodeMeta 解析注册中心里节点的metadata，格式为url query编码
+func ParseNodeMeta(metadata string) NodeMeta {
+	values, _ := url.ParseQuery(metadata)
+	meta := NodeMeta{
+		Weight:  DefaultNodeWeight,
+		Zone:    values.Get(MetaZone),
+		Version: values.Get(MetaVersion),
+		Values:  values,
+	}
+	if w := values.Get(MetaWeight); w != "" {
+		if weight, err := strconv.Atoi(w); err == nil && weight >= 0 {
+			meta.Weight = weight
+		}
+	}
+	return meta
+}
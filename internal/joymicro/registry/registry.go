@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	xclient "github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/server"
+)
+
+// Registry 服务注册中心，joyservice用ServerPlugin注册服务节点，joyclient用Discovery按服务名发现节点，
+// 节点key格式为"key@ip:port"，普通服务key为"tcp"，点对点服务key为节点的主键
+type Registry interface {
+	// ServerPlugin 创建rpc服务端的注册插件，服务注册、注销时写入、删除注册中心里的节点
+	ServerPlugin(serviceAddress string) (server.Plugin, error)
+	// Discovery 创建rpc客户端对某个服务的发现，节点变化时推送给客户端
+	Discovery(service string) (xclient.ServiceDiscovery, error)
+}
+
+// discoveries 客户端的服务发现，注册中心节点变化时推送，服务发现Close时移除
+type discoveries struct {
+	lock  *sync.Mutex
+	items map[string][]*listDiscovery
+}
+
+func newDiscoveries() *discoveries {
+	return &discoveries{
+		lock:  new(sync.Mutex),
+		items: make(map[string][]*listDiscovery),
+	}
+}
+
+func (ds *discoveries) add(service string, nodes map[string]string) xclient.ServiceDiscovery {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	md, _ := xclient.NewMultipleServersDiscovery(nodes2Pairs(nodes))
+	d := &listDiscovery{MultipleServersDiscovery: md, ds: ds, service: service}
+	ds.items[service] = append(ds.items[service], d)
+	return d
+}
+
+func (ds *discoveries) remove(service string, d *listDiscovery) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	items := ds.items[service]
+	for i, item := range items {
+		if item == d {
+			items = append(items[:i:i], items[i+1:]...)
+			break
+		}
+	}
+	if len(items) == 0 {
+		delete(ds.items, service)
+		return
+	}
+	ds.items[service] = items
+}
+
+func (ds *discoveries) notify(service string, nodes map[string]string) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	pairs := nodes2Pairs(nodes)
+	for _, d := range ds.items[service] {
+		d.Update(pairs)
+	}
+}
+
+// listDiscovery discoveries推送节点变化的服务发现，Close时从discoveries移除，不再推送
+type listDiscovery struct {
+	*xclient.MultipleServersDiscovery
+	ds      *discoveries
+	service string
+}
+
+func (d *listDiscovery) Clone(servicePath string) (xclient.ServiceDiscovery, error) {
+	return d, nil
+}
+
+func (d *listDiscovery) Close() {
+	d.ds.remove(d.service, d)
+}
+
+func nodes2Pairs(nodes map[string]string) []*xclient.KVPair {
+	pairs := make([]*xclient.KVPair, 0, len(nodes))
+	for k, v := range nodes {
+		pairs = append(pairs, &xclient.KVPair{Key: k, Value: v})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs
+}
+
+// watchDiscovery 后台协程监听节点变化的服务发现，Close时停止监听
+type watchDiscovery struct {
+	*xclient.MultipleServersDiscovery
+	cancel context.CancelFunc
+}
+
+func (d *watchDiscovery) Clone(servicePath string) (xclient.ServiceDiscovery, error) {
+	return d, nil
+}
+
+func (d *watchDiscovery) Close() {
+	d.cancel()
+}
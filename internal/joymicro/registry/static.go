@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	xclient "github.com/smallnest/rpcx/client"
+	"github.com/smallnest/rpcx/server"
+	"gopkg.in/yaml.v3"
+)
+
+// StaticRegistry 静态服务列表注册中心，服务节点由配置指定，服务端不会注册，用于本地开发
+type StaticRegistry struct {
+	lock        *sync.Mutex
+	path        string                       // 不为空从文件读取服务列表
+	services    map[string]map[string]string // 服务名 -> "key@地址" -> metadata
+	discoveries *discoveries
+}
+
+// NewStaticRegistry 用固定的服务列表创建注册中心
+// services:服务名 -> 节点地址列表，地址为"ip:port"格式，点对点服务的节点为"key@ip:port"格式
+func NewStaticRegistry(services map[string][]string) *StaticRegistry {
+	r := &StaticRegistry{
+		lock:        new(sync.Mutex),
+		services:    make(map[string]map[string]string),
+		discoveries: newDiscoveries(),
+	}
+	r.Update(services)
+	return r
+}
+
+// NewFileRegistry 从yaml或json文件读取服务列表创建注册中心，文件内容格式同NewStaticRegistry的services，
+// 文件修改后调用Reload重新读取，例如：
+//
+//	hello: ["127.0.0.1:8001", "127.0.0.1:8002"]
+func NewFileRegistry(path string) (*StaticRegistry, error) {
+	r := NewStaticRegistry(nil)
+	r.path = path
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新读取服务列表文件，节点变化推送给已经创建的客户端
+func (r *StaticRegistry) Reload() error {
+	if r.path == "" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("read static registry file %v error:%v", r.path, err)
+	}
+	services := make(map[string][]string)
+	err = yaml.Unmarshal(content, &services)
+	if err != nil {
+		return fmt.Errorf("parse static registry file %v error:%v", r.path, err)
+	}
+	r.Update(services)
+	return nil
+}
+
+// Update 整体替换服务列表，节点变化推送给已经创建的客户端
+func (r *StaticRegistry) Update(services map[string][]string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	newServices := make(map[string]map[string]string, len(services))
+	for service, addrs := range services {
+		nodes := make(map[string]string, len(addrs))
+		for _, addr := range addrs {
+			if !strings.Contains(addr, "@") {
+				addr = "tcp@" + addr
+			}
+			nodes[addr] = ""
+		}
+		newServices[service] = nodes
+	}
+
+	oldServices := r.services
+	r.services = newServices
+	for service := range oldServices {
+		if _, find := newServices[service]; !find {
+			r.discoveries.notify(service, nil)
+		}
+	}
+	for service, nodes := range newServices {
+		r.discoveries.notify(service, nodes)
+	}
+}
+
+// ServerPlugin 静态服务列表不需要注册，返回空插件
+func (r *StaticRegistry) ServerPlugin(serviceAddress string) (server.Plugin, error) {
+	return &staticRegisterPlugin{}, nil
+}
+
+func (r *StaticRegistry) Discovery(service string) (xclient.ServiceDiscovery, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.discoveries.add(service, r.services[service]), nil
+}
+
+type staticRegisterPlugin struct{}
@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "services.yaml")
+	err := os.WriteFile(path, []byte(`hello: ["127.0.0.1:8001", "node1@127.0.0.1:8002"]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewFileRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := r.Discovery("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := d.GetServices()
+	if len(pairs) != 2 || pairs[0].Key != "node1@127.0.0.1:8002" || pairs[1].Key != "tcp@127.0.0.1:8001" {
+		t.Fatalf("static registry services error:%+v", pairs)
+	}
+
+	watchChan := d.WatchService()
+	err = os.WriteFile(path, []byte(`{"hello": ["127.0.0.1:8003"]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case pairs = <-watchChan:
+	case <-time.After(time.Second):
+		t.Fatal("wait static registry update timeout")
+	}
+	if len(pairs) != 1 || pairs[0].Key != "tcp@127.0.0.1:8003" {
+		t.Fatalf("static registry reload services error:%+v", pairs)
+	}
+}
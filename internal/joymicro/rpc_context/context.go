@@ -0,0 +1,154 @@
+package rpc_context
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/smallnest/rpcx/share"
+)
+
+// 链式调用传递的rpcx metadata key，剩余超时时间由rpcx的__ServerTimeout传递，服务端恢复为ctx的deadline
+const (
+	MetaCaller        = "lkit_caller"     // 调用方服务名
+	MetaRequestID     = "lkit_request_id" // 请求id，链路第一次调用时生成，之后原样传递
+	MetaBaggagePrefix = "lkit_baggage_"   // 用户自定义的透传数据
+)
+
+var defaultCaller atomic.Value
+
+func init() {
+	defaultCaller.Store(filepath.Base(os.Args[0]))
+}
+
+// SetDefaultCaller 设置不在rpc调用处理中发起调用时的调用方名字，默认为进程名
+func SetDefaultCaller(name string) {
+	defaultCaller.Store(name)
+}
+
+type callInfoKey struct{}
+
+// callInfo 链式调用传递的信息，不可修改，With系列函数复制后修改
+type callInfo struct {
+	caller    string // 上游调用方
+	local     string // 本地服务名，发起调用时作为调用方
+	requestID string
+	baggage   map[string]string
+}
+
+func getCallInfo(ctx context.Context) *callInfo {
+	if info, ok := ctx.Value(callInfoKey{}).(*callInfo); ok {
+		return info
+	}
+	return &callInfo{}
+}
+
+func (info *callInfo) clone() *callInfo {
+	newInfo := *info
+	newInfo.baggage = make(map[string]string, len(info.baggage)+1)
+	for k, v := range info.baggage {
+		newInfo.baggage[k] = v
+	}
+	return &newInfo
+}
+
+// WithRequestID 设置请求id，之后的链式调用都传递这个id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	info := getCallInfo(ctx).clone()
+	info.requestID = requestID
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// RequestID 当前调用链的请求id，没有时为空
+func RequestID(ctx context.Context) string {
+	return getCallInfo(ctx).requestID
+}
+
+// WithLocalService 设置发起调用时的调用方名字，rpc服务处理调用时自动设置为当前服务名
+func WithLocalService(ctx context.Context, service string) context.Context {
+	info := getCallInfo(ctx).clone()
+	info.local = service
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// Caller rpc服务处理调用时，上游调用方的服务名
+func Caller(ctx context.Context) string {
+	return getCallInfo(ctx).caller
+}
+
+// WithBaggage 设置透传数据，之后的链式调用都会携带
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	info := getCallInfo(ctx).clone()
+	info.baggage[key] = value
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// Baggage 获取透传数据
+func Baggage(ctx context.Context, key string) string {
+	return getCallInfo(ctx).baggage[key]
+}
+
+// AllBaggage 所有透传数据的副本
+func AllBaggage(ctx context.Context) map[string]string {
+	return getCallInfo(ctx).clone().baggage
+}
+
+// Outgoing 发起调用前把调用方、请求id、透传数据写入新的rpcx请求metadata，没有请求id时生成，
+// ctx里已有的请求metadata(例如服务端收到的)复制后传递，不修改原来的map
+func Outgoing(ctx context.Context) context.Context {
+	info := getCallInfo(ctx)
+	meta := make(map[string]string)
+	if old, ok := ctx.Value(share.ReqMetaDataKey).(map[string]string); ok {
+		for k, v := range old {
+			if strings.HasPrefix(k, "__") || k == MetaCaller || k == MetaRequestID || strings.HasPrefix(k, MetaBaggagePrefix) {
+				continue
+			}
+			meta[k] = v
+		}
+	}
+
+	caller := info.local
+	if caller == "" {
+		caller, _ = defaultCaller.Load().(string)
+	}
+	meta[MetaCaller] = caller
+
+	requestID := info.requestID
+	if requestID == "" {
+		requestID = NewRequestID()
+		ctx = WithRequestID(ctx, requestID)
+	}
+	meta[MetaRequestID] = requestID
+
+	for k, v := range info.baggage {
+		meta[MetaBaggagePrefix+k] = v
+	}
+	return context.WithValue(ctx, share.ReqMetaDataKey, meta)
+}
+
+// Incoming 服务端收到调用时从rpcx请求metadata恢复调用方、请求id、透传数据，service为当前服务名
+func Incoming(ctx *share.Context, service string, meta map[string]string) {
+	info := &callInfo{
+		caller:    meta[MetaCaller],
+		local:     service,
+		requestID: meta[MetaRequestID],
+		baggage:   make(map[string]string),
+	}
+	for k, v := range meta {
+		if strings.HasPrefix(k, MetaBaggagePrefix) {
+			info.baggage[strings.TrimPrefix(k, MetaBaggagePrefix)] = v
+		}
+	}
+	ctx.SetValue(callInfoKey{}, info)
+}
+
+// NewRequestID 生成随机的请求id
+func NewRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,11 @@
+package util
+
+import "strings"
+
+// OverloadedError 服务端限流拒绝调用返回的错误前缀，客户端据此识别过载错误，不重试
+const OverloadedError = "rpc server overloaded"
+
+// IsOverloadedError 是否为服务端限流拒绝调用的错误
+func IsOverloadedError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), OverloadedError)
+}
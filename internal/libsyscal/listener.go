@@ -0,0 +1,150 @@
+package libsyscal
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EnvInheritListeners 热升级时新进程继承的监听地址，逗号分隔，按顺序对应从3开始的fd
+const EnvInheritListeners = "lkit_inherit_listeners"
+
+var (
+	listenersLock      = new(sync.Mutex)
+	inheritedListeners map[string]net.Listener                 // 从父进程继承还没被使用的监听
+	activeListeners    = make(map[string]*inheritableListener) // key为network:实际监听地址，多个":0"监听不会互相覆盖
+)
+
+// Listen 监听tcp地址，优先使用热升级时从旧进程继承的同地址监听，所有通过Listen创建的监听在热升级时都会传递给新进程，
+// 端口为0的地址每次监听的端口不同，不会使用继承的监听
+func Listen(network, addr string) (net.Listener, error) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+
+	if inheritedListeners == nil {
+		err := loadInheritedListeners()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ln := takeInheritedListener(network, addr)
+	if ln == nil {
+		var err error
+		ln, err = net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key := network + ":" + ln.Addr().String()
+	il := &inheritableListener{Listener: ln, key: key}
+	activeListeners[key] = il
+	return il, nil
+}
+
+// takeInheritedListener 取出和addr相同地址的继承监听，没有时返回nil
+func takeInheritedListener(network, addr string) net.Listener {
+	key := network + ":" + addr
+	if ln, find := inheritedListeners[key]; find {
+		delete(inheritedListeners, key)
+		return ln
+	}
+
+	// 配置的地址可能省略ip或者用主机名，按解析后的ip、端口比较
+	want, err := net.ResolveTCPAddr(network, addr)
+	if err != nil || want.Port == 0 {
+		return nil
+	}
+	for key, ln := range inheritedListeners {
+		if !strings.HasPrefix(key, network+":") {
+			continue
+		}
+		got, ok := ln.Addr().(*net.TCPAddr)
+		if !ok || got.Port != want.Port {
+			continue
+		}
+		if (want.IP == nil || want.IP.IsUnspecified()) && got.IP.IsUnspecified() || want.IP.Equal(got.IP) {
+			delete(inheritedListeners, key)
+			return ln
+		}
+	}
+	return nil
+}
+
+// ListenerFiles 当前所有还在监听的地址和复制出来的fd，用于热升级时传递给新进程，调用方负责关闭文件
+func ListenerFiles() ([]string, []*os.File, error) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+
+	var keys []string
+	var files []*os.File
+	for key, il := range activeListeners {
+		f, ok := il.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		file, err := f.File()
+		if err != nil {
+			for _, v := range files {
+				v.Close()
+			}
+			return nil, nil, fmt.Errorf("get listener %v file error:%v", key, err)
+		}
+		keys = append(keys, key)
+		files = append(files, file)
+	}
+	return keys, files, nil
+}
+
+// CloseInheritedListeners 关闭从旧进程继承但新进程没有使用的监听，新进程就绪后调用
+func CloseInheritedListeners() {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+
+	for key, ln := range inheritedListeners {
+		ln.Close()
+		delete(inheritedListeners, key)
+	}
+}
+
+// IsInheritedProcess 当前进程是否为热升级启动的新进程
+func IsInheritedProcess() bool {
+	return os.Getenv(EnvInheritListeners) != ""
+}
+
+func loadInheritedListeners() error {
+	inheritedListeners = make(map[string]net.Listener)
+	value := os.Getenv(EnvInheritListeners)
+	if value == "" {
+		return nil
+	}
+
+	for i, key := range strings.Split(value, ",") {
+		file := os.NewFile(uintptr(3+i), key)
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("inherit listener %v from fd %v error:%v", key, 3+i, err)
+		}
+		inheritedListeners[key] = ln
+	}
+	return nil
+}
+
+// inheritableListener 关闭时从活跃监听里移除，热升级不再传递
+type inheritableListener struct {
+	net.Listener
+	key string
+}
+
+func (il *inheritableListener) Close() error {
+	listenersLock.Lock()
+	if activeListeners[il.key] == il {
+		delete(activeListeners, il.key)
+	}
+	listenersLock.Unlock()
+	return il.Listener.Close()
+}
@@ -0,0 +1,165 @@
+package libsyscal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envTestListenAddrs 子进程测试使用和关闭的继承监听地址
+const envTestListenAddrs = "lkit_test_listen_addrs"
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestListenerFilesInherit(t *testing.T) {
+	usedAddr, unusedAddr := freeAddr(t), freeAddr(t)
+	used, err := Listen("tcp", usedAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unused, err := Listen("tcp", unusedAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, files, err := ListenerFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || len(files) != 2 {
+		t.Fatalf("listener files keys:%v", keys)
+	}
+
+	// 关闭后不再传递给新进程，复制出来的fd仍然在监听
+	used.Close()
+	unused.Close()
+	if keys, _, _ := ListenerFiles(); len(keys) != 0 {
+		t.Fatalf("closed listeners still active:%v", keys)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInheritListenersChild$")
+	cmd.Env = append(os.Environ(),
+		EnvInheritListeners+"="+strings.Join(keys, ","),
+		envTestListenAddrs+"="+usedAddr+","+unusedAddr)
+	cmd.ExtraFiles = files
+	output := bytes.NewBuffer(nil)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		f.Close()
+	}
+	defer cmd.Process.Kill()
+
+	conn, err := net.DialTimeout("tcp", usedAddr, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second * 10))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "inherited\n" {
+		t.Fatalf("read from inherited listener:%q, error:%v", line, err)
+	}
+
+	if err = cmd.Wait(); err != nil {
+		t.Fatalf("child process error:%v, output:%v", err, output.String())
+	}
+}
+
+func TestListenRandomPorts(t *testing.T) {
+	// 端口为0的监听按实际地址区分，都会传递给新进程
+	ln1, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln1.Close()
+	ln2, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln2.Close()
+
+	keys, files, err := ListenerFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		f.Close()
+	}
+	if len(keys) != 2 || keys[0] == keys[1] {
+		t.Fatalf("listener files keys:%v", keys)
+	}
+}
+
+func TestListenInheritedByPort(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenersLock.Lock()
+	inheritedListeners = map[string]net.Listener{"tcp:" + ln.Addr().String(): ln}
+	listenersLock.Unlock()
+	defer CloseInheritedListeners()
+
+	// 配置的地址省略ip时按端口匹配继承的监听
+	port := ln.Addr().(*net.TCPAddr).Port
+	inherited, err := Listen("tcp", fmt.Sprintf(":%v", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != ln.Addr().String() || len(inheritedListeners) != 0 {
+		t.Fatalf("listen %v not use inherited listener %v", inherited.Addr(), ln.Addr())
+	}
+}
+
+// TestInheritListenersChild TestListenerFilesInherit启动的子进程，直接运行时跳过
+func TestInheritListenersChild(t *testing.T) {
+	addrs := strings.Split(os.Getenv(envTestListenAddrs), ",")
+	if len(addrs) != 2 {
+		t.Skip("run by TestListenerFilesInherit")
+	}
+	if !IsInheritedProcess() {
+		t.Fatalf("inherited process not detected")
+	}
+
+	ln, err := Listen("tcp", addrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if _, find := inheritedListeners["tcp:"+addrs[0]]; find || len(inheritedListeners) != 1 {
+		t.Fatalf("inherited listeners after listen:%v", inheritedListeners)
+	}
+
+	// 没有使用的继承监听关闭后，地址可以重新监听
+	CloseInheritedListeners()
+	ln2, err := Listen("tcp", addrs[1])
+	if err != nil {
+		t.Fatalf("listen unused inherited addr after close error:%v", err)
+	}
+	ln2.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("inherited\n"))
+	conn.Close()
+}
@@ -0,0 +1,14 @@
+package libsyscal
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetChildProcessDeathSignal 父进程退出时子进程收到SIGTERM，避免父进程被kill -9后子进程变成孤儿进程
+func SetChildProcessDeathSignal(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGTERM
+}
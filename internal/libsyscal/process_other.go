@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package libsyscal
+
+import (
+	"os/exec"
+)
+
+// SetChildProcessDeathSignal 非linux平台不支持父进程退出时通知子进程，不做处理
+func SetChildProcessDeathSignal(cmd *exec.Cmd) {
+}
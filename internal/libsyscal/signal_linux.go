@@ -9,7 +9,15 @@ import (
 	"syscall"
 )
 
+// UpgradeSignal 热升级信号
+var UpgradeSignal os.Signal = syscall.SIGUSR2
+
 func WatchSignal(notify func(signal2 os.Signal)) {
+	WatchSignalWithReload(notify, nil)
+}
+
+// WatchSignalWithReload 监听退出信号和SIGHUP，收到退出信号调用notify后返回，收到SIGHUP调用reload
+func WatchSignalWithReload(notify func(signal2 os.Signal), reload func()) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
 	for {
@@ -19,15 +27,32 @@ func WatchSignal(notify func(signal2 os.Signal)) {
 			notify(s)
 			return
 		case syscall.SIGHUP:
-			// TODO reload
+			if reload != nil {
+				reload()
+			}
 		default:
 			return
 		}
 	}
 }
 
+// WatchSignal1 监听退出信号
 func WatchSignal1() chan os.Signal {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
+	signal.Notify(c, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL)
+	return c
+}
+
+// WatchReloadSignal 监听SIGHUP重载信号
+func WatchReloadSignal() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	return c
+}
+
+// WatchUpgradeSignal 监听SIGUSR2热升级信号
+func WatchUpgradeSignal() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
 	return c
 }
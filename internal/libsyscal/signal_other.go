@@ -0,0 +1,65 @@
+//go:build !linux
+// +build !linux
+
+package libsyscal
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// UpgradeSignal 热升级信号，非linux平台不支持，系统不会发送
+var UpgradeSignal os.Signal = unsupportedSignal("upgrade")
+
+// unsupportedSignal 当前平台没有的信号
+type unsupportedSignal string
+
+func (s unsupportedSignal) String() string {
+	return string(s)
+}
+
+func (s unsupportedSignal) Signal() {}
+
+func WatchSignal(notify func(signal2 os.Signal)) {
+	WatchSignalWithReload(notify, nil)
+}
+
+// WatchSignalWithReload 监听退出信号和SIGHUP，收到退出信号调用notify后返回，收到SIGHUP调用reload
+func WatchSignalWithReload(notify func(signal2 os.Signal), reload func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+	for {
+		s := <-c
+		switch s {
+		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
+			notify(s)
+			return
+		case syscall.SIGHUP:
+			if reload != nil {
+				reload()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// WatchSignal1 监听退出信号
+func WatchSignal1() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+	return c
+}
+
+// WatchReloadSignal 监听SIGHUP重载信号
+func WatchReloadSignal() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	return c
+}
+
+// WatchUpgradeSignal 非linux平台不支持热升级信号，返回的chan不会收到信号
+func WatchUpgradeSignal() chan os.Signal {
+	return make(chan os.Signal, 1)
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"fmt"
 	"runtime"
 	"time"
 )
@@ -26,6 +27,15 @@ func CatchWithInfoFun(info string, f func()) {
 	}
 }
 
+// CatchWithInfoError 捕获panic并打印堆栈，panic转换为error写入err，用于需要把panic当作报错处理的场景
+func CatchWithInfoError(info string, err *error) {
+	if v := recover(); v != nil {
+		Critif("panic info: [%v]", info)
+		backtrace(v)
+		*err = fmt.Errorf("panic:%v", v)
+	}
+}
+
 func backtrace(message interface{}) {
 	//fmt.Fprintf(os.Stderr, "Traceback[%s] (most recent call last):\n", time.Now())
 	Critif("Traceback[%s] (most recent call last):\n", time.Now())
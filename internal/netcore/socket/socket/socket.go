@@ -51,6 +51,8 @@ func GetID() int64 {
 type InternalServer interface {
 	Listen() error
 	Stop()
+	// Addr 监听地址，监听成功前为空
+	Addr() net.Addr
 	GetSession(int64) (InternalSession, bool)
 	CloseSession(int64, *utils.TLVPacket, time.Duration, interface{}) bool
 }
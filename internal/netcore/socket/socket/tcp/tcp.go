@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"bufio"
+	"github.com/xlkness/lkit-go/internal/libsyscal"
 	"github.com/xlkness/lkit-go/internal/netcore/socket/event"
 	internalSocket "github.com/xlkness/lkit-go/internal/netcore/socket/socket"
 	"github.com/xlkness/lkit-go/internal/netcore/socket/utils"
@@ -16,6 +17,9 @@ type server struct {
 	newSessionFunc func(conn internalSocket.InternalClientConn) internalSocket.InternalSession
 	sessionMgr     *sync.Map
 	option         *internalSocket.InternalOption
+	listener       net.Listener
+	isStopped      bool
+	lock           *sync.Mutex
 }
 
 func NewServer(addr string, newSessionFunc func(conn internalSocket.InternalClientConn) internalSocket.InternalSession,
@@ -25,18 +29,32 @@ func NewServer(addr string, newSessionFunc func(conn internalSocket.InternalClie
 	listener.newSessionFunc = newSessionFunc
 	listener.sessionMgr = new(sync.Map)
 	listener.option = option
+	listener.lock = new(sync.Mutex)
 	return listener
 }
 
 func (s *server) Listen() error {
-	listenFd, err := net.Listen("tcp", s.addr)
+	listenFd, err := libsyscal.Listen("tcp", s.addr)
 	if err != nil {
 		return err
 	}
 
+	s.lock.Lock()
+	if s.isStopped {
+		s.lock.Unlock()
+		listenFd.Close()
+		return nil
+	}
+	s.listener = listenFd
+	s.lock.Unlock()
+
 	for {
 		conn, err := listenFd.Accept()
 		if err != nil {
+			// 主动停止不算报错
+			if s.stopped() {
+				return nil
+			}
 			return err
 		}
 		client := s.newClientConn(conn, s.option)
@@ -46,8 +64,6 @@ func (s *server) Listen() error {
 		go client.handleClientConnDeliverRecvMsg(customSession)
 		go client.handleClientConnWriteMsg(customSession)
 	}
-
-	return nil
 }
 
 func (s *server) GetSession(id int64) (internalSocket.InternalSession, bool) {
@@ -96,8 +112,30 @@ func (s *server) closeSession(id int64, err event.Error) {
 	session.GetClientConn().(*clientConn).close()
 }
 
+// Stop 关闭监听，不再接收新链接，已有链接不受影响
 func (s *server) Stop() {
-	s.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.isStopped = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+// Addr 监听地址，监听成功前为空
+func (s *server) Addr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *server) stopped() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.isStopped
 }
 
 func (s *server) newClientConn(conn net.Conn, option *internalSocket.InternalOption) *clientConn {
@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"github.com/xlkness/lkit-go/internal/libsyscal"
 	"github.com/xlkness/lkit-go/internal/netcore/socket/event"
 	internalSocket "github.com/xlkness/lkit-go/internal/netcore/socket/socket"
 	"github.com/xlkness/lkit-go/internal/netcore/socket/utils"
@@ -23,6 +24,9 @@ type Server struct {
 	option         *internalSocket.InternalOption
 	loggerFun      func(params gin.LogFormatterParams)
 	panicOutputFun func(string)
+	httpServer     *http.Server
+	listener       net.Listener
+	lock           *sync.Mutex
 }
 
 func NewServer(addr string, newSessionFunc func(internalSocket.InternalClientConn) internalSocket.InternalSession, option *internalSocket.InternalOption, fs http.FileSystem) *Server {
@@ -33,6 +37,8 @@ func NewServer(addr string, newSessionFunc func(internalSocket.InternalClientCon
 	listener.option = option
 	listener.fs = fs
 	listener.GinEngine = gin.New()
+	listener.httpServer = &http.Server{Addr: addr, Handler: listener.GinEngine}
+	listener.lock = new(sync.Mutex)
 	return listener
 }
 
@@ -70,7 +76,19 @@ func (s *Server) Listen() error {
 		client.handleClientConnRead(s, customSession)
 	}))
 
-	return s.GinEngine.Run(s.addr)
+	ln, err := libsyscal.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.listener = ln
+	s.lock.Unlock()
+	err = s.httpServer.Serve(ln)
+	// 主动停止不算报错
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
 }
 
 func (s *Server) GetSession(id int64) (internalSocket.InternalSession, bool) {
@@ -119,6 +137,17 @@ func (s *Server) closeSession(id int64, err event.Error) {
 	session.GetClientConn().(*clientConn).close()
 }
 
+// Stop 关闭监听，不再接收新链接
 func (s *Server) Stop() {
-	s.Close()
+	s.httpServer.Close()
+}
+
+// Addr 监听地址，监听成功前为空
+func (s *Server) Addr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
 }
@@ -1,7 +1,11 @@
 package holmes
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sync"
 	"time"
 
 	"mosn.io/holmes"
@@ -9,11 +13,16 @@ import (
 
 var GlobalOptions = make([]holmes.Option, 0)
 
-func StartTraceAndDump(path string, option ...holmes.Option) {
+// dumpPath holmes的dump目录，手动dump也输出到这里
+var dumpPath = "holmes"
+
+// StartTraceAndDump 启动holmes按规则自动dump，返回停止函数，停止函数可以重复调用
+func StartTraceAndDump(path string, option ...holmes.Option) (stop func()) {
 	if path == "" {
 		path = "holmes"
 	}
-	os.MkdirAll(path, 0666)
+	dumpPath = path
+	os.MkdirAll(path, 0755)
 	// 配置规则
 	h, _ := holmes.New(
 		// holmes.WithProfileReporter()
@@ -35,4 +44,34 @@ func StartTraceAndDump(path string, option ...holmes.Option) {
 		// EnableGoroutineDump().
 		EnableMemDump().
 		EnableGCHeapDump().Start()
+
+	once := new(sync.Once)
+	return func() {
+		once.Do(h.Stop)
+	}
+}
+
+// Dump 手动dump一次goroutine、heap的profile到holmes的dump目录，返回生成的文件路径
+func Dump() ([]string, error) {
+	err := os.MkdirAll(dumpPath, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	now := time.Now().Format("20060102150405.000")
+	for _, name := range []string{"goroutine", "heap"} {
+		fileName := filepath.Join(dumpPath, fmt.Sprintf("%s.manual.%s.log", name, now))
+		f, err := os.Create(fileName)
+		if err != nil {
+			return files, fmt.Errorf("create dump file %v error:%v", fileName, err)
+		}
+		err = pprof.Lookup(name).WriteTo(f, 1)
+		f.Close()
+		if err != nil {
+			return files, fmt.Errorf("dump %v profile error:%v", name, err)
+		}
+		files = append(files, fileName)
+	}
+	return files, nil
 }
@@ -3,12 +3,15 @@ package prom
 import (
 	"fmt"
 	"github.com/xlkness/lkit-go/internal/web/engine"
+	"net/http"
+	"sync"
 	"sync/atomic"
 
 	ginPprof "github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func NewCounter(name string) *PromeCounterStatMgr {
@@ -185,7 +188,7 @@ func NewEngine(addr string, enablePprof bool) *engine.Engine {
 		ginPprof.Register(engine.GetGinEngine())
 	}
 
-	ginF := gin.WrapH(promhttp.Handler())
+	ginF := gin.WrapH(metricsHandler())
 	engine.Get("/metrics", "metrics", func(c *Context) {
 		ginF(c.GetGinContext())
 	})
@@ -211,5 +214,41 @@ func RouteEngine(engine *gin.Engine, enablePprof bool) {
 	if enablePprof {
 		ginPprof.Register(engine)
 	}
-	engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	engine.GET("/metrics", gin.WrapH(metricsHandler()))
+}
+
+var (
+	extraGatherersLock = new(sync.Mutex)
+	extraGatherers     = make(map[string]prometheus.Gatherer)
+)
+
+// RegisterGatherer 注册/metrics接口额外输出的指标来源，例如监督模式下父进程聚合子进程的指标，同名覆盖
+func RegisterGatherer(name string, g prometheus.Gatherer) {
+	extraGatherersLock.Lock()
+	defer extraGatherersLock.Unlock()
+	extraGatherers[name] = g
+}
+
+// UnregisterGatherer 移除额外的指标来源
+func UnregisterGatherer(name string) {
+	extraGatherersLock.Lock()
+	defer extraGatherersLock.Unlock()
+	delete(extraGatherers, name)
+}
+
+type multiGatherer struct{}
+
+func (multiGatherer) Gather() ([]*dto.MetricFamily, error) {
+	extraGatherersLock.Lock()
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer}
+	for _, g := range extraGatherers {
+		gatherers = append(gatherers, g)
+	}
+	extraGatherersLock.Unlock()
+	return gatherers.Gather()
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(multiGatherer{}, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}))
 }
@@ -1,7 +1,13 @@
 package engine
 
 import (
+	"context"
+	"github.com/xlkness/lkit-go/internal/libsyscal"
+	"net"
+	"net/http"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -114,6 +120,10 @@ type Engine struct {
 	GroupRoutes   map[string]*RouterGroup // 组路由
 	Routes        map[string]*RouteInfo   // 直接路由
 	newContextFun func() Context
+	httpServer    *http.Server
+	listener      net.Listener  // Run之后的监听，Addr端口为0时用ListenAddr获取实际地址
+	bound         chan struct{} // Run监听成功后关闭
+	lock          *sync.Mutex
 }
 
 func NewEngine(addr string, newContextFun func() Context) *Engine {
@@ -128,6 +138,8 @@ func NewEngine(addr string, newContextFun func() Context) *Engine {
 		newContextFun: newContextFun,
 		GroupRoutes:   make(map[string]*RouterGroup),
 		Routes:        make(map[string]*RouteInfo),
+		bound:         make(chan struct{}),
+		lock:          new(sync.Mutex),
 	}
 	return engine
 }
@@ -205,17 +217,65 @@ func (e *Engine) TravelGroupTree() map[string]*RouteInfo {
 }
 
 func (e *Engine) Run() error {
-	return e.ginEngine.Run(e.Addr)
+	// 通过libsyscal监听，热升级时监听会传递给新进程
+	ln, err := libsyscal.Listen("tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	e.lock.Lock()
+	e.listener = ln
+	select {
+	case <-e.bound:
+	default:
+		close(e.bound)
+	}
+	e.lock.Unlock()
+	err = e.getHttpServer().Serve(ln)
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
+
+// Shutdown 优雅停止web服务，不再接收新连接，等待处理中的请求完成或者ctx超时
+func (e *Engine) Shutdown(ctx context.Context) error {
+	return e.getHttpServer().Shutdown(ctx)
 }
 
 func (e *Engine) Stop() {
+	ctx, f := context.WithTimeout(context.Background(), time.Second*5)
+	defer f()
+	e.Shutdown(ctx)
+}
 
+// Bound Run监听成功后关闭，之后可以接收请求，ListenAddr返回实际监听地址
+func (e *Engine) Bound() <-chan struct{} {
+	return e.bound
+}
+
+// ListenAddr 实际监听的地址，Run还没有监听成功时返回空，需要时先等待Bound
+func (e *Engine) ListenAddr() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.listener == nil {
+		return ""
+	}
+	return e.listener.Addr().String()
 }
 
 func (e *Engine) GetGinEngine() *gin.Engine {
 	return e.ginEngine
 }
 
+func (e *Engine) getHttpServer() *http.Server {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.httpServer == nil {
+		e.httpServer = &http.Server{Addr: e.Addr, Handler: e.ginEngine}
+	}
+	return e.httpServer
+}
+
 func getGinHandlerFun(newContextFun func() Context, structTemplate interface{}, unmarshalHandler unmarshal, handlers ...HandlerFunc) gin.HandlerFunc {
 	if len(handlers) == 0 {
 		return nil
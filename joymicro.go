@@ -1,9 +1,13 @@
 package lkit_go
 
 import (
+	"context"
 	"github.com/smallnest/rpcx/client"
 	"github.com/xlkness/lkit-go/internal/joymicro/joyclient"
 	"github.com/xlkness/lkit-go/internal/joymicro/joyservice"
+	"github.com/xlkness/lkit-go/internal/joymicro/joystream"
+	"github.com/xlkness/lkit-go/internal/joymicro/registry"
+	"github.com/xlkness/lkit-go/internal/joymicro/rpc_context"
 	"time"
 )
 
@@ -11,16 +15,56 @@ type JoyService = joyservice.ServicesManager
 type JoyClient = joyclient.Service
 type JoySelector = joyclient.Selector
 
-func NewRpcService(listenAddr, exposeAddr string, etcdServerAddrs []string) (*JoyService, error) {
-	return joyservice.New(listenAddr, exposeAddr, etcdServerAddrs)
+// rpc服务注册的metadata key，RegisterOneService传入，选择器按weight、zone、version选择节点
+const (
+	RpcMetaWeight  = registry.MetaWeight
+	RpcMetaZone    = registry.MetaZone
+	RpcMetaVersion = registry.MetaVersion
+)
+
+// Registry rpc服务注册中心
+type Registry = registry.Registry
+
+// NewEtcdRegistry etcd注册中心
+func NewEtcdRegistry(etcdServerAddrs []string) Registry {
+	return registry.NewEtcdRegistry(etcdServerAddrs)
+}
+
+// NewMemoryRegistry 进程内的内存注册中心，用于测试、所有服务打包在一个进程的部署
+func NewMemoryRegistry() *registry.MemoryRegistry {
+	return registry.NewMemoryRegistry()
+}
+
+// NewStaticRegistry 固定服务列表的注册中心，services为服务名到节点地址列表，用于本地开发
+func NewStaticRegistry(services map[string][]string) *registry.StaticRegistry {
+	return registry.NewStaticRegistry(services)
+}
+
+// NewFileRegistry 从yaml或json文件读取固定服务列表的注册中心，用于本地开发
+func NewFileRegistry(path string) (*registry.StaticRegistry, error) {
+	return registry.NewFileRegistry(path)
 }
 
-func NewRpcServiceWithKey(key string, listenAddr, exposeAddr string, etcdServerAddrs []string) (*JoyService, error) {
-	return joyservice.NewWithKey(key, listenAddr, exposeAddr, etcdServerAddrs)
+// NewConsulRegistry consul注册中心，addr为consul agent地址，token为acl token
+func NewConsulRegistry(addr string, token string) Registry {
+	return registry.NewConsulRegistry(addr, token)
 }
 
-func NewRpcClient(service string, etcdServerAddrs []string, callTimeout time.Duration, isPermanentSocketLink bool) *JoyClient {
-	return joyclient.New(service, etcdServerAddrs, callTimeout, isPermanentSocketLink)
+// NewDnsSrvRegistry 只读的DNS-SRV服务发现，nameFormat为SRV记录名格式，%s替换为服务名
+func NewDnsSrvRegistry(nameFormat string) Registry {
+	return registry.NewDnsSrvRegistry(nameFormat)
+}
+
+func NewRpcService(listenAddr, exposeAddr string, r Registry) (*JoyService, error) {
+	return joyservice.New(listenAddr, exposeAddr, r)
+}
+
+func NewRpcServiceWithKey(key string, listenAddr, exposeAddr string, r Registry) (*JoyService, error) {
+	return joyservice.NewWithKey(key, listenAddr, exposeAddr, r)
+}
+
+func NewRpcClient(service string, r Registry, callTimeout time.Duration, isPermanentSocketLink bool) *JoyClient {
+	return joyclient.New(service, r, callTimeout, isPermanentSocketLink)
 }
 
 func NewRpcConsistentHashSelector() client.Selector {
@@ -30,3 +74,141 @@ func NewRpcConsistentHashSelector() client.Selector {
 func NewRpcPeerSelector() client.Selector {
 	return joyclient.NewPeerSelector()
 }
+
+// NewRpcWeightedRoundRobinSelector 按节点注册的weight加权轮询，zone不为空时优先相同zone的节点
+func NewRpcWeightedRoundRobinSelector(zone string) client.Selector {
+	return joyclient.NewWeightedRoundRobinSelector(zone)
+}
+
+// NewRpcLeastInflightSelector 选择处理中请求数/weight最低的节点，zone不为空时优先相同zone的节点
+func NewRpcLeastInflightSelector(zone string) client.Selector {
+	return joyclient.NewLeastInflightSelector(zone)
+}
+
+type RpcRouteRule = joyclient.RouteRule
+type RpcRouteSelector = joyclient.RouteSelector
+
+// NewRpcRouteSelector 按版本路由规则选择节点，规则用SetRules设置或WatchEtcd从etcd热更新，
+// newSelector创建每个版本节点的选择器，为空时用加权轮询
+func NewRpcRouteSelector(newSelector func() client.Selector) *RpcRouteSelector {
+	return joyclient.NewRouteSelector(newSelector)
+}
+
+type RpcBreakerConfig = joyclient.BreakerConfig
+
+// DefaultRpcBreakerConfig JoyClient默认的节点熔断配置，修改后用JoyClient.SetBreakerConfig设置
+func DefaultRpcBreakerConfig() RpcBreakerConfig {
+	return joyclient.DefaultBreakerConfig
+}
+
+// SetRpcRetryBudget 设置所有JoyClient共享的失败重试预算，重试最多占调用数的ratio，每秒至少允许minPerSecond次重试
+func SetRpcRetryBudget(ratio float64, minPerSecond int) {
+	joyclient.SetRetryBudget(ratio, minPerSecond)
+}
+
+type RpcLimitConfig = joyservice.LimitConfig
+
+// IsRpcOverloaded 是否为服务端限流(JoyService.SetLimit)拒绝调用的过载错误
+func IsRpcOverloaded(err error) bool {
+	return joyclient.IsOverloaded(err)
+}
+
+// WithRpcRequestID 设置请求id，之后的链式rpc调用都传递这个id，没有设置时第一次调用自动生成
+func WithRpcRequestID(ctx context.Context, requestID string) context.Context {
+	return rpc_context.WithRequestID(ctx, requestID)
+}
+
+// RpcRequestID 当前调用链的请求id
+func RpcRequestID(ctx context.Context) string {
+	return rpc_context.RequestID(ctx)
+}
+
+// WithRpcBaggage 设置透传数据，之后的链式rpc调用都会携带
+func WithRpcBaggage(ctx context.Context, key, value string) context.Context {
+	return rpc_context.WithBaggage(ctx, key, value)
+}
+
+// RpcBaggage 获取链式rpc调用透传的数据
+func RpcBaggage(ctx context.Context, key string) string {
+	return rpc_context.Baggage(ctx, key)
+}
+
+// RpcCaller rpc服务处理调用时，上游调用方的服务名
+func RpcCaller(ctx context.Context) string {
+	return rpc_context.Caller(ctx)
+}
+
+// SetRpcDefaultCaller 设置不在rpc调用处理中发起调用时的调用方名字，默认为进程名
+func SetRpcDefaultCaller(name string) {
+	rpc_context.SetDefaultCaller(name)
+}
+
+// CallOption rpc调用选项，通过WithCallOptions放入ctx，或者传给生成代码的调用函数
+type CallOption = joyclient.CallOption
+
+// WithCallOptions 把rpc调用选项放入ctx
+func WithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	return joyclient.WithCallOptions(ctx, opts...)
+}
+
+// WithSelectKey 选择节点的key，一致性hash选择器相同key选择相同节点，点对点选择器选择主键为key的节点
+func WithSelectKey(key interface{}) CallOption {
+	return joyclient.WithSelectKey(key)
+}
+
+// OneWay 单向调用，只把请求发到服务端，不等待回复
+func OneWay() CallOption {
+	return joyclient.OneWay()
+}
+
+// Broadcast 调用服务的所有节点
+func Broadcast() CallOption {
+	return joyclient.Broadcast()
+}
+
+// WithTimeout rpc调用的超时时间
+func WithTimeout(timeout time.Duration) CallOption {
+	return joyclient.WithTimeout(timeout)
+}
+
+// WithRetries rpc调用失败后重试其它节点的最大次数，0为不重试，默认4次，最大16次
+func WithRetries(retries int) CallOption {
+	return joyclient.WithRetries(retries)
+}
+
+// IsOneWay ctx是否设置了单向调用
+func IsOneWay(ctx context.Context) bool {
+	return joyclient.IsOneWay(ctx)
+}
+
+// IsBroadcast ctx是否设置了调用所有节点
+func IsBroadcast(ctx context.Context) bool {
+	return joyclient.IsBroadcast(ctx)
+}
+
+// JoyStream rpc流式调用的双向流，客户端由JoyClient.Stream建立，服务端由JoyService.RegisterStream注册处理函数
+type JoyStream = joystream.Stream
+
+// RpcStreamHandler rpc流式调用的服务端处理函数
+type RpcStreamHandler = joyservice.StreamHandler
+
+// NewJoyStreamPipe 创建一对内存中相连的流，用于生成代码的本地调试模式
+func NewJoyStreamPipe(ctx context.Context) (*JoyStream, *JoyStream) {
+	return joystream.Pipe(ctx)
+}
+
+// WithQuorum JoyClient.Fork调用有quorum个节点成功后立即返回，不等待其它节点
+func WithQuorum(quorum int) CallOption {
+	return joyclient.WithQuorum(quorum)
+}
+
+// RpcFuture rpc异步调用的结果，由JoyClient.Go或者生成代码的XxxGo函数返回
+type RpcFuture = joyclient.Future
+
+// RpcForkResult JoyClient.Fork调用每个节点的结果
+type RpcForkResult = joyclient.ForkResult
+
+// NewRpcFuture 在新的goroutine里执行fn，返回保存fn结果的Future
+func NewRpcFuture(fn func() (interface{}, error)) *RpcFuture {
+	return joyclient.NewFuture(fn)
+}
@@ -0,0 +1,45 @@
+package lkit_go
+
+import (
+	"github.com/xlkness/lkit-go/internal/netcore/kcp"
+	"github.com/xlkness/lkit-go/internal/netcore/socket"
+	"github.com/xlkness/lkit-go/internal/netcore/socket/event"
+	"github.com/xlkness/lkit-go/internal/netcore/socket/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SocketServer = socket.Server
+type SocketSession = socket.Session
+type SocketClientConn = socket.ClientConn
+type SocketClientConnType = socket.ClientConnType
+type SocketOption = socket.Option
+type SocketTLVPacket = utils.TLVPacket
+type SocketEventError = event.Error
+
+var (
+	SocketClientConnTypeTcp = socket.ClientConnTypeTcp
+	SocketClientConnTypeWs  = socket.ClientConnTypeWs
+)
+
+// NewSocketServer 创建socket服务，commType目前只支持tcp
+func NewSocketServer(commType, addr string, newSessionFunc func(SocketClientConn) SocketSession, option *SocketOption) SocketServer {
+	return socket.NewServer(commType, addr, newSessionFunc, option)
+}
+
+// NewWSSocketServer 创建websocket服务
+func NewWSSocketServer(addr string, newSessionFunc func(SocketClientConn) SocketSession, option *SocketOption,
+	loggerFun func(params gin.LogFormatterParams), panicOutputFun func(string), fs http.FileSystem) SocketServer {
+	return socket.NewWSServer(addr, newSessionFunc, option, loggerFun, panicOutputFun, fs)
+}
+
+type KcpListener = kcp.Listener
+type KcpSession = kcp.Session
+
+// KcpListen 监听地址的udp包
+// acceptorNum: 监听协程数（大于1表示启用reuseport）
+// workerPoolNumPerReadConn: 每个监听协程配套的工作池数量
+func KcpListen(addr string, acceptorNum, workerPoolNumPerReadConn int) (*KcpListener, error) {
+	return kcp.Listen(addr, acceptorNum, workerPoolNumPerReadConn)
+}